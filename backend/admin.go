@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"golang.org/x/term"
+)
+
+const adminUsage = `Usage: server [flags] admin <command> [flags]
+
+Commands:
+  create -username name -email address [-password-file file | -password-stdin]
+  list
+  reset-password -username name [-password-file file | -password-stdin]
+  delete -username name
+
+Without -password-file or -password-stdin the password is asked for, only
+when attached to a terminal.`
+
+// Create the first admin from the bootstrap settings. Without them the server
+// starts with no admin, "server admin create" adds one.
+func bootstrapAdmin(cfg config.AdminBootstrap, admins repository.AdminRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := admins.Count(ctx)
+	if err != nil {
+		logging.Default.Error("counting the admins", "error", err)
+		os.Exit(1)
+	}
+	if count > 0 {
+		return
+	}
+	if cfg.Username == "" {
+		logging.Default.Warn(`there is no admin, create one with "server admin create"`)
+		return
+	}
+
+	password := cfg.Password
+	if cfg.PasswordFile != "" {
+		if password, err = readPasswordFile(cfg.PasswordFile); err != nil {
+			logging.Default.Error("reading the bootstrap admin password", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Instances starting together race, one of them wins
+	admin, err := newAdmin(ctx, admins, cfg.Username, cfg.Email, password)
+	if err == repository.ErrConflict {
+		return
+	}
+	if err != nil {
+		logging.Default.Error("creating the bootstrap admin", "error", err)
+		os.Exit(1)
+	}
+	logging.Default.Info("bootstrap admin created", "admin", admin.ID, "username", admin.Username)
+}
+
+// server admin create|list|reset-password|delete
+func runAdmin(repos *repository.Repositories, h *controllers.Handler, args []string) error {
+	if adminHelp(args) {
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	command, args := args[0], args[1:]
+	fs := flag.NewFlagSet("admin "+command, flag.ContinueOnError)
+	username := fs.String("username", "", "username of the admin")
+
+	switch command {
+	case "create":
+		email := fs.String("email", "", "email of the admin")
+		password := passwordFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *username == "" || *email == "" {
+			return errors.New("-username and -email are required")
+		}
+		if _, err := repos.Admins.FindByUsername(ctx, *username); err == nil {
+			return fmt.Errorf("admin %q already exists", *username)
+		}
+
+		secret, err := password()
+		if err != nil {
+			return err
+		}
+		admin, err := newAdmin(ctx, repos.Admins, *username, *email, secret)
+		if err == repository.ErrConflict {
+			return errors.New("username or email already in use")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created admin %s %s\n", admin.ID.Hex(), admin.Username)
+
+	case "list":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		admins, err := repos.Admins.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tTWO FACTOR")
+		for _, admin := range admins {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", admin.ID.Hex(), admin.Username, admin.Email, admin.TOTPEnabled)
+		}
+		w.Flush()
+
+	case "reset-password":
+		password := passwordFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		admin, err := findAdmin(ctx, repos.Admins, *username)
+		if err != nil {
+			return err
+		}
+
+		secret, err := password()
+		if err != nil {
+			return err
+		}
+		hashed, err := utils.HashPassword(secret)
+		if err != nil {
+			return err
+		}
+		if err := repos.Admins.SetPassword(ctx, admin.ID, hashed); err != nil {
+			return err
+		}
+
+		// Whoever had the old password is logged out
+		if err := h.RevokeAdminSessions(ctx, admin.ID); err != nil {
+			return err
+		}
+		fmt.Printf("reset the password of %s\n", admin.Username)
+
+	case "delete":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		admin, err := findAdmin(ctx, repos.Admins, *username)
+		if err != nil {
+			return err
+		}
+
+		// Someone has to be left to run the platform
+		count, err := repos.Admins.Count(ctx)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return errors.New("can't delete the last admin, create another one first")
+		}
+
+		if err := repos.Admins.Delete(ctx, admin.ID); err != nil {
+			return err
+		}
+		if err := h.RevokeAdminSessions(ctx, admin.ID); err != nil {
+			return err
+		}
+		fmt.Printf("deleted admin %s\n", admin.Username)
+
+	default:
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return fmt.Errorf("unknown admin command %q", command)
+	}
+
+	return nil
+}
+
+// Whether the admin command line only asks for the usage
+func adminHelp(args []string) bool {
+	return len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help"
+}
+
+// Hashes the password and inserts the admin
+func newAdmin(ctx context.Context, admins repository.AdminRepository, username string, email string, password string) (*models.Admin, error) {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	admin := &models.Admin{Username: username, Email: email, Password: hashed}
+	if err := admins.Create(ctx, admin); err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+func findAdmin(ctx context.Context, admins repository.AdminRepository, username string) (*models.Admin, error) {
+	if username == "" {
+		return nil, errors.New("-username is required")
+	}
+
+	admin, err := admins.FindByUsername(ctx, username)
+	if err == repository.ErrNotFound {
+		return nil, fmt.Errorf("no admin %q", username)
+	}
+	return admin, err
+}
+
+// Adds the password flags, the returned func reads the password they point to
+func passwordFlags(fs *flag.FlagSet) func() (string, error) {
+	file := fs.String("password-file", "", "read the password from the file")
+	stdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+
+	return func() (string, error) {
+		switch {
+		case *file != "" && *stdin:
+			return "", errors.New("-password-file and -password-stdin can't be used together")
+		case *file != "":
+			return readPasswordFile(*file)
+		case *stdin:
+			return readPasswordLine(os.Stdin)
+		default:
+			return promptPassword()
+		}
+	}
+}
+
+// First line of the file
+func readPasswordFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return readPasswordLine(f)
+}
+
+// First line of the reader, without its line break
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+	return password, nil
+}
+
+// Asks for the password twice without echoing it, only on a terminal so
+// scripts and containers never hang waiting for an answer
+func promptPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no password: use -password-file or -password-stdin when not on a terminal")
+	}
+
+	read := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+
+	password, err := read("Password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+	again, err := read("Repeat the password: ")
+	if err != nil {
+		return "", err
+	}
+	if again != password {
+		return "", errors.New("the passwords don't match")
+	}
+	return password, nil
+}
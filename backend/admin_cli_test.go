@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func TestAdminCommands(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	h := controllers.New(s.repos, middlewares.NewAuth(s.repos, s.services.Keys), s.services, appConfig(s.cfg.App))
+	admin := func(args ...string) error {
+		return runAdmin(s.repos, h, args)
+	}
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte(testPassword+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Never prompts without a terminal
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin, _ = os.Open(os.DevNull)
+	if err := admin("create", "-username", "root", "-email", "root@example.com"); err == nil {
+		t.Fatal("created an admin without a password")
+	}
+	if err := admin("create", "-username", "root"); err == nil {
+		t.Fatal("created an admin without an email")
+	}
+	if err := admin("create", "-username", "root", "-email", "root@example.com", "-password-file", passwordFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin("create", "-username", "other", "-email", "root@example.com", "-password-file", passwordFile); err == nil {
+		t.Fatal("created an admin with a taken email")
+	}
+	root := &account{Username: "root", Password: testPassword}
+	s.loginAdmin(root)
+	s.call("GET", "/api/users", root.Token, nil).expect(fiber.StatusOK)
+
+	// The old password and its sessions stop working
+	if err := os.WriteFile(passwordFile, []byte("another-password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin("reset-password", "-username", "root", "-password-file", passwordFile); err != nil {
+		t.Fatal(err)
+	}
+	s.call("GET", "/api/users", root.Token, nil).expect(fiber.StatusUnauthorized)
+	s.call("POST", "/api/auth/login-admin", "", fiber.Map{"username": "root", "password": testPassword}).
+		expect(fiber.StatusUnauthorized)
+	root.Password = "another-password"
+	s.loginAdmin(root)
+
+	// Someone stays in charge
+	if err := admin("delete", "-username", "root"); err == nil {
+		t.Fatal("deleted the last admin")
+	}
+	s.createAdmin("backup")
+	if err := admin("delete", "-username", "root"); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin("delete", "-username", "root"); err == nil {
+		t.Fatal("deleted a missing admin")
+	}
+	s.call("GET", "/api/users", root.Token, nil).expect(fiber.StatusUnauthorized)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+
+	// Nothing to create from
+	bootstrapAdmin(config.AdminBootstrap{}, s.repos.Admins)
+	if admins, _ := s.repos.Admins.List(context.Background()); len(admins) != 0 {
+		t.Fatalf("unexpected admins %v", admins)
+	}
+
+	bootstrap := config.AdminBootstrap{Username: "root", Email: "root@example.com", Password: testPassword}
+	bootstrapAdmin(bootstrap, s.repos.Admins)
+	s.loginAdmin(&account{Username: "root", Password: testPassword})
+
+	// Only when there is no admin
+	bootstrapAdmin(config.AdminBootstrap{Username: "second", Email: "second@example.com", Password: testPassword}, s.repos.Admins)
+	if admins, _ := s.repos.Admins.List(context.Background()); len(admins) != 1 {
+		t.Fatalf("unexpected admins %v", admins)
+	}
+}
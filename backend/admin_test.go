@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSecuritySettings(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+
+	s.call("GET", "/api/settings/security", alice.Token, nil).expectForbidden("settings:manage")
+	s.call("PUT", "/api/settings/security", alice.Token, fiber.Map{"require_admin_two_factor": true}).expectForbidden("settings:manage")
+
+	res := s.call("GET", "/api/settings/security", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.get("data.require_admin_two_factor") != false {
+		t.Fatalf("unexpected settings %v", res.body)
+	}
+	s.call("PUT", "/api/settings/security", admin.Token, fiber.Map{"require_admin_two_factor": true}).expectSuccess(fiber.StatusOK)
+	res = s.call("GET", "/api/settings/security", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.get("data.require_admin_two_factor") != true {
+		t.Fatalf("unexpected settings %v", res.body)
+	}
+}
+
+func TestLockouts(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+
+	s.call("GET", "/api/lockouts/ips/0.0.0.0", alice.Token, nil).expectForbidden("lockout:manage")
+	s.call("DELETE", "/api/lockouts/accounts/user/alice", alice.Token, nil).expectForbidden("lockout:manage")
+
+	res := s.call("GET", "/api/lockouts/ips/0.0.0.0", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.key") != "ip:0.0.0.0" || res.get("data.locked") != false {
+		t.Fatalf("unexpected lockout %v", res.body)
+	}
+	s.call("DELETE", "/api/lockouts/ips/0.0.0.0", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", "/api/lockouts/accounts/robot/alice", admin.Token, nil).expectFailure(fiber.StatusNotFound, "Lockout not found")
+	s.call("DELETE", "/api/lockouts/accounts/robot/alice", admin.Token, nil).expectFailure(fiber.StatusNotFound, "Lockout not found")
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	admin := s.createAdmin("root")
+	storeId := s.createStore(bob, "Bob's shop")
+	productId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+
+	s.call("GET", "/api/audit", bob.Token, nil).expectForbidden("audit:read")
+	s.call("GET", "/api/audit?actor=bob", admin.Token, nil).expectFailure(fiber.StatusBadRequest, "Invalid actor")
+	s.call("GET", "/api/audit?from=yesterday", admin.Token, nil).expectFailure(fiber.StatusBadRequest, "The from date must be RFC 3339")
+	s.call("GET", "/api/audit?cursor=last", admin.Token, nil).expectFailure(fiber.StatusBadRequest, "Invalid cursor")
+
+	res := s.call("GET", "/api/audit?target_type=products", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	entries := res.list("data")
+	if len(entries) != 1 {
+		t.Fatalf("unexpected entries %v", res.body)
+	}
+	entry := entries[0].(map[string]interface{})
+	if entry["target"] != productId || entry["actor"] != bob.ID || entry["action"] != "POST /api/stores/:storeId/products" {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+
+	// Newest first, a page at a time
+	res = s.call("GET", "/api/audit?limit=1&actor="+bob.ID, admin.Token, nil).expectSuccess(fiber.StatusOK)
+	cursor := res.str("next_cursor")
+	if res.list("data")[0].(map[string]interface{})["target"] != productId {
+		t.Fatalf("unexpected first page %v", res.body)
+	}
+	res = s.call("GET", "/api/audit?limit=1&actor="+bob.ID+"&cursor="+cursor, admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.list("data")[0].(map[string]interface{})["target"] != storeId {
+		t.Fatalf("unexpected second page %v", res.body)
+	}
+
+	// Reads aren't audited
+	s.call("GET", "/api/stores/"+storeId, "", nil).expectSuccess(fiber.StatusOK)
+	res = s.call("GET", "/api/audit?target="+storeId, admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if len(res.list("data")) != 1 {
+		t.Fatalf("unexpected entries %v", res.body)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+
+	s.call("GET", "/api/status", "", nil).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("GET", "/api/status", alice.Token, nil).expectForbidden("status:read")
+
+	res := s.call("GET", "/api/status", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.get("data.ready") != true || res.get("data.build") == nil {
+		t.Fatalf("unexpected status %v", res.body)
+	}
+}
@@ -0,0 +1,176 @@
+// Package audit records who did what in the append only audit log. Nothing
+// in the application updates or deletes its entries.
+package audit
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ActionLockout = "auth.lockout"
+	ActionUnlock  = "auth.unlock"
+
+	localsKey = "audit"
+)
+
+// Fields never copied into the log
+var redactedFields = []string{"password", "totp_secret", "totp_last_counter", "recovery_codes", "token_hash", "secret_hash"}
+
+// Where the entries are appended
+type Log interface {
+	Insert(ctx context.Context, entry models.AuditEntry) error
+}
+
+// Where the states of the targets are read from, filters only compare fields
+// for equality
+type Source interface {
+	Snapshot(ctx context.Context, collection string, filter bson.M) (bson.M, error)
+}
+
+// What a request changed, filled by the handler and written by the audit
+// middleware once the handler is done
+type Change struct {
+	Action     string
+	TargetType string
+	Target     string
+	Before     bson.M
+	Details    map[string]interface{}
+
+	source     Source
+	collection string
+	filter     bson.M
+}
+
+// Appends the entry to the log. Failures are only logged, they never fail the
+// audited action.
+func Record(ctx context.Context, log Log, entry models.AuditEntry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	if err := log.Insert(ctx, entry); err != nil {
+		logging.Default.Error("recording the audit entry", "action", entry.Action, "error", err)
+	}
+}
+
+// ID of the request, from the request ID middleware or the caller's header
+func RequestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestid").(string); ok && id != "" {
+		return id
+	}
+	return c.Get(fiber.HeaderXRequestID)
+}
+
+// Change described by the handler, if any
+func Lookup(c *fiber.Ctx) (*Change, bool) {
+	change, ok := c.Locals(localsKey).(*Change)
+	return change, ok
+}
+
+// Starts the change of the request, the states of its target are read from
+// the source
+func Begin(c *fiber.Ctx, source Source) *Change {
+	change := &Change{source: source}
+	c.Locals(localsKey, change)
+	return change
+}
+
+// Change of the request, created on first use
+func RequestChange(c *fiber.Ctx) *Change {
+	if change, ok := Lookup(c); ok {
+		return change
+	}
+	change := &Change{}
+	c.Locals(localsKey, change)
+	return change
+}
+
+// Names the document of the collection the request is about to change and
+// keeps its current state
+func Target(c *fiber.Ctx, collection string, id primitive.ObjectID) {
+	TargetFilter(c, collection, id.Hex(), bson.M{"_id": id})
+}
+
+// Same as Target for documents found by another filter
+func TargetFilter(c *fiber.Ctx, collection string, target string, filter bson.M) {
+	change := RequestChange(c)
+	change.TargetType = collection
+	change.Target = target
+	change.collection = collection
+	change.filter = filter
+	change.Before = change.snapshot()
+}
+
+// Names the document the request just created, it had no previous state
+func Created(c *fiber.Ctx, collection string, id primitive.ObjectID) {
+	change := RequestChange(c)
+	change.TargetType = collection
+	change.Target = id.Hex()
+	change.collection = collection
+	change.filter = bson.M{"_id": id}
+	change.Before = nil
+}
+
+// Names the action and target of requests that don't change a document
+func Describe(c *fiber.Ctx, action string, targetType string, target string) {
+	change := RequestChange(c)
+	change.Action = action
+	change.TargetType = targetType
+	change.Target = target
+}
+
+// Current state of the target of the change, nil if it isn't a document or is
+// gone
+func (change *Change) After() bson.M {
+	if change.collection == "" {
+		return nil
+	}
+	return change.snapshot()
+}
+
+func (change *Change) snapshot() bson.M {
+	if change.source == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	document, err := change.source.Snapshot(ctx, change.collection, change.filter)
+	if err != nil {
+		return nil
+	}
+	for _, field := range redactedFields {
+		delete(document, field)
+	}
+	return document
+}
+
+// Top level fields that differ between the two states
+func Diff(before bson.M, after bson.M) map[string]models.AuditChange {
+	changes := map[string]models.AuditChange{}
+
+	for field, value := range before {
+		if other, ok := after[field]; !ok || !reflect.DeepEqual(value, other) {
+			changes[field] = models.AuditChange{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = models.AuditChange{Before: nil, After: value}
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
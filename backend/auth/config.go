@@ -0,0 +1,24 @@
+package auth
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Settings of the token signing keys, loaded by the config package
+type Config struct {
+	// HS256, RS256 or EdDSA
+	Algorithm string `yaml:"algorithm"`
+	// Shared key of HS256
+	Secret string `yaml:"secret"`
+	// PEM private key of RS256 and EdDSA
+	PrivateKeyFile string `yaml:"private_key_file"`
+	// kid of the signing key, derived from the public key when empty
+	KeyID string `yaml:"key_id"`
+	// Older keys still accepted while rotating, by kid. PEM public key files
+	// for RS256 and EdDSA, secrets for HS256.
+	VerificationKeys map[string]string `yaml:"verification_keys"`
+	// iss claim of the tokens, not checked when empty
+	Issuer string `yaml:"issuer"`
+}
@@ -0,0 +1,239 @@
+// Package auth issues and verifies the JWT access tokens. Tokens are signed
+// with a single active key and verified with any of the configured keys,
+// picked by the kid header, so keys can be rotated without logging everyone
+// out.
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownKey   = errors.New("auth: unknown key id")
+	ErrWrongPurpose = errors.New("auth: token is not meant for this")
+)
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// Signing key and the keys accepted for verification
+type KeySet struct {
+	method     jwt.SigningMethod
+	kid        string
+	signingKey interface{}
+	keys       map[string]verificationKey
+	issuer     string
+}
+
+// Loads the keys of the config
+func NewKeySet(config Config) (*KeySet, error) {
+	keySet := &KeySet{
+		kid:    config.KeyID,
+		keys:   map[string]verificationKey{},
+		issuer: config.Issuer,
+	}
+
+	switch config.Algorithm {
+	case AlgorithmHS256:
+		if config.Secret == "" {
+			return nil, errors.New("auth: HS256 needs a secret")
+		}
+		keySet.method = jwt.SigningMethodHS256
+		keySet.signingKey = []byte(config.Secret)
+		keySet.keys[keySet.kid] = verificationKey{jwt.SigningMethodHS256, []byte(config.Secret)}
+
+		for kid, secret := range config.VerificationKeys {
+			keySet.keys[kid] = verificationKey{jwt.SigningMethodHS256, []byte(secret)}
+		}
+		return keySet, nil
+
+	case AlgorithmRS256, AlgorithmEdDSA:
+		if config.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("auth: %s needs a private key file", config.Algorithm)
+		}
+		data, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: reading the private key: %w", err)
+		}
+
+		var public interface{}
+		if config.Algorithm == AlgorithmRS256 {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("auth: parsing the private key: %w", err)
+			}
+			keySet.method, keySet.signingKey, public = jwt.SigningMethodRS256, private, &private.PublicKey
+		} else {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("auth: parsing the private key: %w", err)
+			}
+			keySet.method, keySet.signingKey, public = jwt.SigningMethodEdDSA, private, private.(ed25519.PrivateKey).Public()
+		}
+
+		if keySet.kid == "" {
+			if keySet.kid, err = thumbprint(public); err != nil {
+				return nil, err
+			}
+		}
+		keySet.keys[keySet.kid] = verificationKey{keySet.method, public}
+
+		for kid, file := range config.VerificationKeys {
+			key, err := loadPublicKey(file)
+			if err != nil {
+				return nil, fmt.Errorf("auth: verification key %s: %w", kid, err)
+			}
+			keySet.keys[kid] = key
+		}
+		return keySet, nil
+	}
+
+	return nil, fmt.Errorf("auth: unsupported algorithm %q", config.Algorithm)
+}
+
+// Reads a PEM RSA or Ed25519 public key
+func loadPublicKey(file string) (verificationKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return verificationKey{}, err
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return verificationKey{jwt.SigningMethodRS256, key}, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return verificationKey{jwt.SigningMethodEdDSA, key}, nil
+	}
+
+	return verificationKey{}, errors.New("not an RSA or Ed25519 public key")
+}
+
+// Short stable id of a public key
+func thumbprint(public interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Signs the claims with the active key, adding iat and iss. iat has the
+// millisecond precision of the dates revoking tokens.
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iat"] = float64(time.Now().UnixMilli()) / 1000
+	if k.issuer != "" {
+		claims["iss"] = k.issuer
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.kid != "" {
+		token.Header["kid"] = k.kid
+	}
+
+	return token.SignedString(k.signingKey)
+}
+
+// Verifies an access token, single purpose tokens are rejected
+func (k *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	token, err := k.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := token.Claims.(jwt.MapClaims)[purposeClaim]; ok {
+		return nil, ErrWrongPurpose
+	}
+	return token, nil
+}
+
+// Verifies the token with the key named by its kid header. Tokens without a
+// kid are checked against the active key.
+func (k *KeySet) parse(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = k.kid
+		}
+
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("auth: unexpected signing method %v", token.Header["alg"])
+		}
+		return key.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if k.issuer != "" && !token.Claims.(jwt.MapClaims).VerifyIssuer(k.issuer, true) {
+		return nil, errors.New("auth: unexpected issuer")
+	}
+
+	return token, nil
+}
+
+// JSON Web Key of a public key, RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Public keys of the set, shared keys are never published
+func (k *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	for kid, key := range k.keys {
+		switch public := key.key.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     kid,
+				Use:       "sig",
+				Algorithm: AlgorithmRS256,
+				N:         encode(public.N.Bytes()),
+				E:         encode(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     kid,
+				Use:       "sig",
+				Algorithm: AlgorithmEdDSA,
+				Curve:     "Ed25519",
+				X:         encode(public),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Names the one thing a token can be used for, tokens with it are never
+// accepted as access tokens
+const purposeClaim = "purpose"
+
+// Signs a token that expires after ttl and is only accepted by ParsePurpose
+// for the same purpose
+func (k *KeySet) SignPurpose(purpose string, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	claims[purposeClaim] = purpose
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	return k.Sign(claims)
+}
+
+// Verifies a token signed by SignPurpose and returns its claims
+func (k *KeySet) ParsePurpose(purpose string, tokenString string) (jwt.MapClaims, error) {
+	token, err := k.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims[purposeClaim] != purpose {
+		return nil, ErrWrongPurpose
+	}
+	return claims, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sessions that can't tell whether a token was revoked
+type unreachableSessions struct {
+	repository.SessionRepository
+}
+
+func (unreachableSessions) AccessTokenRevoked(ctx context.Context, jti string, subject primitive.ObjectID, issuedAt time.Time) (bool, error) {
+	return false, errors.New("sessions unavailable")
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	res := s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": testPassword}).
+		expectSuccess(fiber.StatusOK)
+	if res.str("token_type") != "Bearer" || res.num("expires_in") <= 0 {
+		t.Fatalf("unexpected session %v", res.body)
+	}
+
+	s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).expectSuccess(fiber.StatusOK)
+}
+
+func TestRegisterValidation(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	s.register("alice")
+
+	s.call("POST", "/api/auth/register", "", fiber.Map{"username": "bob"}).
+		expectFailure(fiber.StatusBadRequest, "")
+	s.call("POST", "/api/auth/register", "", fiber.Map{
+		"username":  "alice",
+		"password":  testPassword,
+		"email":     "other@example.com",
+		"full_name": "Alice",
+	}).expectFailure(fiber.StatusUnauthorized, "Username already in use")
+	s.call("POST", "/api/auth/register", "", fiber.Map{
+		"username":  "alice2",
+		"password":  testPassword,
+		"email":     "alice@example.com",
+		"full_name": "Alice",
+	}).expectFailure(fiber.StatusUnauthorized, "Username or email already in use")
+}
+
+func TestLoginWrongCredentials(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	s.register("alice")
+
+	s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": "wrong-password"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid username or password")
+	s.call("POST", "/api/auth/login", "", fiber.Map{"username": "nobody", "password": testPassword}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid username or password")
+	s.call("POST", "/api/auth/login-admin", "", fiber.Map{"username": "alice", "password": testPassword}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid username or password")
+}
+
+func TestLoginLockout(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.register("alice")
+	admin := s.createAdmin("root")
+
+	for i := 0; i < 3; i++ {
+		s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": "wrong-password"}).
+			expectFailure(fiber.StatusUnauthorized, "")
+	}
+
+	// Even the right password waits
+	res := s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": testPassword}).
+		expectFailure(fiber.StatusTooManyRequests, "Too many failed attempts, try again later")
+	if res.header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Fatal("no Retry-After header")
+	}
+
+	res = s.call("GET", "/api/lockouts/accounts/user/alice", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.key") != "account:user:alice" {
+		t.Fatalf("unexpected lockout %v", res.body)
+	}
+	s.call("DELETE", "/api/lockouts/accounts/user/alice", admin.Token, nil).expectSuccess(fiber.StatusOK)
+
+	s.login(alice)
+}
+
+func TestProtectedRoutesNeedAToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	s.call("GET", "/api/users/"+alice.ID, "", nil).
+		expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("GET", "/api/users/"+alice.ID, "not-a-jwt", nil).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+
+	expired := mintToken(t, jwt.MapClaims{
+		"user_id":  alice.ID,
+		"username": alice.Username,
+		"exp":      time.Now().Add(-time.Minute).Unix(),
+	})
+	s.call("GET", "/api/users/"+alice.ID, expired, nil).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+
+	minted := mintToken(t, jwt.MapClaims{"user_id": alice.ID, "username": alice.Username})
+	s.call("GET", "/api/users/"+alice.ID, minted, nil).expectSuccess(fiber.StatusOK)
+}
+
+func TestRefreshRotatesTheSession(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	first := alice.RefreshToken
+
+	res := s.call("POST", "/api/auth/refresh", "", fiber.Map{"refresh_token": first}).
+		expectSuccess(fiber.StatusOK)
+	second := res.str("refresh_token")
+	if second == first {
+		t.Fatal("the refresh token was not rotated")
+	}
+
+	// Reusing a refresh token ends the whole session
+	s.call("POST", "/api/auth/refresh", "", fiber.Map{"refresh_token": first}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired refresh token")
+	s.call("POST", "/api/auth/refresh", "", fiber.Map{"refresh_token": second}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired refresh token")
+
+	s.call("POST", "/api/auth/refresh", "", fiber.Map{}).expectFailure(fiber.StatusBadRequest, "")
+}
+
+func TestLogout(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	s.call("POST", "/api/auth/logout", "", nil).expectFailure(fiber.StatusBadRequest, "")
+	s.call("POST", "/api/auth/logout", alice.Token, nil).expectSuccess(fiber.StatusOK)
+
+	s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+	s.call("POST", "/api/auth/refresh", "", fiber.Map{"refresh_token": alice.RefreshToken}).
+		expectFailure(fiber.StatusUnauthorized, "")
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	s.call("POST", "/api/auth/verify-email", "", fiber.Map{"token": "bogus"}).
+		expectFailure(fiber.StatusBadRequest, "Invalid or expired verification token")
+
+	// A new link can be asked for
+	s.call("POST", "/api/auth/verify-email/resend", "", nil).expectFailure(fiber.StatusBadRequest, "")
+	s.call("POST", "/api/auth/verify-email/resend", alice.Token, nil).expectSuccess(fiber.StatusOK)
+	token := linkToken(t, s.mail.wait(t, alice.Email, 2))
+
+	s.call("POST", "/api/auth/verify-email", "", fiber.Map{"token": token}).expectSuccess(fiber.StatusOK)
+	res := s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.get("data.email_verified") != true {
+		t.Fatalf("email not verified: %v", res.body)
+	}
+
+	s.call("POST", "/api/auth/verify-email/resend", alice.Token, nil).
+		expectFailure(fiber.StatusConflict, "Email already verified")
+
+	// Admins have nothing to verify
+	admin := s.createAdmin("root")
+	s.call("POST", "/api/auth/verify-email/resend", admin.Token, nil).
+		expectFailure(fiber.StatusBadRequest, "Only users verify their email")
+}
+
+func TestRevocationUnchecked(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	// The token may have been revoked, it isn't trusted
+	s.repos.Sessions = unreachableSessions{s.repos.Sessions}
+	s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).
+		expectFailure(fiber.StatusServiceUnavailable, "Failed to check the token")
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	// Same answer whether the account exists or not
+	s.call("POST", "/api/auth/forgot-password", "", fiber.Map{"login": "nobody"}).expectSuccess(fiber.StatusAccepted)
+	s.call("POST", "/api/auth/forgot-password", "", fiber.Map{"login": "alice"}).expectSuccess(fiber.StatusAccepted)
+	s.call("POST", "/api/auth/forgot-password", "", fiber.Map{}).expectFailure(fiber.StatusBadRequest, "")
+
+	// The verification email came first
+	token := linkToken(t, s.mail.wait(t, alice.Email, 2))
+
+	s.call("POST", "/api/auth/reset-password", "", fiber.Map{"token": token, "password": "short"}).
+		expectFailure(fiber.StatusBadRequest, "")
+	s.call("POST", "/api/auth/reset-password", "", fiber.Map{"token": primitive.NewObjectID().Hex() + ".secret", "password": "new-password-123"}).
+		expectFailure(fiber.StatusBadRequest, "Invalid or expired reset token")
+	s.call("POST", "/api/auth/reset-password", "", fiber.Map{"token": token, "password": "new-password-123"}).
+		expectSuccess(fiber.StatusOK)
+
+	// The token works once and the sessions are over
+	s.call("POST", "/api/auth/reset-password", "", fiber.Map{"token": token, "password": "new-password-456"}).
+		expectFailure(fiber.StatusBadRequest, "Invalid or expired reset token")
+	s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+
+	s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": testPassword}).
+		expectFailure(fiber.StatusUnauthorized, "")
+	// A session started right after the reset works
+	alice.Password = "new-password-123"
+	s.login(alice)
+	s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).expectSuccess(fiber.StatusOK)
+}
+
+func TestJWKS(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+
+	// Shared secrets are never published
+	res := s.call("GET", "/.well-known/jwks.json", "", nil).expect(fiber.StatusOK)
+	if keys, ok := res.body["keys"].([]interface{}); !ok || len(keys) != 0 {
+		t.Fatalf("unexpected keys %v", res.body)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+)
+
+func TestAnonymousCart(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	cupId := s.createProduct(bob, storeId, "CUP-1", 800, 10)
+	cart := "/api/stores/" + storeId + "/cart"
+
+	res := s.call("GET", cart, "", nil).expectSuccess(fiber.StatusOK)
+	if len(res.list("data.items")) != 0 {
+		t.Fatalf("unexpected cart %v", res.body)
+	}
+
+	// The first item starts a cart identified by the returned token
+	res = s.call("POST", cart+"/items", "", fiber.Map{"product": mugId, "quantity": 2}).expectSuccess(fiber.StatusOK)
+	token := res.header.Get(controllers.CartTokenHeader)
+	if token == "" {
+		t.Fatal("no cart token")
+	}
+
+	withToken := func(method string, path string, body interface{}) *response {
+		req := s.request(method, path, "", body)
+		req.Header.Set(controllers.CartTokenHeader, token)
+		return s.send(req)
+	}
+
+	withToken("POST", cart+"/items", fiber.Map{"product": cupId, "quantity": 1}).expectSuccess(fiber.StatusOK)
+	withToken("POST", cart+"/items", fiber.Map{"product": mugId, "quantity": 2}).expectFailure(fiber.StatusConflict, "Not enough stock")
+	withToken("POST", cart+"/items", fiber.Map{"product": "not-an-id"}).expectFailure(fiber.StatusNotFound, "Product not found")
+
+	res = withToken("GET", cart, nil).expectSuccess(fiber.StatusOK)
+	if res.num("data.subtotal") != 2*1200+800 || len(res.list("data.items")) != 2 {
+		t.Fatalf("unexpected cart %v", res.body)
+	}
+
+	withToken("PATCH", cart+"/items/"+mugId, fiber.Map{"quantity": 1}).expectSuccess(fiber.StatusOK)
+	withToken("PATCH", cart+"/items/"+mugId, fiber.Map{"quantity": 4}).expectFailure(fiber.StatusConflict, "")
+	withToken("DELETE", cart+"/items/"+cupId, nil).expectSuccess(fiber.StatusOK)
+
+	res = withToken("GET", cart, nil).expectSuccess(fiber.StatusOK)
+	if res.num("data.subtotal") != 1200 {
+		t.Fatalf("unexpected cart %v", res.body)
+	}
+
+	withToken("DELETE", cart, nil).expectSuccess(fiber.StatusOK)
+	res = withToken("GET", cart, nil).expectSuccess(fiber.StatusOK)
+	if len(res.list("data.items")) != 0 {
+		t.Fatalf("cart not emptied %v", res.body)
+	}
+}
+
+func TestCartMergedOnLogin(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 5)
+	cart := "/api/stores/" + storeId + "/cart"
+
+	s.call("POST", cart+"/items", alice.Token, fiber.Map{"product": mugId, "quantity": 1}).expectSuccess(fiber.StatusOK)
+	token := s.call("POST", cart+"/items", "", fiber.Map{"product": mugId, "quantity": 2}).
+		expectSuccess(fiber.StatusOK).
+		header.Get(controllers.CartTokenHeader)
+
+	// Logging in with the token moves the anonymous items to the user's cart
+	req := s.request("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": testPassword})
+	req.Header.Set(controllers.CartTokenHeader, token)
+	alice.keepSession(s.send(req))
+
+	res := s.call("GET", cart, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	items := res.list("data.items")
+	if len(items) != 1 || items[0].(map[string]interface{})["quantity"] != float64(3) {
+		t.Fatalf("unexpected cart %v", res.body)
+	}
+}
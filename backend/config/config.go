@@ -0,0 +1,791 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/auth"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings of the server. A flag wins over the environment variable (.env
+// included outside production), which wins over the YAML file of -config or
+// CONFIG_FILE, which wins over the default.
+type Config struct {
+	// APP_ENV, development, test or production
+	Env        string         `yaml:"env"`
+	HTTP       HTTP           `yaml:"http"`
+	Database   Database       `yaml:"database"`
+	Auth       auth.Config    `yaml:"auth"`
+	App        App            `yaml:"app"`
+	Logging    logging.Config `yaml:"logging"`
+	Tracing    tracing.Config `yaml:"tracing"`
+	Mail       mailer.Config  `yaml:"mail"`
+	Payments   Payments       `yaml:"payments"`
+	Lockout    Lockout        `yaml:"lockout"`
+	RateLimits RateLimits     `yaml:"rate_limits"`
+	Migrations Migrations     `yaml:"migrations"`
+	// First admin, created on start when there is none
+	AdminBootstrap AdminBootstrap `yaml:"admin_bootstrap"`
+}
+
+type HTTP struct {
+	Port string `yaml:"port"`
+	// Serves the metrics on their own port, with the API when empty
+	MetricsPort string `yaml:"metrics_port"`
+	// How long the requests in flight and the background work get to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// How long a stopping instance keeps serving while failing readiness
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// Header the proxies put the client IP in, overwriting it, like
+	// X-Real-IP. Only read from the trusted proxies.
+	ProxyHeader string `yaml:"proxy_header"`
+	// Addresses or CIDR ranges of the proxies in front of the server
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type Database struct {
+	// Connection string, may hold the password
+	URI            string        `yaml:"uri"`
+	Name           string        `yaml:"name"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+// Settings of the handlers
+type App struct {
+	// Base URL of the links in the emails
+	URL string `yaml:"url"`
+	// Lifetime of the access tokens
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl"`
+	// Lifetime of the refresh tokens, the session ends if it isn't refreshed in time
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	// How long the verification link works
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl"`
+	// How long a reset link works
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// How long an invite can be accepted
+	InviteTTL time.Duration `yaml:"invite_ttl"`
+	// How long stock stays reserved for an unpaid order
+	ReservationTTL time.Duration `yaml:"reservation_ttl"`
+	// Issuer shown by the authenticator apps
+	TOTPIssuer string `yaml:"totp_issuer"`
+	// Provider used for new payments, none turns the payments off
+	PaymentProvider string `yaml:"payment_provider"`
+}
+
+type Payments struct {
+	Fake FakePayments `yaml:"fake"`
+}
+
+// The fake provider, paying whatever payment method says so. Never in
+// production.
+type FakePayments struct {
+	// Registered only when enabled
+	Enabled bool `yaml:"enabled"`
+	// Key signing its webhooks, required when enabled
+	Secret string `yaml:"secret"`
+	// Where its webhooks are sent, this server when empty
+	WebhookURL string `yaml:"webhook_url"`
+	// How long until a payment is paid
+	Delay time.Duration `yaml:"delay"`
+}
+
+// Slowing down and blocking password guessing
+type Lockout struct {
+	// mongo to share the attempts between instances, or memory
+	Store string `yaml:"store"`
+	// How long failures count and a lockout lasts
+	Duration time.Duration `yaml:"duration"`
+	// Failures locking an account
+	Threshold int `yaml:"threshold"`
+	// Failures locking an IP
+	IPThreshold int `yaml:"ip_threshold"`
+}
+
+// Rates are "<limit>/<period>", like 5/1m
+type RateLimits struct {
+	// memory, or mongo to share the counters between instances
+	Store string `yaml:"store"`
+	// Login and the other password routes, per IP
+	Auth string `yaml:"auth"`
+	// Everything else, per account
+	API string `yaml:"api"`
+	// Storefront reads, per store
+	Storefront string `yaml:"storefront"`
+}
+
+type Migrations struct {
+	// Apply the pending migrations when the server starts, rather than with
+	// "server migrate"
+	OnStart bool          `yaml:"on_start"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type AdminBootstrap struct {
+	// Nothing is created when empty
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	// The password or the file holding it
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+// Every problem found loading a config, reported together
+type Errors []string
+
+func (e Errors) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// What secrets are replaced with when printing
+const redacted = "REDACTED"
+
+const (
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvProduction  = "production"
+
+	StoreMemory = "memory"
+	StoreMongo  = "mongo"
+)
+
+// Config used when nothing is set
+func Default() Config {
+	return Config{
+		Env: EnvDevelopment,
+		HTTP: HTTP{
+			Port:            "8080",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: Database{
+			ConnectTimeout: 10 * time.Second,
+		},
+		Auth: auth.Config{
+			Algorithm:        auth.AlgorithmHS256,
+			VerificationKeys: map[string]string{},
+		},
+		App: App{
+			AccessTokenTTL:       15 * time.Minute,
+			RefreshTokenTTL:      30 * 24 * time.Hour,
+			EmailVerificationTTL: 24 * time.Hour,
+			PasswordResetTTL:     time.Hour,
+			InviteTTL:            7 * 24 * time.Hour,
+			ReservationTTL:       15 * time.Minute,
+			TOTPIssuer:           "PFA SaaS Ecommerce",
+		},
+		Logging: logging.Config{
+			Level:  "info",
+			Output: "stdout",
+		},
+		Tracing: tracing.Config{
+			Exporter:    tracing.ExporterNone,
+			File:        "traces.json",
+			SampleRatio: 1,
+		},
+		Mail: mailer.Config{
+			Mailer:   mailer.MailerLog,
+			Dir:      "mail",
+			SMTPPort: "587",
+		},
+		Payments: Payments{
+			Fake: FakePayments{
+				Delay: 5 * time.Second,
+			},
+		},
+		Lockout: Lockout{
+			Store:       StoreMongo,
+			Duration:    15 * time.Minute,
+			Threshold:   5,
+			IPThreshold: 50,
+		},
+		RateLimits: RateLimits{
+			Store:      StoreMemory,
+			Auth:       "5/1m",
+			API:        "600/1m",
+			Storefront: "1200/1m",
+		},
+		Migrations: Migrations{
+			OnStart: true,
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// A setting read from the environment and the command line
+type setting struct {
+	env string
+	// Empty for secrets, flags show up in the process list
+	flag  string
+	usage string
+	// Field of the config
+	field func(c *Config) interface{}
+}
+
+var settings = []setting{
+	{"APP_ENV", "env", "environment, development, test or production", func(c *Config) interface{} { return &c.Env }},
+	{"PORT", "port", "port of the API", func(c *Config) interface{} { return &c.HTTP.Port }},
+	{"METRICS_PORT", "metrics-port", "port of the metrics, the API port when empty", func(c *Config) interface{} { return &c.HTTP.MetricsPort }},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long requests get to finish on shutdown", func(c *Config) interface{} { return &c.HTTP.ShutdownTimeout }},
+	{"SHUTDOWN_DRAIN_DELAY", "drain-delay", "how long to keep serving while unready on shutdown", func(c *Config) interface{} { return &c.HTTP.DrainDelay }},
+	{"PROXY_HEADER", "proxy-header", "header the trusted proxies put the client IP in, like X-Real-IP", func(c *Config) interface{} { return &c.HTTP.ProxyHeader }},
+	{"TRUSTED_PROXIES", "trusted-proxies", "comma separated addresses or CIDR ranges of the proxies", func(c *Config) interface{} { return &c.HTTP.TrustedProxies }},
+	{"MONGO_URI", "", "", func(c *Config) interface{} { return &c.Database.URI }},
+	{"DB", "db", "name of the database", func(c *Config) interface{} { return &c.Database.Name }},
+	{"DB_CONNECT_TIMEOUT", "db-connect-timeout", "how long to wait for the database on start", func(c *Config) interface{} { return &c.Database.ConnectTimeout }},
+	{"JWT_ALGORITHM", "jwt-algorithm", "token signing algorithm, HS256, RS256 or EdDSA", func(c *Config) interface{} { return &c.Auth.Algorithm }},
+	{"JWT_SECRET", "", "", func(c *Config) interface{} { return &c.Auth.Secret }},
+	{"JWT_PRIVATE_KEY_FILE", "jwt-private-key-file", "PEM private key of RS256 and EdDSA", func(c *Config) interface{} { return &c.Auth.PrivateKeyFile }},
+	{"JWT_KEY_ID", "jwt-key-id", "kid of the signing key", func(c *Config) interface{} { return &c.Auth.KeyID }},
+	{"JWT_VERIFICATION_KEYS", "", "", func(c *Config) interface{} { return &c.Auth.VerificationKeys }},
+	{"JWT_ISSUER", "jwt-issuer", "iss claim of the tokens", func(c *Config) interface{} { return &c.Auth.Issuer }},
+	{"APP_URL", "app-url", "base URL of the links in the emails", func(c *Config) interface{} { return &c.App.URL }},
+	{"ACCESS_TOKEN_TTL", "access-token-ttl", "lifetime of the access tokens", func(c *Config) interface{} { return &c.App.AccessTokenTTL }},
+	{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "lifetime of the refresh tokens", func(c *Config) interface{} { return &c.App.RefreshTokenTTL }},
+	{"EMAIL_VERIFICATION_TTL", "email-verification-ttl", "how long the email verification links work", func(c *Config) interface{} { return &c.App.EmailVerificationTTL }},
+	{"PASSWORD_RESET_TTL", "password-reset-ttl", "how long the password reset links work", func(c *Config) interface{} { return &c.App.PasswordResetTTL }},
+	{"INVITE_TTL", "invite-ttl", "how long the store invites can be accepted", func(c *Config) interface{} { return &c.App.InviteTTL }},
+	{"RESERVATION_TTL", "reservation-ttl", "how long the stock of an unpaid order stays reserved", func(c *Config) interface{} { return &c.App.ReservationTTL }},
+	{"TOTP_ISSUER", "totp-issuer", "issuer shown by the authenticator apps", func(c *Config) interface{} { return &c.App.TOTPIssuer }},
+	{"PAYMENT_PROVIDER", "payment-provider", "provider of the new payments, none turns the payments off", func(c *Config) interface{} { return &c.App.PaymentProvider }},
+	{"LOG_LEVEL", "log-level", "debug, info, warn or error", func(c *Config) interface{} { return &c.Logging.Level }},
+	{"LOG_OUTPUT", "log-output", "stdout, stderr or a file to append the logs to", func(c *Config) interface{} { return &c.Logging.Output }},
+	{"TRACING_EXPORTER", "tracing-exporter", "none, stdout, file or otlp", func(c *Config) interface{} { return &c.Tracing.Exporter }},
+	{"TRACING_FILE", "tracing-file", "file the spans are appended to with the file exporter", func(c *Config) interface{} { return &c.Tracing.File }},
+	{"TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "share of the new traces sampled, from 0 to 1", func(c *Config) interface{} { return &c.Tracing.SampleRatio }},
+	{"MAILER", "mailer", "log, file or smtp", func(c *Config) interface{} { return &c.Mail.Mailer }},
+	{"MAILER_DIR", "mailer-dir", "directory the file mailer writes to", func(c *Config) interface{} { return &c.Mail.Dir }},
+	{"SMTP_HOST", "smtp-host", "host of the SMTP server", func(c *Config) interface{} { return &c.Mail.SMTPHost }},
+	{"SMTP_PORT", "smtp-port", "port of the SMTP server", func(c *Config) interface{} { return &c.Mail.SMTPPort }},
+	{"SMTP_USERNAME", "smtp-username", "username on the SMTP server", func(c *Config) interface{} { return &c.Mail.SMTPUsername }},
+	{"SMTP_PASSWORD", "", "", func(c *Config) interface{} { return &c.Mail.SMTPPassword }},
+	{"MAIL_FROM", "mail-from", "sender of the emails", func(c *Config) interface{} { return &c.Mail.From }},
+	{"FAKE_PAYMENTS_ENABLED", "fake-payments", "register the fake payment provider, outside production only", func(c *Config) interface{} { return &c.Payments.Fake.Enabled }},
+	{"FAKE_PAYMENTS_SECRET", "", "", func(c *Config) interface{} { return &c.Payments.Fake.Secret }},
+	{"FAKE_PAYMENTS_WEBHOOK_URL", "fake-payments-webhook-url", "where the fake provider sends its webhooks", func(c *Config) interface{} { return &c.Payments.Fake.WebhookURL }},
+	{"FAKE_PAYMENTS_DELAY", "fake-payments-delay", "how long until the fake provider pays", func(c *Config) interface{} { return &c.Payments.Fake.Delay }},
+	{"LOCKOUT_STORE", "lockout-store", "where the login failures are counted, mongo or memory", func(c *Config) interface{} { return &c.Lockout.Store }},
+	{"LOCKOUT_DURATION", "lockout-duration", "how long failures count and a lockout lasts", func(c *Config) interface{} { return &c.Lockout.Duration }},
+	{"LOCKOUT_THRESHOLD", "lockout-threshold", "failures locking an account", func(c *Config) interface{} { return &c.Lockout.Threshold }},
+	{"LOCKOUT_IP_THRESHOLD", "lockout-ip-threshold", "failures locking an IP", func(c *Config) interface{} { return &c.Lockout.IPThreshold }},
+	{"RATE_LIMIT_STORE", "rate-limit-store", "where the rate limits are counted, memory or mongo", func(c *Config) interface{} { return &c.RateLimits.Store }},
+	{"RATE_LIMIT_AUTH", "rate-limit-auth", "rate of the login routes per IP", func(c *Config) interface{} { return &c.RateLimits.Auth }},
+	{"RATE_LIMIT_API", "rate-limit-api", "rate of the API per account", func(c *Config) interface{} { return &c.RateLimits.API }},
+	{"RATE_LIMIT_STOREFRONT", "rate-limit-storefront", "rate of the storefront reads per store", func(c *Config) interface{} { return &c.RateLimits.Storefront }},
+	{"MIGRATE_ON_START", "migrate-on-start", "apply the pending migrations on start", func(c *Config) interface{} { return &c.Migrations.OnStart }},
+	{"MIGRATE_TIMEOUT", "migrate-timeout", "how long the migrations get", func(c *Config) interface{} { return &c.Migrations.Timeout }},
+	{"ADMIN_BOOTSTRAP_USERNAME", "admin-bootstrap-username", "username of the admin created when there is none", func(c *Config) interface{} { return &c.AdminBootstrap.Username }},
+	{"ADMIN_BOOTSTRAP_EMAIL", "admin-bootstrap-email", "email of the admin created when there is none", func(c *Config) interface{} { return &c.AdminBootstrap.Email }},
+	{"ADMIN_BOOTSTRAP_PASSWORD", "", "", func(c *Config) interface{} { return &c.AdminBootstrap.Password }},
+	{"ADMIN_BOOTSTRAP_PASSWORD_FILE", "admin-bootstrap-password-file", "file holding the password of the admin created when there is none", func(c *Config) interface{} { return &c.AdminBootstrap.PasswordFile }},
+}
+
+// Loads and validates the config, args being the command line without the
+// program name. Returns the arguments left after the flags, flag.ErrHelp when
+// asked for the usage.
+func Load(args []string) (Config, []string, error) {
+	var problems Errors
+	config := Default()
+
+	// Flags are applied last but name the config file
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	flags := map[string]string{}
+	for _, s := range settings {
+		if s.flag != "" {
+			name := s.flag
+			fs.Func(name, s.usage, func(value string) error {
+				flags[name] = value
+				return nil
+			})
+		}
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return config, nil, err
+	} else if err != nil {
+		return config, nil, Errors{err.Error()}
+	}
+
+	if *file != "" {
+		if err := loadFile(&config, *file); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// .env only adds what the environment doesn't have
+	if os.Getenv("APP_ENV") != "production" && !config.Production() {
+		if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			problems = append(problems, fmt.Sprintf(".env: %s", err))
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := set(s.field(&config), value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", s.env, err))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flags[s.flag]; ok && s.flag != "" {
+			if err := set(s.field(&config), value); err != nil {
+				problems = append(problems, fmt.Sprintf("-%s: %s", s.flag, err))
+			}
+		}
+	}
+
+	problems = append(problems, config.validate()...)
+	if len(problems) > 0 {
+		return config, nil, problems
+	}
+	return config, fs.Args(), nil
+}
+
+// Prints the flags with their environment variables
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "  -config file\n    \tYAML config file (CONFIG_FILE)")
+	for _, s := range settings {
+		if s.flag != "" {
+			fmt.Fprintf(w, "  -%s\n    \t%s (%s)\n", s.flag, s.usage, s.env)
+		}
+	}
+}
+
+// Sets the config from the YAML file, unknown keys are errors
+func loadFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Sets the field from its text
+func set(field interface{}, value string) error {
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", value)
+		}
+		*field = n
+	case *float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", value)
+		}
+		*field = f
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't a boolean", value)
+		}
+		*field = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't a duration", value)
+		}
+		*field = d
+	case *[]string:
+		// Comma separated
+		list := []string{}
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+		*field = list
+	case *map[string]string:
+		// Comma separated key=value pairs
+		m := map[string]string{}
+		for _, entry := range strings.Split(value, ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			key, v, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || key == "" || v == "" {
+				return fmt.Errorf("%q isn't a key=value pair", entry)
+			}
+			m[key] = v
+		}
+		*field = m
+	default:
+		panic(fmt.Sprintf("config: no parser for %T", field))
+	}
+	return nil
+}
+
+// Every problem of the settings
+func (c Config) validate() Errors {
+	var problems Errors
+
+	switch c.Env {
+	case EnvDevelopment, EnvTest, EnvProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("env %q must be development, test or production (APP_ENV)", c.Env))
+	}
+
+	if err := validatePort(c.HTTP.Port); err != nil {
+		problems = append(problems, "http.port "+err.Error())
+	}
+	if c.HTTP.MetricsPort != "" {
+		if err := validatePort(c.HTTP.MetricsPort); err != nil {
+			problems = append(problems, "http.metrics_port "+err.Error())
+		} else if c.HTTP.MetricsPort == c.HTTP.Port {
+			problems = append(problems, "http.metrics_port must differ from http.port")
+		}
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		problems = append(problems, "http.shutdown_timeout must be positive")
+	}
+	if c.HTTP.DrainDelay < 0 {
+		problems = append(problems, "http.drain_delay can't be negative")
+	}
+	if c.HTTP.ProxyHeader != "" && len(c.HTTP.TrustedProxies) == 0 {
+		problems = append(problems, "http.trusted_proxies must be set with http.proxy_header, or anyone could choose their IP (TRUSTED_PROXIES)")
+	}
+	if c.HTTP.ProxyHeader == "" && len(c.HTTP.TrustedProxies) > 0 {
+		problems = append(problems, "http.proxy_header must be set with http.trusted_proxies (PROXY_HEADER)")
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("http.trusted_proxies %q must be an IP address or a CIDR range", proxy))
+		}
+	}
+
+	if c.Database.URI == "" {
+		problems = append(problems, "database.uri must be set (MONGO_URI)")
+	} else if !strings.HasPrefix(c.Database.URI, "mongodb://") && !strings.HasPrefix(c.Database.URI, "mongodb+srv://") {
+		problems = append(problems, "database.uri must be a mongodb:// or mongodb+srv:// URI")
+	}
+	if c.Database.Name == "" {
+		problems = append(problems, "database.name must be set (DB)")
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		problems = append(problems, "database.connect_timeout must be positive")
+	}
+
+	switch c.Auth.Algorithm {
+	case auth.AlgorithmHS256:
+		if c.Auth.Secret == "" {
+			problems = append(problems, "auth.secret must be set with HS256 (JWT_SECRET)")
+		}
+	case auth.AlgorithmRS256, auth.AlgorithmEdDSA:
+		if c.Auth.PrivateKeyFile == "" {
+			problems = append(problems, fmt.Sprintf("auth.private_key_file must be set with %s (JWT_PRIVATE_KEY_FILE)", c.Auth.Algorithm))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("auth.algorithm %q must be HS256, RS256 or EdDSA", c.Auth.Algorithm))
+	}
+
+	problems = append(problems, c.validateApp()...)
+	problems = append(problems, c.validateLogging()...)
+	problems = append(problems, c.validateTracing()...)
+	problems = append(problems, c.validateMail()...)
+	problems = append(problems, c.validatePayments()...)
+	problems = append(problems, c.validateLockout()...)
+	problems = append(problems, c.validateRateLimits()...)
+
+	if c.Migrations.Timeout <= 0 {
+		problems = append(problems, "migrations.timeout must be positive")
+	}
+
+	bootstrap := c.AdminBootstrap
+	if bootstrap.Username == "" {
+		if bootstrap.Email != "" || bootstrap.Password != "" || bootstrap.PasswordFile != "" {
+			problems = append(problems, "admin_bootstrap.username must be set with the other admin_bootstrap settings (ADMIN_BOOTSTRAP_USERNAME)")
+		}
+	} else {
+		if bootstrap.Email == "" {
+			problems = append(problems, "admin_bootstrap.email must be set (ADMIN_BOOTSTRAP_EMAIL)")
+		}
+		if (bootstrap.Password == "") == (bootstrap.PasswordFile == "") {
+			problems = append(problems, "one of admin_bootstrap.password and admin_bootstrap.password_file must be set (ADMIN_BOOTSTRAP_PASSWORD, ADMIN_BOOTSTRAP_PASSWORD_FILE)")
+		}
+	}
+
+	return problems
+}
+
+func (c Config) validateApp() Errors {
+	app := c.App
+	var problems Errors
+
+	if app.URL != "" {
+		if parsed, err := url.Parse(app.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("app.url %q must be an http or https URL", app.URL))
+		}
+	}
+
+	ttls := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"app.access_token_ttl", app.AccessTokenTTL},
+		{"app.refresh_token_ttl", app.RefreshTokenTTL},
+		{"app.email_verification_ttl", app.EmailVerificationTTL},
+		{"app.password_reset_ttl", app.PasswordResetTTL},
+		{"app.invite_ttl", app.InviteTTL},
+		{"app.reservation_ttl", app.ReservationTTL},
+	}
+	for _, ttl := range ttls {
+		if ttl.value <= 0 {
+			problems = append(problems, ttl.name+" must be positive")
+		}
+	}
+	if app.RefreshTokenTTL > 0 && app.RefreshTokenTTL < app.AccessTokenTTL {
+		problems = append(problems, "app.refresh_token_ttl can't be shorter than app.access_token_ttl")
+	}
+
+	if app.TOTPIssuer == "" {
+		problems = append(problems, "app.totp_issuer must be set")
+	}
+	return problems
+}
+
+func (c Config) validateLogging() Errors {
+	var problems Errors
+
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("logging.level %q must be debug, info, warn or error", c.Logging.Level))
+	}
+	if c.Logging.Output == "" {
+		problems = append(problems, "logging.output must be set")
+	}
+	return problems
+}
+
+func (c Config) validateTracing() Errors {
+	var problems Errors
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	case tracing.ExporterFile:
+		if c.Tracing.File == "" {
+			problems = append(problems, "tracing.file must be set with the file exporter")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q must be none, stdout, file or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+	return problems
+}
+
+func (c Config) validateMail() Errors {
+	var problems Errors
+
+	switch c.Mail.Mailer {
+	case mailer.MailerLog:
+	case mailer.MailerFile:
+		if c.Mail.Dir == "" {
+			problems = append(problems, "mail.dir must be set with the file mailer")
+		}
+	case mailer.MailerSMTP:
+		if c.Mail.SMTPHost == "" {
+			problems = append(problems, "mail.smtp_host must be set with the smtp mailer")
+		}
+		if err := validatePort(c.Mail.SMTPPort); err != nil {
+			problems = append(problems, "mail.smtp_port "+err.Error())
+		}
+		if c.Mail.From == "" {
+			problems = append(problems, "mail.from must be set with the smtp mailer")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mail.mailer %q must be log, file or smtp", c.Mail.Mailer))
+	}
+	return problems
+}
+
+func (c Config) validatePayments() Errors {
+	var problems Errors
+
+	fake := c.Payments.Fake
+	switch c.App.PaymentProvider {
+	case "":
+		// Payments off
+	case payments.FakeProviderName:
+		if !fake.Enabled {
+			problems = append(problems, "app.payment_provider is fake but payments.fake.enabled isn't set (FAKE_PAYMENTS_ENABLED)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("app.payment_provider %q isn't a known provider", c.App.PaymentProvider))
+	}
+
+	if !fake.Enabled {
+		return problems
+	}
+	if c.Production() {
+		problems = append(problems, "payments.fake.enabled can't be set in production, the fake provider pays without charging")
+	}
+	if fake.Secret == "" {
+		problems = append(problems, "payments.fake.secret must be set with the fake provider (FAKE_PAYMENTS_SECRET)")
+	}
+	if fake.WebhookURL != "" {
+		if parsed, err := url.Parse(fake.WebhookURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("payments.fake.webhook_url %q must be an absolute URL", fake.WebhookURL))
+		}
+	}
+	if fake.Delay < 0 {
+		problems = append(problems, "payments.fake.delay can't be negative")
+	}
+	return problems
+}
+
+func (c Config) validateLockout() Errors {
+	var problems Errors
+
+	if c.Lockout.Store != StoreMongo && c.Lockout.Store != StoreMemory {
+		problems = append(problems, fmt.Sprintf("lockout.store %q must be mongo or memory", c.Lockout.Store))
+	}
+	if c.Lockout.Duration <= 0 {
+		problems = append(problems, "lockout.duration must be positive")
+	}
+	if c.Lockout.Threshold <= 0 {
+		problems = append(problems, "lockout.threshold must be positive")
+	}
+	if c.Lockout.IPThreshold <= 0 {
+		problems = append(problems, "lockout.ip_threshold must be positive")
+	}
+	return problems
+}
+
+func (c Config) validateRateLimits() Errors {
+	var problems Errors
+
+	if c.RateLimits.Store != StoreMemory && c.RateLimits.Store != StoreMongo {
+		problems = append(problems, fmt.Sprintf("rate_limits.store %q must be memory or mongo", c.RateLimits.Store))
+	}
+	rates := []struct {
+		name  string
+		value string
+	}{
+		{"rate_limits.auth", c.RateLimits.Auth},
+		{"rate_limits.api", c.RateLimits.API},
+		{"rate_limits.storefront", c.RateLimits.Storefront},
+	}
+	for _, rate := range rates {
+		if _, _, err := ParseRate(rate.value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", rate.name, err))
+		}
+	}
+	return problems
+}
+
+// Reads a "<limit>/<period>" rate like 5/1m
+func ParseRate(rate string) (int, time.Duration, error) {
+	limit, period, ok := strings.Cut(rate, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate limit: %q is not <limit>/<period>", rate)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("rate limit: bad limit in %q", rate)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("rate limit: bad period in %q", rate)
+	}
+
+	return n, d, nil
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q must be a port number", port)
+	}
+	return nil
+}
+
+// Whether the server runs in production
+func (c Config) Production() bool {
+	return c.Env == "production"
+}
+
+// Copy of the config with the secrets replaced, to print it
+func (c Config) Redacted() Config {
+	if c.Database.URI != "" {
+		c.Database.URI = redactURI(c.Database.URI)
+	}
+	if c.Auth.Secret != "" {
+		c.Auth.Secret = redacted
+	}
+	if c.AdminBootstrap.Password != "" {
+		c.AdminBootstrap.Password = redacted
+	}
+	if c.Mail.SMTPPassword != "" {
+		c.Mail.SMTPPassword = redacted
+	}
+	if c.Payments.Fake.Secret != "" {
+		c.Payments.Fake.Secret = redacted
+	}
+
+	// HS256 verification keys are secrets, the others file paths
+	if c.Auth.Algorithm == auth.AlgorithmHS256 {
+		keys := map[string]string{}
+		for kid := range c.Auth.VerificationKeys {
+			keys[kid] = redacted
+		}
+		c.Auth.VerificationKeys = keys
+	}
+	return c
+}
+
+// The URI without its password, all of it if it can't be parsed
+func redactURI(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+	}
+	return parsed.String()
+}
+
+// YAML of the config, secrets redacted
+func (c Config) String() string {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (c Config) GoString() string {
+	return c.String()
+}
+
+// JSON of the config, secrets redacted, so logging it is safe
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(plain(c.Redacted()))
+}
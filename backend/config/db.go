@@ -2,12 +2,10 @@ package config
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
-	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/metrics"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/tracing"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -20,36 +18,52 @@ type MongoInstance struct {
 
 var MI MongoInstance
 
-func ConnectDB() {
-	if os.Getenv("APP_ENV") != "production" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Fatal("Error loading .env file")
-		}
-	}
-
-	client, err := mongo.NewClient(options.Client().ApplyURI(os.Getenv("MONGO_URI")))
+// Connects to the database of the config and checks it answers
+func ConnectDB(config Database) error {
+	monitor := combineMonitors(metrics.MongoMonitor(), tracing.MongoMonitor())
+	clientOptions := options.Client().ApplyURI(config.URI).SetMonitor(monitor)
+	client, err := mongo.NewClient(clientOptions)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), config.ConnectTimeout)
 	defer cancel()
 
 	err = client.Connect(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	err = client.Ping(ctx, readpref.Primary())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	fmt.Println("Database connected")
-
 	MI = MongoInstance{
 		Client: client,
-		DB:     client.Database(os.Getenv("DB")),
+		DB:     client.Database(config.Name),
+	}
+	return nil
+}
+
+// A client takes a single monitor, this one calls all of them
+func combineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				monitor.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				monitor.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				monitor.Failed(ctx, e)
+			}
+		},
 	}
 }
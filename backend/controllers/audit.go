@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit log entries, newest first. Filtered by actor, target and a time range,
+// paginated with the "cursor" returned as next_cursor.
+func (h *Handler) GetAuditLog(c *fiber.Ctx) error {
+	filter := repository.AuditFilter{}
+
+	// Filters
+	if actor := c.Query("actor"); actor != "" {
+		actorId, err := primitive.ObjectIDFromHex(actor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid actor",
+			})
+		}
+		filter.Actor = actorId
+	}
+	filter.ActorType = c.Query("actor_type")
+	filter.Action = c.Query("action")
+	filter.Target = c.Query("target")
+	filter.TargetType = c.Query("target_type")
+	filter.RequestID = c.Query("request_id")
+
+	for query, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(query); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "The " + query + " date must be RFC 3339",
+				})
+			}
+			*bound = t
+		}
+	}
+
+	// Pagination, ids grow with time so the last id is the cursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		lastId, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid cursor",
+			})
+		}
+		filter.Before = lastId
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	entries, err := h.repos.Audit.List(ctx, filter, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to read the audit log",
+			"error":   err,
+		})
+	}
+
+	// More entries may follow a full page
+	var nextCursor interface{}
+	if len(entries) == limit {
+		nextCursor = entries[len(entries)-1].ID.Hex()
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success":     true,
+		"data":        entries,
+		"next_cursor": nextCursor,
+		"limit":       limit,
+	})
+}
@@ -2,59 +2,25 @@ package controllers
 
 import (
 	"context"
-	"log"
-	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/auth"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/lockout"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func getUserByUsername(username string) (*models.User, error) {
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var user models.User
-
-	findResult := usersCollection.FindOne(ctx, bson.M{"username": username})
-	err := findResult.Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, err
-}
-
-func getAdminByUsername(username string) (*models.Admin, error) {
-	adminsCollection := config.MI.DB.Collection("admins")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var admin models.Admin
-
-	findResult := adminsCollection.FindOne(ctx, bson.M{"username": username})
-	err := findResult.Decode(&admin)
-	if err != nil {
-		return nil, err
-	}
-
-	return &admin, err
-}
-
-func Login(c *fiber.Ctx) error {
+func (h *Handler) Login(c *fiber.Ctx) error {
 	type LoginInput struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
 
 	var input LoginInput
-	var user *models.User
-
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
@@ -65,9 +31,19 @@ func Login(c *fiber.Ctx) error {
 	username := input.Username
 	pass := input.Password
 
+	// Too many failed attempts
+	account := lockout.AccountKey(models.ActorTypeUser, username)
+	if wait := h.lockoutWait(c, account); wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
 	// Check user exists
-	user, err := getUserByUsername(username)
+	user, err := h.repos.Users.FindByUsername(ctx, username)
 	if err != nil {
+		h.recordLoginFailure(c, models.ActorTypeUser, username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"message": "Invalid username or password",
@@ -76,41 +52,52 @@ func Login(c *fiber.Ctx) error {
 
 	// Validate password correct
 	if !utils.CheckPasswordHash(pass, user.Password) {
+		h.recordLoginFailure(c, models.ActorTypeUser, username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"message": "Invalid username or password",
 		})
 	}
 
-	// Sign and send token
-	token := jwt.New(jwt.SigningMethodHS256)
+	// Second step
+	if user.TOTPEnabled {
+		return h.twoFactorChallenge(c, models.ActorTypeUser, user.ID)
+	}
+
+	return h.completeLogin(c, models.ActorTypeUser, user.ID, user.Username)
+}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["username"] = user.Username
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+// Signs the tokens of the authenticated account and sends them
+func (h *Handler) completeLogin(c *fiber.Ctx, subjectType string, subject primitive.ObjectID, username string) error {
+	// Merge the anonymous cart into the user's cart
+	if cartToken := c.Get(CartTokenHeader); cartToken != "" && subjectType == models.ActorTypeUser {
+		if err := h.mergeCarts(cartToken, subject); err != nil {
+			logging.Ctx(c).Error("merging the carts", "error", err)
+		}
+	}
 
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	h.recordLoginSuccess(c, subjectType, username)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Sign and send tokens
+	session, err := h.issueSession(ctx, subjectType, subject, username, primitive.NilObjectID)
 	if err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Success login",
-		"data":    signedToken,
-	})
+	return c.JSON(session)
 }
 
-func Register(c *fiber.Ctx) error {
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+func (h *Handler) Register(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*10)
 	defer cancel()
 	user := new(models.User)
 
 	// Bad request
 	if err := c.BodyParser(user); err != nil {
-		log.Println(err)
+		logging.Ctx(c).Debug("parsing the request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"sucess":  false,
 			"message": "Failed to parse the request body",
@@ -137,18 +124,26 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 	user.Password = hashed
+	user.EmailVerified = false
+	user.EmailVerifiedAt = time.Time{}
+	user.TwoFactor = models.TwoFactor{}
 
 	// Check user exists
-	exists, _ := getUserByUsername(user.Username)
-	if exists != nil {
+	if _, err := h.repos.Users.FindByUsername(ctx, user.Username); err == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"message": "Username already in use",
 		})
 	}
 
-	// Attempt insert
-	result, err := usersCollection.InsertOne(ctx, user)
+	// Attempt insert, the unique indexes catch concurrent registrations
+	err = h.repos.Users.Create(ctx, user)
+	if err == repository.ErrConflict {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Username or email already in use",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -157,23 +152,26 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// Confirm the email address
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		logging.Ctx(c).Error("sending the verification email", "error", err)
+	}
+
 	// Success
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
-		"data":    result,
+		"data":    fiber.Map{"InsertedID": user.ID},
 		"message": "User created successfully",
 	})
 }
 
-func LoginAdmin(c *fiber.Ctx) error {
+func (h *Handler) LoginAdmin(c *fiber.Ctx) error {
 	type LoginInput struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
 
 	var input LoginInput
-	var admin *models.Admin
-
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
@@ -184,9 +182,19 @@ func LoginAdmin(c *fiber.Ctx) error {
 	username := input.Username
 	pass := input.Password
 
+	// Too many failed attempts
+	account := lockout.AccountKey(models.ActorTypeAdmin, username)
+	if wait := h.lockoutWait(c, account); wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
 	// Check admin exists
-	admin, err := getAdminByUsername(username)
+	admin, err := h.repos.Admins.FindByUsername(ctx, username)
 	if err != nil {
+		h.recordLoginFailure(c, models.ActorTypeAdmin, username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"message": "Invalid username or password",
@@ -195,28 +203,29 @@ func LoginAdmin(c *fiber.Ctx) error {
 
 	// Validate password correct
 	if !utils.CheckPasswordHash(pass, admin.Password) {
+		h.recordLoginFailure(c, models.ActorTypeAdmin, username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"message": "Invalid username or password",
 		})
 	}
 
-	// Sign and send token
-	token := jwt.New(jwt.SigningMethodHS256)
+	// Second step
+	if admin.TOTPEnabled {
+		return h.twoFactorChallenge(c, models.ActorTypeAdmin, admin.ID)
+	}
+	if h.requireAdminTwoFactor(ctx) {
+		return h.twoFactorEnrollmentRequired(c, admin.ID)
+	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["admin_id"] = admin.ID
-	claims["username"] = admin.Username
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	return h.completeLogin(c, models.ActorTypeAdmin, admin.ID, admin.Username)
+}
 
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		return c.SendStatus(fiber.StatusInternalServerError)
+// Public keys verifying the access tokens
+func (h *Handler) GetJWKS(c *fiber.Ctx) error {
+	if h.keys == nil {
+		return c.JSON(auth.JWKS{Keys: []auth.JWK{}})
 	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Success login",
-		"data":    signedToken,
-	})
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.keys.JWKS())
 }
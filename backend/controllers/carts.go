@@ -0,0 +1,497 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Header used by anonymous shoppers to identify their cart
+const CartTokenHeader = "X-Cart-Token"
+
+// Returns the owner of the shopper's cart in the store: the logged in user if
+// there is a valid token, the cart token header otherwise
+func cartOwner(c *fiber.Ctx, storeId primitive.ObjectID) (repository.CartOwner, bool) {
+	if token, ok := c.Locals("user").(*jwt.Token); ok {
+		claims := token.Claims.(jwt.MapClaims)
+		if tokenUserId, ok := claims["user_id"].(string); ok {
+			userId, err := primitive.ObjectIDFromHex(tokenUserId)
+			if err == nil {
+				return repository.CartOwner{Store: storeId, User: userId}, true
+			}
+		}
+	}
+
+	if cartToken := c.Get(CartTokenHeader); cartToken != "" {
+		return repository.CartOwner{Store: storeId, Token: cartToken}, true
+	}
+
+	return repository.CartOwner{}, false
+}
+
+// Finds the owner's cart or starts an empty one
+func (h *Handler) findCart(ctx context.Context, owner repository.CartOwner) *models.Cart {
+	cart, err := h.repos.Carts.Find(ctx, owner)
+	if err != nil {
+		cart = &models.Cart{Store: owner.Store, User: owner.User}
+		if owner.User.IsZero() {
+			cart.Token = owner.Token
+		}
+	}
+	if cart.Items == nil {
+		cart.Items = []models.CartItem{}
+	}
+
+	return cart
+}
+
+// Refreshes the items from the current products, dropping the ones that are
+// no longer sold, and recomputes the totals
+func (h *Handler) recomputeCart(ctx context.Context, cart *models.Cart) error {
+	ids := []primitive.ObjectID{}
+	for _, item := range cart.Items {
+		ids = append(ids, item.Product)
+	}
+
+	found, err := h.repos.Products.FindMany(ctx, cart.Store, ids)
+	if err != nil {
+		return err
+	}
+
+	products := map[primitive.ObjectID]models.Product{}
+	for _, product := range found {
+		if product.Status == models.ProductStatusActive {
+			products[product.ID] = product
+		}
+	}
+
+	items := []models.CartItem{}
+	var subtotal int64
+	for _, item := range cart.Items {
+		product, ok := products[item.Product]
+		if !ok || item.Quantity < 1 {
+			continue
+		}
+		item.Title = product.Title
+		item.SKU = product.SKU
+		item.Price = product.Price
+		item.Total = product.Price * item.Quantity
+		subtotal += item.Total
+		items = append(items, item)
+	}
+
+	cart.Items = items
+	cart.Subtotal = subtotal
+	return nil
+}
+
+// Inserts or replaces the cart
+func (h *Handler) saveCart(ctx context.Context, cart *models.Cart) error {
+	cart.UpdatedAt = time.Now()
+	return h.repos.Carts.Save(ctx, cart)
+}
+
+// Moves the items of the anonymous carts with the token into the user's carts
+func (h *Handler) mergeCarts(cartToken string, userId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	anonymousCarts, err := h.repos.Carts.ListAnonymous(ctx, cartToken)
+	if err != nil {
+		return err
+	}
+
+	for _, anonymous := range anonymousCarts {
+		cart := h.findCart(ctx, repository.CartOwner{Store: anonymous.Store, User: userId})
+		for _, item := range anonymous.Items {
+			cart.Items = addCartItem(cart.Items, item.Product, item.Quantity)
+		}
+
+		if err := h.recomputeCart(ctx, cart); err != nil {
+			return err
+		}
+		if err := h.saveCart(ctx, cart); err != nil {
+			return err
+		}
+		if err := h.repos.Carts.Delete(ctx, anonymous.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Adds the quantity to the product's line or appends a new line
+func addCartItem(items []models.CartItem, productId primitive.ObjectID, quantity int64) []models.CartItem {
+	for i := range items {
+		if items[i].Product == productId {
+			items[i].Quantity += quantity
+			return items
+		}
+	}
+
+	return append(items, models.CartItem{Product: productId, Quantity: quantity})
+}
+
+func (h *Handler) GetCart(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// No cart yet
+	owner, ok := cartOwner(c, storeId)
+	if !ok {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"success": true,
+			"data":    models.Cart{Store: storeId, Items: []models.CartItem{}},
+		})
+	}
+
+	cart := h.findCart(ctx, owner)
+	if err := h.recomputeCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to load the cart",
+			"error":   err,
+		})
+	}
+	if !cart.ID.IsZero() {
+		h.saveCart(ctx, cart)
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+func (h *Handler) AddToCart(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	type AddInput struct {
+		Product  string `json:"product" validate:"required"`
+		Quantity int64  `json:"quantity" validate:"gte=1"`
+	}
+
+	input := new(AddInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	productId, err := primitive.ObjectIDFromHex(input.Product)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Product must be sold by the store
+	product, err := h.repos.Products.Find(ctx, storeId, productId)
+	if err == nil && product.Status != models.ProductStatusActive {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	// Anonymous shopper without a cart gets a new token
+	owner, ok := cartOwner(c, storeId)
+	if !ok {
+		cartToken, err := utils.RandomToken(32)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to create the cart",
+				"error":   err,
+			})
+		}
+		owner = repository.CartOwner{Store: storeId, Token: cartToken}
+	}
+
+	cart := h.findCart(ctx, owner)
+	cart.Items = addCartItem(cart.Items, productId, input.Quantity)
+
+	// Check stock
+	for _, item := range cart.Items {
+		if item.Product == productId && item.Quantity > product.Stock {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "Not enough stock",
+			})
+		}
+	}
+
+	if err := h.recomputeCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the cart",
+			"error":   err,
+		})
+	}
+	if err := h.saveCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the cart",
+			"error":   err,
+		})
+	}
+
+	if cart.Token != "" {
+		c.Set(CartTokenHeader, cart.Token)
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+		"message": "Item added to the cart",
+	})
+}
+
+func (h *Handler) UpdateCartItem(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	type UpdateInput struct {
+		Quantity int64 `json:"quantity" validate:"gte=0"`
+	}
+
+	input := new(UpdateInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	owner, ok := cartOwner(c, storeId)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Cart not found",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cart := h.findCart(ctx, owner)
+
+	// Not found
+	found := false
+	for i := range cart.Items {
+		if cart.Items[i].Product == productId {
+			cart.Items[i].Quantity = input.Quantity
+			found = true
+		}
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Item not found",
+		})
+	}
+
+	// Check stock
+	if input.Quantity > 0 {
+		product, err := h.repos.Products.Find(ctx, storeId, productId)
+		if err != nil || input.Quantity > product.Stock {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "Not enough stock",
+			})
+		}
+	}
+
+	if err := h.recomputeCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the cart",
+			"error":   err,
+		})
+	}
+	if err := h.saveCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the cart",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+		"message": "Cart updated successfully",
+	})
+}
+
+func (h *Handler) RemoveCartItem(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	owner, ok := cartOwner(c, storeId)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Cart not found",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cart := h.findCart(ctx, owner)
+
+	items := []models.CartItem{}
+	for _, item := range cart.Items {
+		if item.Product != productId {
+			items = append(items, item)
+		}
+	}
+	cart.Items = items
+
+	if err := h.recomputeCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the cart",
+			"error":   err,
+		})
+	}
+	if !cart.ID.IsZero() {
+		if err := h.saveCart(ctx, cart); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to update the cart",
+				"error":   err,
+			})
+		}
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+		"message": "Item removed from the cart",
+	})
+}
+
+func (h *Handler) ClearCart(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	owner, ok := cartOwner(c, storeId)
+	if ok {
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		if err := h.repos.Carts.DeleteByOwner(ctx, owner); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to clear the cart",
+				"error":   err,
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Cart cleared successfully",
+	})
+}
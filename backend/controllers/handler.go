@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/auth"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/lockout"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+)
+
+// Settings of the handlers, mapped from the config by main
+type Config struct {
+	// Base URL of the links in the emails
+	URL string
+	// Lifetime of the access tokens
+	AccessTokenTTL time.Duration
+	// Lifetime of the refresh tokens, the session ends if it isn't refreshed in time
+	RefreshTokenTTL time.Duration
+	// How long the verification link works
+	EmailVerificationTTL time.Duration
+	// How long a reset link works
+	PasswordResetTTL time.Duration
+	// How long an invite can be accepted
+	InviteTTL time.Duration
+	// How long stock stays reserved for an unpaid order
+	ReservationTTL time.Duration
+	// Issuer shown by the authenticator apps
+	TOTPIssuer string
+	// Provider used for new payments, none turns the payments off
+	PaymentProvider string
+}
+
+// What the handlers use besides the repositories, built at startup
+type Services struct {
+	// Signs the access and single purpose tokens
+	Keys   *auth.KeySet
+	Mailer mailer.Mailer
+	// Slows down and blocks password guessing, off when nil
+	Lockout *lockout.Lockout
+	// Providers of the payments, by name
+	Payments *payments.Registry
+}
+
+// Handler serves the API routes from the repositories and services it is
+// built with
+type Handler struct {
+	repos    *repository.Repositories
+	auth     *middlewares.Auth
+	keys     *auth.KeySet
+	mailer   mailer.Mailer
+	lockout  *lockout.Lockout
+	payments *payments.Registry
+	config   Config
+
+	// Work still running after the responses were sent
+	pending sync.WaitGroup
+}
+
+func New(repos *repository.Repositories, auth *middlewares.Auth, services Services, config Config) *Handler {
+	return &Handler{
+		repos:    repos,
+		auth:     auth,
+		keys:     services.Keys,
+		mailer:   services.Mailer,
+		lockout:  services.Lockout,
+		payments: services.Payments,
+		config:   config,
+	}
+}
+
+// Runs f after the response, tracked so the shutdown can wait for it
+func (h *Handler) background(f func()) {
+	h.pending.Add(1)
+	go func() {
+		defer h.pending.Done()
+		f()
+	}()
+}
+
+// Waits for the background work of the handlers, like the reset emails still
+// to be sent
+func (h *Handler) Wait() {
+	h.pending.Wait()
+}
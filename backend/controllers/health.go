@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/health"
+)
+
+// The process is alive, nothing else is checked
+func Healthz(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"status":  "ok",
+	})
+}
+
+// Whether the process should get traffic, its dependencies are checked
+func Readyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	ready, results := health.Ready(ctx)
+
+	failing := []string{}
+	if health.Draining() {
+		failing = append(failing, "draining")
+	}
+	for _, result := range results {
+		if !result.Healthy {
+			failing = append(failing, result.Name)
+		}
+	}
+
+	if !ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"success": false,
+			"status":  "unavailable",
+			"failing": failing,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"status":  "ready",
+	})
+}
+
+// Version, uptime and the result of every check
+func GetStatus(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	ready, results := health.Ready(ctx)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"ready":          ready,
+			"draining":       health.Draining(),
+			"uptime_seconds": int64(health.Uptime().Seconds()),
+			"build":          health.BuildInfo(),
+			"dependencies":   results,
+		},
+	})
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrOutOfStock      = errors.New("not enough stock")
+	ErrProductNotFound = errors.New("product not found")
+)
+
+// Atomically applies the adjustment's delta to the product stock and records
+// it. The stock can never go below zero so concurrent purchases can never
+// oversell.
+func (h *Handler) adjustStock(ctx context.Context, adjustment *models.InventoryAdjustment) error {
+	product, err := h.repos.Products.AdjustStock(ctx, adjustment.Store, adjustment.Product, adjustment.Delta)
+	if err == repository.ErrNotFound {
+		return ErrProductNotFound
+	}
+	if err == repository.ErrConflict {
+		return ErrOutOfStock
+	}
+	if err != nil {
+		return err
+	}
+
+	adjustment.StockAfter = product.Stock
+	adjustment.CreatedAt = time.Now()
+	return h.repos.Inventory.Create(ctx, adjustment)
+}
+
+// Takes the order's items out of the stock until the order is paid, cancelled
+// or the reservation expires. Each item is recorded as soon as its stock is
+// taken, so whatever a failed rollback leaves is given back by the sweeper.
+func (h *Handler) reserveStock(ctx context.Context, order *models.Order, actorType string, actor primitive.ObjectID) error {
+	expiresAt := time.Now().Add(h.config.ReservationTTL)
+
+	for _, item := range order.Items {
+		err := h.adjustStock(ctx, &models.InventoryAdjustment{
+			Store:     order.Store,
+			Product:   item.Product,
+			Delta:     -item.Quantity,
+			Reason:    models.InventoryReasonReservation,
+			Order:     order.ID,
+			ActorType: actorType,
+			Actor:     actor,
+		})
+		if err != nil {
+			h.undoReservations(ctx, order.ID)
+			return err
+		}
+
+		err = h.repos.Reservations.CreateMany(ctx, []models.Reservation{{
+			Store:     order.Store,
+			Product:   item.Product,
+			Order:     order.ID,
+			Quantity:  item.Quantity,
+			Status:    models.ReservationStatusHeld,
+			ExpiresAt: expiresAt,
+			CreatedAt: time.Now(),
+		}})
+		if err != nil {
+			// Nothing records this item's stock, put it back right away
+			restockErr := h.adjustStock(ctx, &models.InventoryAdjustment{
+				Store:     order.Store,
+				Product:   item.Product,
+				Delta:     item.Quantity,
+				Reason:    models.InventoryReasonRelease,
+				Order:     order.ID,
+				ActorType: models.ActorTypeSystem,
+			})
+			if restockErr != nil {
+				logging.FromContext(ctx).Error("putting back the stock of a failed reservation", "order", order.ID, "product", item.Product, "quantity", item.Quantity, "error", restockErr)
+			}
+			h.undoReservations(ctx, order.ID)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Gives back the stock of the reservations made for an order that won't be
+// placed. A failure is left to the sweeper once they expire.
+func (h *Handler) undoReservations(ctx context.Context, orderId primitive.ObjectID) {
+	if err := h.releaseReservations(ctx, orderId); err != nil {
+		logging.FromContext(ctx).Error("releasing the reservations of a failed checkout", "order", orderId, "error", err)
+	}
+}
+
+// Keeps the reserved stock of a paid order for good
+func (h *Handler) commitReservations(ctx context.Context, orderId primitive.ObjectID) error {
+	return h.repos.Reservations.SetOrderStatus(ctx, orderId, models.ReservationStatusHeld, models.ReservationStatusCommitted)
+}
+
+// Puts the reserved stock of the order back on sale
+func (h *Handler) releaseReservations(ctx context.Context, orderId primitive.ObjectID) error {
+	reservations, err := h.repos.Reservations.ListByOrder(ctx, orderId, models.ReservationStatusHeld, models.ReservationStatusCommitted)
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		// Only the caller flipping the status gives the stock back
+		released, err := h.repos.Reservations.SetStatus(ctx, reservation.ID, reservation.Status, models.ReservationStatusReleased)
+		if err != nil {
+			return err
+		}
+		if !released {
+			continue
+		}
+
+		err = h.adjustStock(ctx, &models.InventoryAdjustment{
+			Store:     reservation.Store,
+			Product:   reservation.Product,
+			Delta:     reservation.Quantity,
+			Reason:    models.InventoryReasonRelease,
+			Order:     reservation.Order,
+			ActorType: models.ActorTypeSystem,
+		})
+		if err != nil && err != ErrProductNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Cancels the unpaid orders whose reservation expired, giving their stock back
+func (h *Handler) ReleaseExpiredReservations() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	orderIds, err := h.repos.Reservations.ExpiredOrders(ctx, time.Now())
+	if err != nil {
+		logging.Default.Error("listing the expired reservations", "error", err)
+		return
+	}
+
+	for _, orderId := range orderIds {
+		order, err := h.repos.Orders.FindByID(ctx, orderId)
+		if err != nil {
+			err = h.releaseReservations(ctx, orderId)
+		} else if order.Status == models.OrderStatusPending {
+			err = h.transitionOrder(ctx, order, models.OrderStatusCancelled, models.ActorTypeSystem, primitive.NilObjectID, "reservation expired")
+		} else if order.Status == models.OrderStatusCancelled {
+			err = h.releaseReservations(ctx, orderId)
+		} else {
+			err = h.commitReservations(ctx, orderId)
+		}
+
+		if err != nil {
+			logging.Default.Error("releasing the expired reservations", "order", orderId, "error", err)
+		}
+	}
+}
+
+// Adds or removes stock of a product as the store owner
+func (h *Handler) AdjustInventory(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	type AdjustmentInput struct {
+		Delta int64  `json:"delta" validate:"required"`
+		Note  string `json:"note"`
+	}
+
+	input := new(AdjustmentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	actorType, actor := tokenActor(c)
+	adjustment := &models.InventoryAdjustment{
+		Store:     storeId,
+		Product:   productId,
+		Delta:     input.Delta,
+		Reason:    models.InventoryReasonManual,
+		Note:      input.Note,
+		ActorType: actorType,
+		Actor:     actor,
+	}
+
+	audit.TargetFilter(c, "products", productId.Hex(), bson.M{"_id": productId, "store": storeId})
+
+	// Attempt adjustment
+	err = h.adjustStock(ctx, adjustment)
+	if err == ErrProductNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+		})
+	}
+	if err == ErrOutOfStock {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Stock cannot go below zero",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to adjust the stock",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    adjustment,
+		"message": "Stock adjusted successfully",
+	})
+}
+
+// History of the stock changes of a product
+func (h *Handler) GetInventoryAdjustments(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Pagination
+	page, window := paginate(c)
+
+	// Find adjustments, newest first
+	adjustments, total, err := h.repos.Inventory.List(ctx, storeId, productId, window)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Adjustments not found",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":      adjustments,
+		"total":     total,
+		"page":      page,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
+	})
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/lockout"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/metrics"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+)
+
+// How long the login attempt on the account has to wait, zero if it can go on
+func (h *Handler) lockoutWait(c *fiber.Ctx, account string) time.Duration {
+	if h.lockout == nil {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	wait, err := h.lockout.Check(ctx, account, lockout.IPKey(c.IP()))
+	if err != nil {
+		logging.Ctx(c).Error("checking the lockout", "error", err)
+		return 0
+	}
+	return wait
+}
+
+// Answer of the attempts made too soon, the same whether the account exists
+// or not
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"success": false,
+		"message": "Too many failed attempts, try again later",
+	})
+}
+
+// Counts a failed login attempt and audits the lockouts it causes
+func (h *Handler) recordLoginFailure(c *fiber.Ctx, accountType string, username string) {
+	metrics.Logins.WithLabelValues(accountType, "failure").Inc()
+
+	if h.lockout == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	account := lockout.AccountKey(accountType, username)
+	locked, err := h.lockout.Fail(ctx, account, lockout.IPKey(c.IP()))
+	if err != nil {
+		logging.Ctx(c).Error("counting the failed login", "error", err)
+		return
+	}
+
+	for _, key := range locked {
+		targetType := "account"
+		if key != account {
+			targetType = "ip"
+		}
+		audit.Record(ctx, h.repos.Audit, models.AuditEntry{
+			ActorType:  models.ActorTypeSystem,
+			Action:     audit.ActionLockout,
+			TargetType: targetType,
+			Target:     key,
+			IP:         c.IP(),
+			UserAgent:  c.Get(fiber.HeaderUserAgent),
+			RequestID:  audit.RequestID(c),
+		})
+	}
+}
+
+// Clears the failures of the account once it logged in
+func (h *Handler) recordLoginSuccess(c *fiber.Ctx, accountType string, username string) {
+	metrics.Logins.WithLabelValues(accountType, "success").Inc()
+
+	if h.lockout == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if err := h.lockout.Succeed(ctx, lockout.AccountKey(accountType, username)); err != nil {
+		logging.Ctx(c).Error("clearing the failed logins", "error", err)
+	}
+}
+
+// Key of the lockout named by the route params
+func lockoutKey(c *fiber.Ctx) (string, bool) {
+	if ip := c.Params("ip"); ip != "" {
+		return lockout.IPKey(ip), true
+	}
+
+	accountType := c.Params("accountType")
+	if accountType != models.ActorTypeUser && accountType != models.ActorTypeAdmin {
+		return "", false
+	}
+	return lockout.AccountKey(accountType, c.Params("username")), true
+}
+
+// Whether an account or IP is locked out
+func (h *Handler) GetLockout(c *fiber.Ctx) error {
+	key, ok := lockoutKey(c)
+	if !ok || h.lockout == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Lockout not found",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	locked, until, err := h.lockout.Locked(ctx, key)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to read the lockout",
+			"error":   err,
+		})
+	}
+
+	data := fiber.Map{"key": key, "locked": locked}
+	if locked {
+		data["locked_until"] = until
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":    data,
+		"success": true,
+	})
+}
+
+// Lifts the lockout of an account or IP
+func (h *Handler) Unlock(c *fiber.Ctx) error {
+	key, ok := lockoutKey(c)
+	if !ok || h.lockout == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Lockout not found",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if err := h.lockout.Unlock(ctx, key); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to unlock",
+			"error":   err,
+		})
+	}
+
+	targetType := "account"
+	if c.Params("ip") != "" {
+		targetType = "ip"
+	}
+	audit.Describe(c, audit.ActionUnlock, targetType, key)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Unlocked successfully",
+	})
+}
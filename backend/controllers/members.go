@@ -0,0 +1,515 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/rbac"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roles store owners can give to their staff
+var staffRoles = []string{rbac.RoleStoreManager, rbac.RoleStoreFulfillment, rbac.RoleStoreReadOnly}
+
+// Stores where the user's role grants the permission
+func (h *Handler) memberStoreIds(ctx context.Context, userId primitive.ObjectID, permission string) ([]primitive.ObjectID, error) {
+	storeIds := []primitive.ObjectID{}
+
+	members, err := h.repos.Members.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		if rbac.Can([]string{member.Role}, permission) {
+			storeIds = append(storeIds, member.Store)
+		}
+	}
+
+	return storeIds, nil
+}
+
+func (h *Handler) GetStoreMembers(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Pagination
+	page, window := paginate(c)
+
+	// Find members
+	members, total, err := h.repos.Members.List(ctx, storeId, window)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Members not found",
+			"error":   err,
+		})
+	}
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":      members,
+		"total":     total,
+		"page":      page,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
+	})
+}
+
+// Changes the role of a staff member
+func (h *Handler) UpdateStoreMember(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	userId, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+			"error":   err,
+		})
+	}
+
+	type MemberInput struct {
+		Role string `json:"role" validate:"required"`
+	}
+
+	input := new(MemberInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+	if !utils.StringContains(staffRoles, input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Role must be one of " + strings.Join(staffRoles, ", "),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.TargetFilter(c, "store_members", storeId.Hex()+"/"+userId.Hex(), bson.M{"store": storeId, "user": userId})
+
+	// The owner keeps their role
+	err = h.repos.Members.UpdateRole(ctx, storeId, userId, input.Role)
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the member",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Member updated successfully",
+	})
+}
+
+func (h *Handler) RemoveStoreMember(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	userId, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.TargetFilter(c, "store_members", storeId.Hex()+"/"+userId.Hex(), bson.M{"store": storeId, "user": userId})
+
+	// The owner can't be removed
+	err = h.repos.Members.Remove(ctx, storeId, userId)
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to remove the member",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Member removed successfully",
+	})
+}
+
+// Emails a single use invitation to join the store
+func (h *Handler) CreateStoreInvite(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	type InviteInput struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"required"`
+	}
+
+	input := new(InviteInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+	if !utils.StringContains(staffRoles, input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Role must be one of " + strings.Join(staffRoles, ", "),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Store must exist
+	store, err := h.repos.Stores.FindByID(ctx, storeId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to create the invite",
+			"error":   err,
+		})
+	}
+
+	_, actor := tokenActor(c)
+	invite := &models.StoreInvite{
+		Store:     storeId,
+		Email:     strings.ToLower(input.Email),
+		Role:      input.Role,
+		TokenHash: utils.HashToken(token),
+		Status:    models.InviteStatusPending,
+		InvitedBy: actor,
+		ExpiresAt: time.Now().Add(h.config.InviteTTL),
+		CreatedAt: time.Now(),
+	}
+
+	// Attempt insert
+	if err := h.repos.Invites.Create(ctx, invite); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to create the invite",
+			"error":   err,
+		})
+	}
+	audit.Created(c, "store_invites", invite.ID)
+
+	// Send the token
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      invite.Email,
+		Subject: "You are invited to join " + store.Name,
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\nAccept the invitation: %s/invites/accept?token=%s\n\nThe invitation expires on %s.",
+			store.Name, invite.Role, h.config.URL, token, invite.ExpiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		logging.Ctx(c).Error("sending the invite email", "error", err)
+	}
+
+	// Success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    invite,
+		"message": "Invite sent successfully",
+	})
+}
+
+// Pending invites of the store
+func (h *Handler) GetStoreInvites(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Pagination
+	page, window := paginate(c)
+
+	// Find invites
+	invites, total, err := h.repos.Invites.ListPending(ctx, storeId, time.Now(), window)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Invites not found",
+			"error":   err,
+		})
+	}
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":      invites,
+		"total":     total,
+		"page":      page,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
+	})
+}
+
+func (h *Handler) RevokeStoreInvite(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	inviteId, err := primitive.ObjectIDFromHex(c.Params("inviteId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Invite not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.TargetFilter(c, "store_invites", inviteId.Hex(), bson.M{"_id": inviteId, "store": storeId})
+
+	err = h.repos.Invites.Revoke(ctx, storeId, inviteId, time.Now())
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Invite not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to revoke the invite",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Invite revoked successfully",
+	})
+}
+
+// Marks the pending invite with the token as answered, only one caller can
+// ever succeed for a token
+func (h *Handler) answerInvite(ctx context.Context, token string, status string) (*models.StoreInvite, bool) {
+	invite, err := h.repos.Invites.Answer(ctx, utils.HashToken(token), status, time.Now())
+	if err != nil {
+		return nil, false
+	}
+
+	return invite, true
+}
+
+// Joins the store as the invited user
+func (h *Handler) AcceptInvite(c *fiber.Ctx) error {
+	actorType, userId := tokenActor(c)
+	if actorType != models.ActorTypeUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Only users can join a store",
+		})
+	}
+
+	type InviteAnswer struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	input := new(InviteAnswer)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.repos.Users.FindByID(ctx, userId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "User not found",
+			"error":   err,
+		})
+	}
+
+	// The invite must be for the user's email
+	found, err := h.repos.Invites.FindByToken(ctx, utils.HashToken(input.Token))
+	if err != nil || found.Email != strings.ToLower(user.Email) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired invite",
+		})
+	}
+
+	audit.TargetFilter(c, "store_invites", "", bson.M{"token_hash": utils.HashToken(input.Token)})
+
+	invite, ok := h.answerInvite(ctx, input.Token, models.InviteStatusAccepted)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired invite",
+		})
+	}
+
+	// Owners stay owners
+	if member, err := h.repos.Members.Find(ctx, invite.Store, userId); err == nil && member.Role == rbac.RoleStoreOwner {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Already the owner of the store",
+		})
+	}
+
+	if err := h.repos.Members.Add(ctx, invite.Store, userId, invite.Role, invite.InvitedBy); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to join the store",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    invite,
+		"message": "Invite accepted successfully",
+	})
+}
+
+func (h *Handler) DeclineInvite(c *fiber.Ctx) error {
+	type InviteAnswer struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	input := new(InviteAnswer)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.TargetFilter(c, "store_invites", "", bson.M{"token_hash": utils.HashToken(input.Token)})
+
+	if _, ok := h.answerInvite(ctx, input.Token, models.InviteStatusDeclined); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired invite",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Invite declined successfully",
+	})
+}
@@ -0,0 +1,422 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// Returns the actor making the request from the token claims
+func tokenActor(c *fiber.Ctx) (string, primitive.ObjectID) {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+
+	if tokenAdminId, ok := claims["admin_id"].(string); ok {
+		adminId, _ := primitive.ObjectIDFromHex(tokenAdminId)
+		return models.ActorTypeAdmin, adminId
+	}
+	if tokenUserId, ok := claims["user_id"].(string); ok {
+		userId, _ := primitive.ObjectIDFromHex(tokenUserId)
+		return models.ActorTypeUser, userId
+	}
+
+	return "", primitive.NilObjectID
+}
+
+// Moves the order to a new status and records the transition. The update only
+// applies if the order is still in the status it was read with.
+func (h *Handler) transitionOrder(ctx context.Context, order *models.Order, to string, actorType string, actor primitive.ObjectID, note string) error {
+	if !models.CanTransitionOrder(order.Status, to) {
+		return ErrInvalidTransition
+	}
+
+	now := time.Now()
+	transition := models.OrderTransition{
+		From:      order.Status,
+		To:        to,
+		At:        now,
+		ActorType: actorType,
+		Actor:     actor,
+		Note:      note,
+	}
+
+	err := h.repos.Orders.Transition(ctx, order.ID, order.Status, transition)
+	if err == repository.ErrConflict {
+		return ErrInvalidTransition
+	}
+	if err != nil {
+		return err
+	}
+
+	order.Status = to
+	order.UpdatedAt = now
+	order.History = append(order.History, transition)
+
+	// Keep the reserved stock in sync with the order
+	switch to {
+	case models.OrderStatusPaid:
+		return h.commitReservations(ctx, order.ID)
+	case models.OrderStatusCancelled:
+		return h.releaseReservations(ctx, order.ID)
+	}
+
+	return nil
+}
+
+// Paginated list of the orders matching the filter
+func (h *Handler) listOrders(c *fiber.Ctx, filter repository.OrderFilter) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	filter.Status = c.Query("status")
+
+	// Pagination
+	page, window := paginate(c)
+
+	// Find orders, newest first
+	orders, total, err := h.repos.Orders.List(ctx, filter, window)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Orders not found",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":      orders,
+		"total":     total,
+		"page":      page,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
+	})
+}
+
+// Turns the user's cart into a pending order
+func (h *Handler) Checkout(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	// Only users have carts
+	actorType, userId := tokenActor(c)
+	if actorType != models.ActorTypeUser {
+		return middlewares.Forbidden(c, "order:create")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Refresh the cart prices
+	cart := h.findCart(ctx, repository.CartOwner{Store: storeId, User: userId})
+	if err := h.recomputeCart(ctx, cart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to load the cart",
+			"error":   err,
+		})
+	}
+	if len(cart.Items) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Cart is empty",
+		})
+	}
+
+	// Snapshot the items
+	now := time.Now()
+	order := &models.Order{
+		ID:        primitive.NewObjectID(),
+		Store:     storeId,
+		Customer:  userId,
+		Items:     []models.OrderItem{},
+		Subtotal:  cart.Subtotal,
+		Status:    models.OrderStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		History: []models.OrderTransition{
+			{To: models.OrderStatusPending, At: now, ActorType: actorType, Actor: userId},
+		},
+	}
+	for _, item := range cart.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			Product:  item.Product,
+			Title:    item.Title,
+			SKU:      item.SKU,
+			Quantity: item.Quantity,
+			Price:    item.Price,
+			Total:    item.Total,
+		})
+	}
+
+	// Reserve the stock until the order is paid
+	err = h.reserveStock(ctx, order, actorType, userId)
+	if err == ErrOutOfStock || err == ErrProductNotFound {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Some items are out of stock",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to reserve the stock",
+			"error":   err,
+		})
+	}
+
+	// Attempt insert
+	if err := h.repos.Orders.Create(ctx, order); err != nil {
+		h.undoReservations(ctx, order.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to create the order",
+			"error":   err,
+		})
+	}
+
+	audit.Created(c, "orders", order.ID)
+
+	// Empty the cart
+	h.repos.Carts.Delete(ctx, cart.ID)
+
+	// Success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+		"message": "Order created successfully",
+	})
+}
+
+// Orders of a store, for its owner or an admin
+func (h *Handler) GetStoreOrders(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	return h.listOrders(c, repository.OrderFilter{Stores: []primitive.ObjectID{storeId}})
+}
+
+// Orders of every store for admins, of the stores the user works for otherwise
+func (h *Handler) GetAllOrders(c *fiber.Ctx) error {
+	if h.auth.Can(c, "order:list_all", primitive.NilObjectID) {
+		return h.listOrders(c, repository.OrderFilter{})
+	}
+
+	actorType, actor := tokenActor(c)
+	if actorType == models.ActorTypeUser {
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		user, err := h.repos.Users.FindByID(ctx, actor)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "User not found",
+				"error":   err,
+			})
+		}
+
+		stores, err := h.memberStoreIds(ctx, actor, "order:list")
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to find the user's stores",
+				"error":   err,
+			})
+		}
+		// Stores created before memberships
+		stores = append(stores, user.Stores...)
+		return h.listOrders(c, repository.OrderFilter{Stores: stores})
+	}
+
+	return middlewares.Forbidden(c, "order:list_all")
+}
+
+// Orders placed by the user
+func (h *Handler) GetMyOrders(c *fiber.Ctx) error {
+	actorType, actor := tokenActor(c)
+	if actorType != models.ActorTypeUser {
+		// Nobody else placed orders, match none
+		return h.listOrders(c, repository.OrderFilter{Stores: []primitive.ObjectID{}})
+	}
+
+	return h.listOrders(c, repository.OrderFilter{Customer: actor})
+}
+
+func (h *Handler) GetSingleOrder(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+	orderId, err := primitive.ObjectIDFromHex(c.Params("orderId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Not Found
+	order, err := h.repos.Orders.FindByID(ctx, orderId)
+	if err == nil && order.Store != storeId {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Order not found",
+			"error":   err,
+		})
+	}
+
+	// Check authorization
+	actorType, actor := tokenActor(c)
+	if !(actorType == models.ActorTypeUser && actor == order.Customer) && !h.auth.Can(c, "order:read", storeId) {
+		return middlewares.Forbidden(c, "order:read")
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":    order,
+		"success": true,
+	})
+}
+
+func (h *Handler) UpdateOrderStatus(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+	orderId, err := primitive.ObjectIDFromHex(c.Params("orderId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	type StatusInput struct {
+		Status string `json:"status" validate:"required"`
+		Note   string `json:"note"`
+	}
+
+	input := new(StatusInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Not Found
+	order, err := h.repos.Orders.FindByID(ctx, orderId)
+	if err == nil && order.Store != storeId {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Order not found",
+			"error":   err,
+		})
+	}
+
+	// Check authorization, customers can only cancel their pending orders
+	actorType, actor := tokenActor(c)
+	authorized := h.auth.Can(c, "order:update", storeId)
+	if !authorized && actorType == models.ActorTypeUser && actor == order.Customer {
+		authorized = order.Status == models.OrderStatusPending && input.Status == models.OrderStatusCancelled
+	}
+
+	if !authorized {
+		return middlewares.Forbidden(c, "order:update")
+	}
+
+	// Only the payments pay and refund orders, through their webhooks and
+	// refunds, so the money and the order always agree
+	if input.Status == models.OrderStatusPaid || input.Status == models.OrderStatusRefunded {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Orders are paid and refunded through their payments",
+		})
+	}
+	if input.Status == models.OrderStatusCancelled && order.Status != models.OrderStatusPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Paid orders are cancelled by refunding their payment",
+		})
+	}
+
+	audit.Target(c, "orders", order.ID)
+
+	// Attempt transition
+	err = h.transitionOrder(ctx, order, input.Status, actorType, actor, input.Note)
+	if err == ErrInvalidTransition {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Cannot move the order from " + order.Status + " to " + input.Status,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the order",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+		"message": "Order updated successfully",
+	})
+}
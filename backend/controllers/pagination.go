@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+)
+
+// Reads the "page" and "limit" query into the window of the list
+func paginate(c *fiber.Ctx) (int, repository.Page) {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limitVal, _ := strconv.Atoi(c.Query("limit", "10"))
+	if limitVal < 1 {
+		limitVal = 10
+	}
+	var limit int64 = int64(limitVal)
+
+	return page, repository.Page{Skip: (int64(page) - 1) * limit, Limit: limit}
+}
+
+func lastPage(total int64, limit int64) float64 {
+	last := float64(total / limit)
+	if last < 1 && total > 0 {
+		last = 1
+	}
+
+	return last
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Creates a reset for the user matching the username or email and emails its
+// token. Nothing happens when there is no such user.
+func (h *Handler) requestPasswordReset(logger *logging.Logger, login string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := h.repos.Users.FindByLogin(ctx, login)
+	if err != nil {
+		return
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		logger.Error("generating the reset secret", "error", err)
+		return
+	}
+	hashed, err := utils.HashPassword(secret)
+	if err != nil {
+		logger.Error("hashing the reset secret", "error", err)
+		return
+	}
+
+	reset := models.PasswordReset{
+		ID:         primitive.NewObjectID(),
+		User:       user.ID,
+		SecretHash: hashed,
+		ExpiresAt:  time.Now().Add(h.config.PasswordResetTTL),
+		CreatedAt:  time.Now(),
+	}
+	if err := h.repos.PasswordResets.Create(ctx, &reset); err != nil {
+		logger.Error("saving the password reset", "error", err)
+		return
+	}
+
+	token := reset.ID.Hex() + "." + secret
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. If it was you, choose a new one: %s/reset-password?token=%s\n\nThe link expires in %s and works once. If it wasn't you, ignore this email.",
+			user.Username, h.config.URL, token, h.config.PasswordResetTTL),
+	})
+	if err != nil {
+		logger.Error("sending the password reset email", "error", err)
+	}
+}
+
+// Emails a reset link. The answer is the same whether the account exists or
+// not, and the work is done in the background so the timing doesn't tell
+// either.
+func (h *Handler) ForgotPassword(c *fiber.Ctx) error {
+	type ForgotInput struct {
+		Login string `json:"login" validate:"required"`
+	}
+
+	input := new(ForgotInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	logger, login := logging.Ctx(c), strings.TrimSpace(input.Login)
+	h.background(func() { h.requestPasswordReset(logger, login) })
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "If the account exists, a reset link has been sent to its email",
+	})
+}
+
+// Sets a new password with a reset token and logs the user out everywhere
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	type ResetInput struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=8"`
+	}
+
+	input := new(ResetInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	invalid := fiber.Map{
+		"success": false,
+		"message": "Invalid or expired reset token",
+	}
+
+	resetHex, secret, _ := strings.Cut(input.Token, ".")
+	resetId, err := primitive.ObjectIDFromHex(resetHex)
+	if err != nil || secret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	reset, err := h.repos.PasswordResets.FindUsable(ctx, resetId, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+	if !utils.CheckPasswordHash(secret, reset.SecretHash) {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	// Use the token, only one request can
+	used, err := h.repos.PasswordResets.Use(ctx, resetId, time.Now())
+	if err != nil || !used {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	// Hash password
+	hashed, err := utils.HashPassword(input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to reset the password",
+			"error":   err,
+		})
+	}
+
+	err = h.repos.Users.SetPassword(ctx, reset.User, hashed)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to reset the password",
+			"error":   err,
+		})
+	}
+
+	// The other links and every session stop working
+	h.repos.PasswordResets.UseAll(ctx, reset.User, time.Now())
+	if err := h.revokeSessions(ctx, models.ActorTypeUser, reset.User); err != nil {
+		logging.Ctx(c).Error("revoking the sessions", "error", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Password reset successfully",
+	})
+}
@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Pays a pending order of the user
+func (h *Handler) CreatePayment(c *fiber.Ctx) error {
+	// Only users place orders
+	actorType, userId := tokenActor(c)
+	if actorType != models.ActorTypeUser {
+		return middlewares.Forbidden(c, "payment:create")
+	}
+
+	type PaymentInput struct {
+		Order    string `json:"order" validate:"required"`
+		Method   string `json:"method"`
+		Currency string `json:"currency"`
+	}
+
+	input := new(PaymentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+	if input.Currency == "" {
+		input.Currency = "usd"
+	}
+
+	if h.config.PaymentProvider == "" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"success": false,
+			"message": "Payments are not available",
+		})
+	}
+
+	orderId, err := primitive.ObjectIDFromHex(input.Order)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Order not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 20*time.Second)
+	defer cancel()
+
+	// Order must be the user's and waiting for payment
+	order, err := h.repos.Orders.FindByID(ctx, orderId)
+	if err == nil && order.Customer != userId {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Order not found",
+			"error":   err,
+		})
+	}
+	if order.Status != models.OrderStatusPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Order is not waiting for payment",
+		})
+	}
+
+	// One payment at a time, a failed one can be retried
+	if _, err := h.repos.Payments.FindActiveByOrder(ctx, order.ID); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Order already has a payment",
+		})
+	} else if err != repository.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to load the payments of the order",
+			"error":   err,
+		})
+	}
+
+	provider, ok := h.payments.Get(h.config.PaymentProvider)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment provider not available",
+		})
+	}
+
+	now := time.Now()
+	payment := &models.Payment{
+		ID:        primitive.NewObjectID(),
+		Store:     order.Store,
+		Payer:     userId,
+		Order:     order.ID,
+		Provider:  provider.Name(),
+		Amount:    order.Subtotal,
+		Currency:  input.Currency,
+		Status:    models.PaymentStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Create the intent on the provider
+	intent, err := provider.CreateIntent(ctx, payments.IntentParams{
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		Reference: payment.ID.Hex(),
+		Method:    input.Method,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to create the payment",
+			"error":   err.Error(),
+		})
+	}
+	payment.IntentID = intent.ID
+
+	// Another request got there first, its intent is the one captured
+	err = h.repos.Payments.Create(ctx, payment)
+	if err == repository.ErrConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Order already has a payment",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to create the payment",
+			"error":   err,
+		})
+	}
+
+	audit.Created(c, "payments", payment.ID)
+
+	// Capture, the final status comes from the provider's webhook
+	status := models.PaymentStatusProcessing
+	reason := ""
+	if _, err := provider.Capture(ctx, intent.ID); err != nil {
+		status = models.PaymentStatusFailed
+		reason = err.Error()
+	}
+
+	// The webhook may already have settled the payment
+	if _, err := h.repos.Payments.SetStatus(ctx, payment.ID, []string{models.PaymentStatusPending}, status, reason, time.Now()); err != nil {
+		logging.Ctx(c).Error("saving the captured payment", "payment", payment.ID, "status", status, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the payment",
+			"error":   err,
+		})
+	}
+	if current, err := h.repos.Payments.FindByID(ctx, payment.ID); err == nil {
+		payment = current
+	}
+
+	if payment.Status == models.PaymentStatusFailed {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"success": false,
+			"data":    payment,
+			"message": "Payment declined",
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    payment,
+		"message": "Payment created successfully",
+	})
+}
+
+func (h *Handler) GetSinglePayment(c *fiber.Ctx) error {
+	// Bad request
+	paymentId, err := primitive.ObjectIDFromHex(c.Params("paymentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Not Found
+	payment, err := h.repos.Payments.FindByID(ctx, paymentId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment not found",
+			"error":   err,
+		})
+	}
+
+	// Check authorization
+	actorType, actor := tokenActor(c)
+	if !(actorType == models.ActorTypeUser && actor == payment.Payer) && !h.auth.Can(c, "payment:read", payment.Store) {
+		return middlewares.Forbidden(c, "payment:read")
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":    payment,
+		"success": true,
+	})
+}
+
+// Refunds a succeeded payment as the store owner or an admin
+func (h *Handler) RefundPayment(c *fiber.Ctx) error {
+	paymentId, err := primitive.ObjectIDFromHex(c.Params("paymentId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 20*time.Second)
+	defer cancel()
+
+	// Not Found
+	payment, err := h.repos.Payments.FindByID(ctx, paymentId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment not found",
+			"error":   err,
+		})
+	}
+
+	// Check authorization
+	if !h.auth.Can(c, "payment:refund", payment.Store) {
+		return middlewares.Forbidden(c, "payment:refund")
+	}
+
+	if payment.Status != models.PaymentStatusSucceeded {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Only succeeded payments can be refunded",
+		})
+	}
+
+	provider, ok := h.payments.Get(payment.Provider)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment provider not available",
+		})
+	}
+
+	audit.Target(c, "payments", payment.ID)
+
+	// The status is updated by the provider's webhook
+	if _, err := provider.Refund(ctx, payment.IntentID, payment.Amount); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to refund the payment",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "Refund requested",
+	})
+}
+
+// Receives the signed notifications of a payment provider. Failures worth
+// retrying answer 5xx so the provider delivers the event again.
+func (h *Handler) PaymentWebhook(c *fiber.Ctx) error {
+	provider, ok := h.payments.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Unknown payment provider",
+		})
+	}
+
+	// Bad signature
+	event, err := provider.ParseWebhook(c.Body(), c.Get(provider.SignatureHeader()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid webhook",
+			"error":   err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Statuses the event can move the payment from
+	var from []string
+	var status, orderStatus string
+	switch event.Type {
+	case payments.EventPaymentSucceeded:
+		from = []string{models.PaymentStatusPending, models.PaymentStatusProcessing}
+		status, orderStatus = models.PaymentStatusSucceeded, models.OrderStatusPaid
+	case payments.EventPaymentFailed:
+		from = []string{models.PaymentStatusPending, models.PaymentStatusProcessing}
+		status = models.PaymentStatusFailed
+	case payments.EventPaymentRefunded:
+		from = []string{models.PaymentStatusSucceeded}
+		status, orderStatus = models.PaymentStatusRefunded, models.OrderStatusRefunded
+	default:
+		// Ignore the events we don't handle
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	payment, err := h.repos.Payments.FindByIntent(ctx, provider.Name(), event.IntentID)
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment not found",
+			"error":   err,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to load the payment",
+			"error":   err,
+		})
+	}
+
+	audit.Target(c, "payments", payment.ID)
+
+	applied, err := h.repos.Payments.SetStatus(ctx, payment.ID, from, status, event.Reason, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the payment",
+			"error":   err,
+		})
+	}
+
+	// Out of date event. A retry of an applied one goes on, the order may not
+	// have moved the first time.
+	if !applied && payment.Status != status {
+		return c.SendStatus(fiber.StatusOK)
+	}
+	if orderStatus == "" || payment.Order.IsZero() {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	succeeded := event.Type == payments.EventPaymentSucceeded
+	if succeeded && !chargedAsAsked(event, payment) {
+		return h.refundUnusable(ctx, c, provider, payment, event, "the amount or currency charged differs from the payment")
+	}
+
+	// Move the order along with the payment
+	err = h.settleOrder(ctx, payment, orderStatus)
+	if err == ErrInvalidTransition && succeeded {
+		return h.refundUnusable(ctx, c, provider, payment, event, "the order is no longer waiting for payment")
+	}
+	if err == ErrInvalidTransition {
+		logging.Ctx(c).Warn("payment refunded while its order wasn't paid", "payment", payment.ID, "order", payment.Order)
+		return c.SendStatus(fiber.StatusOK)
+	}
+	if err != nil {
+		logging.Ctx(c).Error("moving the order with its payment", "order", payment.Order, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the order",
+			"error":   err,
+		})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Whether the provider charged what the payment asked for
+func chargedAsAsked(event *payments.Event, payment *models.Payment) bool {
+	return event.Amount == payment.Amount && strings.EqualFold(event.Currency, payment.Currency)
+}
+
+// Moves the order of the payment to the status. When an earlier delivery of
+// the event already moved it, only what may have failed after is done again.
+func (h *Handler) settleOrder(ctx context.Context, payment *models.Payment, status string) error {
+	order, err := h.repos.Orders.FindByID(ctx, payment.Order)
+	if err == repository.ErrNotFound {
+		return ErrInvalidTransition
+	}
+	if err != nil {
+		return err
+	}
+
+	if order.Status == status {
+		if status == models.OrderStatusPaid {
+			return h.commitReservations(ctx, order.ID)
+		}
+		return nil
+	}
+	return h.transitionOrder(ctx, order, status, models.ActorTypeSystem, primitive.NilObjectID, "payment "+payment.ID.Hex())
+}
+
+// Gives the customer back a payment their order can't take, like one settling
+// after the order was cancelled. The refund's own webhook updates the payment.
+func (h *Handler) refundUnusable(ctx context.Context, c *fiber.Ctx, provider payments.Provider, payment *models.Payment, event *payments.Event, reason string) error {
+	logging.Ctx(c).Error("refunding a payment its order can't take",
+		"payment", payment.ID, "order", payment.Order, "amount", event.Amount, "currency", event.Currency, "reason", reason)
+
+	if _, err := provider.Refund(ctx, payment.IntentID, event.Amount); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to refund the payment",
+			"error":   err.Error(),
+		})
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
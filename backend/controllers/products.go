@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (h *Handler) GetAllProducts(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Pagination
+	page, window := paginate(c)
+
+	// Find the active products matching the search
+	products, total, err := h.repos.Products.List(ctx, storeId, models.ProductStatusActive, c.Query("s"), window)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Products not found",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":      products,
+		"total":     total,
+		"page":      page,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
+	})
+}
+
+func (h *Handler) GetSingleProduct(c *fiber.Ctx) error {
+	// Bad request
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Not Found
+	product, err := h.repos.Products.Find(ctx, storeId, productId)
+	if err == nil && product.Status != models.ProductStatusActive {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":    product,
+		"success": true,
+	})
+}
+
+func (h *Handler) CreateProduct(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	// Store must exist
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*10)
+	defer cancel()
+
+	if _, err := h.repos.Stores.FindByID(ctx, storeId); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+
+	// Init product
+	product := new(models.Product)
+
+	// Bad request
+	if err := c.BodyParser(product); err != nil {
+		logging.Ctx(c).Debug("parsing the request body", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+	product.ID = primitive.NilObjectID
+	product.Store = storeId
+	if product.Status == "" {
+		product.Status = models.ProductStatusDraft
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(product); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	// SKU must be unique inside the store
+	if exists, _ := h.repos.Products.SKUExists(ctx, storeId, product.SKU, primitive.NilObjectID); exists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "SKU already in use",
+		})
+	}
+
+	// Attempt insert
+	if err := h.repos.Products.Create(ctx, product); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to create the product",
+			"error":   err,
+		})
+	}
+
+	audit.Created(c, "products", product.ID)
+
+	// Record the initial stock
+	if product.Stock > 0 {
+		actorType, actor := tokenActor(c)
+		h.repos.Inventory.Create(ctx, &models.InventoryAdjustment{
+			Store:      storeId,
+			Product:    product.ID,
+			Delta:      product.Stock,
+			StockAfter: product.Stock,
+			Reason:     models.InventoryReasonInitial,
+			ActorType:  actorType,
+			Actor:      actor,
+			CreatedAt:  time.Now(),
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    fiber.Map{"InsertedID": product.ID},
+		"message": "Product created successfully",
+	})
+}
+
+func (h *Handler) UpdateProduct(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	// Only set the fields present in the body, the stock is changed through
+	// inventory adjustments
+	type ProductUpdate struct {
+		Title       *string   `json:"title" bson:"title,omitempty" validate:"omitempty,min=1"`
+		Description *string   `json:"description" bson:"description,omitempty"`
+		Price       *int64    `json:"price" bson:"price,omitempty" validate:"omitempty,gte=0"`
+		SKU         *string   `json:"sku" bson:"sku,omitempty" validate:"omitempty,min=1"`
+		Images      *[]string `json:"images" bson:"images,omitempty" validate:"omitempty,dive,url"`
+		Status      *string   `json:"status" bson:"status,omitempty" validate:"omitempty,oneof=draft active archived"`
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+	update := new(ProductUpdate)
+
+	// Bad request
+	if err := c.BodyParser(update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Bad request",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	// SKU must stay unique inside the store
+	if update.SKU != nil {
+		if exists, _ := h.repos.Products.SKUExists(ctx, storeId, *update.SKU, productId); exists {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "SKU already in use",
+			})
+		}
+	}
+
+	audit.TargetFilter(c, "products", productId.Hex(), bson.M{"_id": productId, "store": storeId})
+
+	// Update document
+	err = h.repos.Products.Update(ctx, storeId, productId, update)
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update product",
+			"error":   err.Error(),
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Product updated successfully",
+	})
+}
+
+func (h *Handler) DeleteProduct(c *fiber.Ctx) error {
+	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Store not found",
+			"error":   err,
+		})
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Params("productId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+			"error":   err,
+		})
+	}
+
+	// Authorized
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.TargetFilter(c, "products", productId.Hex(), bson.M{"_id": productId, "store": storeId})
+
+	err = h.repos.Products.Delete(ctx, storeId, productId)
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Product not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to delete product",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Product deleted successfully",
+	})
+}
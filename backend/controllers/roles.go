@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/rbac"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lists the roles and their permissions
+func (h *Handler) GetRoles(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    rbac.Roles(),
+	})
+}
+
+func (h *Handler) GetRoleAssignments(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Filters
+	filter := repository.RoleAssignmentFilter{Role: c.Query("role")}
+	if userId, err := primitive.ObjectIDFromHex(c.Query("user")); err == nil {
+		filter.User = userId
+	}
+	if storeId, err := primitive.ObjectIDFromHex(c.Query("store")); err == nil {
+		filter.Store = storeId
+	}
+
+	// Pagination
+	page, window := paginate(c)
+
+	// Find assignments
+	assignments, total, err := h.repos.Roles.List(ctx, filter, window)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Role assignments not found",
+			"error":   err,
+		})
+	}
+
+	// Success
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":      assignments,
+		"total":     total,
+		"page":      page,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
+	})
+}
+
+func (h *Handler) CreateRoleAssignment(c *fiber.Ctx) error {
+	type AssignmentInput struct {
+		User  string `json:"user" validate:"required"`
+		Role  string `json:"role" validate:"required"`
+		Store string `json:"store"`
+	}
+
+	input := new(AssignmentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	// Every user is a customer already
+	if !rbac.IsRole(input.Role) || input.Role == rbac.RoleCustomer {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Unknown role",
+		})
+	}
+	if rbac.IsStoreRole(input.Role) != (input.Store != "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Store roles need a store, other roles must not have one",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	_, adminId := tokenActor(c)
+	assignment := &models.RoleAssignment{
+		Role:      input.Role,
+		CreatedBy: adminId,
+		CreatedAt: time.Now(),
+	}
+
+	// User must exist
+	userId, err := primitive.ObjectIDFromHex(input.User)
+	if err == nil {
+		_, err = h.repos.Users.FindByID(ctx, userId)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "User not found",
+		})
+	}
+	assignment.User = userId
+
+	// Store must exist
+	if input.Store != "" {
+		storeId, err := primitive.ObjectIDFromHex(input.Store)
+		if err == nil {
+			_, err = h.repos.Stores.FindByID(ctx, storeId)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Store not found",
+			})
+		}
+		assignment.Store = storeId
+	}
+
+	// Already assigned
+	if exists, _ := h.repos.Roles.Exists(ctx, assignment.User, assignment.Role, assignment.Store); exists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Role already assigned",
+		})
+	}
+
+	// Attempt insert
+	if err := h.repos.Roles.Create(ctx, assignment); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to assign the role",
+			"error":   err,
+		})
+	}
+
+	audit.Created(c, "role_assignments", assignment.ID)
+
+	// Success
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    fiber.Map{"InsertedID": assignment.ID},
+		"message": "Role assigned successfully",
+	})
+}
+
+func (h *Handler) DeleteRoleAssignment(c *fiber.Ctx) error {
+	assignmentId, err := primitive.ObjectIDFromHex(c.Params("assignmentId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Role assignment not found",
+			"error":   err,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.Target(c, "role_assignments", assignmentId)
+
+	err = h.repos.Roles.Delete(ctx, assignmentId)
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Role assignment not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to delete the role assignment",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Role assignment deleted successfully",
+	})
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Signs a short lived access token for the subject. The sid claim is the
+// refresh token family the access token was issued for.
+func (h *Handler) signAccessToken(subjectType string, subject primitive.ObjectID, username string, family primitive.ObjectID) (string, error) {
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	if subjectType == models.ActorTypeAdmin {
+		claims["admin_id"] = subject
+	} else {
+		claims["user_id"] = subject
+	}
+	claims["username"] = username
+	claims["jti"] = jti
+	claims["sid"] = family.Hex()
+	claims["exp"] = time.Now().Add(h.config.AccessTokenTTL).Unix()
+
+	return h.keys.Sign(claims)
+}
+
+// Issues an access token and a refresh token of the family, a nil family
+// starts a new session
+func (h *Handler) issueSession(ctx context.Context, subjectType string, subject primitive.ObjectID, username string, family primitive.ObjectID) (fiber.Map, error) {
+	if family.IsZero() {
+		family = primitive.NewObjectID()
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.repos.Sessions.CreateRefreshToken(ctx, &models.RefreshToken{
+		Family:      family,
+		TokenHash:   utils.HashToken(refreshToken),
+		SubjectType: subjectType,
+		Subject:     subject,
+		ExpiresAt:   time.Now().Add(h.config.RefreshTokenTTL),
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.signAccessToken(subjectType, subject, username, family)
+	if err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"success":       true,
+		"message":       "Success login",
+		"data":          accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(h.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Ends every session of the refresh token family
+func (h *Handler) revokeFamily(ctx context.Context, family primitive.ObjectID) error {
+	return h.repos.Sessions.RevokeFamily(ctx, family, time.Now())
+}
+
+// Ends every session of the subject, including the access tokens already
+// issued
+func (h *Handler) revokeSessions(ctx context.Context, subjectType string, subject primitive.ObjectID) error {
+	if err := h.repos.Sessions.RevokeSubject(ctx, subjectType, subject, time.Now()); err != nil {
+		return err
+	}
+
+	// To the millisecond like iat and the stored dates. Tokens of the current
+	// millisecond stay valid so a login right after isn't rejected.
+	return h.repos.Sessions.RevokeAccessToken(ctx, models.RevokedToken{
+		Subject:      subject,
+		IssuedBefore: time.Now().Truncate(time.Millisecond),
+		ExpiresAt:    time.Now().Add(h.config.AccessTokenTTL),
+	})
+}
+
+// Ends every session of the admin, for the admin CLI
+func (h *Handler) RevokeAdminSessions(ctx context.Context, id primitive.ObjectID) error {
+	return h.revokeSessions(ctx, models.ActorTypeAdmin, id)
+}
+
+// Rejects the access token until it expires
+func (h *Handler) revokeAccessToken(ctx context.Context, claims jwt.MapClaims) error {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(h.config.AccessTokenTTL)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return h.repos.Sessions.RevokeAccessToken(ctx, models.RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+}
+
+// Name put in the access tokens of the subject, empty if it doesn't exist anymore
+func (h *Handler) subjectUsername(ctx context.Context, subjectType string, subject primitive.ObjectID) string {
+	if subjectType == models.ActorTypeAdmin {
+		if admin, err := h.repos.Admins.FindByID(ctx, subject); err == nil {
+			return admin.Username
+		}
+		return ""
+	}
+
+	if user, err := h.repos.Users.FindByID(ctx, subject); err == nil {
+		return user.Username
+	}
+	return ""
+}
+
+// Exchanges a refresh token for a new access token and refresh token. Every
+// refresh token works once, using one again means it leaked and ends the
+// whole session.
+func (h *Handler) RefreshSession(c *fiber.Ctx) error {
+	type RefreshInput struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+
+	input := new(RefreshInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	invalid := fiber.Map{
+		"success": false,
+		"message": "Invalid or expired refresh token",
+	}
+
+	token, err := h.repos.Sessions.FindRefreshToken(ctx, utils.HashToken(input.RefreshToken))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(invalid)
+	}
+	if !token.RevokedAt.IsZero() || token.ExpiresAt.Before(time.Now()) {
+		return c.Status(fiber.StatusUnauthorized).JSON(invalid)
+	}
+
+	// Only the first use of the token wins, any other means reuse
+	used, err := h.repos.Sessions.UseRefreshToken(ctx, token.ID, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to refresh the session",
+			"error":   err,
+		})
+	}
+	if !used {
+		logging.Ctx(c).Warn("refresh token reused, revoking its family", "family", token.Family)
+		if err := h.revokeFamily(ctx, token.Family); err != nil {
+			logging.Ctx(c).Error("revoking the session family", "error", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(invalid)
+	}
+
+	// The account may be gone
+	username := h.subjectUsername(ctx, token.SubjectType, token.Subject)
+	if username == "" {
+		h.revokeFamily(ctx, token.Family)
+		return c.Status(fiber.StatusUnauthorized).JSON(invalid)
+	}
+
+	session, err := h.issueSession(ctx, token.SubjectType, token.Subject, username, token.Family)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	session["message"] = "Session refreshed"
+
+	return c.JSON(session)
+}
+
+// Ends the session of the access token
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if err := h.revokeAccessToken(ctx, claims); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to log out",
+			"error":   err,
+		})
+	}
+
+	if sid, ok := claims["sid"].(string); ok {
+		family, err := primitive.ObjectIDFromHex(sid)
+		if err == nil {
+			err = h.revokeFamily(ctx, family)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to log out",
+				"error":   err,
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Logged out",
+	})
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (h *Handler) GetSecuritySettings(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Defaults until the settings are saved once
+	settings, err := h.repos.Settings.Security(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to read the settings",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":    settings,
+		"success": true,
+	})
+}
+
+func (h *Handler) UpdateSecuritySettings(c *fiber.Ctx) error {
+	settings := new(models.SecuritySettings)
+
+	// Bad request
+	if err := c.BodyParser(settings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+	settings.ID = models.SecuritySettingsID
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	audit.TargetFilter(c, "settings", models.SecuritySettingsID, bson.M{"_id": models.SecuritySettingsID})
+
+	if err := h.repos.Settings.SaveSecurity(ctx, settings); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to update the settings",
+			"error":   err,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    settings,
+		"message": "Settings updated successfully",
+	})
+}
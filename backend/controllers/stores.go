@@ -2,75 +2,27 @@ package controllers
 
 import (
 	"context"
-	"log"
-	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/rbac"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func GetAllStores(c *fiber.Ctx) error {
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
-	// Authorized
-	storesCollection := config.MI.DB.Collection("stores")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (h *Handler) GetAllStores(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	var stores []models.Store
-
-	filter := bson.M{}
-	findOptions := options.Find()
-
-	// Search
-	if s := c.Query("s"); s != "" {
-		filter = bson.M{
-			"$or": []bson.M{
-				{
-					"name": bson.M{
-						"$regex": primitive.Regex{
-							Pattern: s,
-							Options: "i",
-						},
-					},
-				},
-			},
-		}
-	}
-
 	// Pagination
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limitVal, _ := strconv.Atoi(c.Query("limit", "10"))
-	var limit int64 = int64(limitVal)
-
-	total, _ := storesCollection.CountDocuments(ctx, filter)
+	page, window := paginate(c)
 
-	findOptions.SetSkip((int64(page) - 1) * limit)
-	findOptions.SetLimit(limit)
-
-	// Find stores
-	cursor, err := storesCollection.Find(ctx, filter, findOptions)
+	// Find stores matching the search
+	stores, total, err := h.repos.Stores.List(ctx, c.Query("s"), window)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
@@ -78,31 +30,18 @@ func GetAllStores(c *fiber.Ctx) error {
 			"error":   err,
 		})
 	}
-	defer cursor.Close(ctx)
-
-	// Success
-	for cursor.Next(ctx) {
-		var store models.Store
-		cursor.Decode(&store)
-		stores = append(stores, store)
-	}
-
-	last := float64(total / limit)
-	if last < 1 && total > 0 {
-		last = 1
-	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"data":      stores,
 		"total":     total,
 		"page":      page,
-		"last_page": last,
-		"limit":     limit,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
 	})
 
 }
 
-func GetSingleStore(c *fiber.Ctx) error {
+func (h *Handler) GetSingleStore(c *fiber.Ctx) error {
 	// Bad request
 	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
 	if err != nil {
@@ -113,24 +52,11 @@ func GetSingleStore(c *fiber.Ctx) error {
 		})
 	}
 
-	storesCollection := config.MI.DB.Collection("stores")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	var store models.Store
-
 	// Not Found
-	findOptions := options.FindOne().SetProjection(bson.D{{"owner", 0}})
-	findResult := storesCollection.FindOne(ctx, bson.M{"_id": storeId}, findOptions)
-	if err := findResult.Err(); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Store not found",
-			"error":   err,
-		})
-	}
-
-	err = findResult.Decode(&store)
+	store, err := h.repos.Stores.FindByID(ctx, storeId)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
@@ -139,6 +65,9 @@ func GetSingleStore(c *fiber.Ctx) error {
 		})
 	}
 
+	// The owner isn't public
+	store.Owner = primitive.NilObjectID
+
 	// Success
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"data":    store,
@@ -146,39 +75,18 @@ func GetSingleStore(c *fiber.Ctx) error {
 	})
 }
 
-func CreateStore(c *fiber.Ctx) error {
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenAdminId := claims["admin_id"]
-	tokenUserId := claims["user_id"]
-
-	if tokenAdminId != nil || tokenUserId != nil {
-		authorized = true
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
+func (h *Handler) CreateStore(c *fiber.Ctx) error {
+	actorType, actor := tokenActor(c)
 
 	// Init store
-	storesCollection := config.MI.DB.Collection("stores")
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*10)
 	defer cancel()
 
 	store := new(models.Store)
-	if primitive.IsValidObjectID(tokenUserId.(string)) {
-		store.Owner, _ = primitive.ObjectIDFromHex(tokenUserId.(string))
-	} else if primitive.IsValidObjectID(tokenAdminId.(string)) {
-		store.Owner, _ = primitive.ObjectIDFromHex(tokenAdminId.(string))
-	}
 
 	// Bad request
 	if err := c.BodyParser(store); err != nil {
-		log.Println(err)
+		logging.Ctx(c).Debug("parsing the request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"sucess":  false,
 			"message": "Failed to parse the request body",
@@ -186,6 +94,27 @@ func CreateStore(c *fiber.Ctx) error {
 		})
 	}
 
+	store.ID = primitive.NilObjectID
+	store.Owner = actor
+
+	// Users must have confirmed their email
+	if actorType == models.ActorTypeUser {
+		user, err := h.repos.Users.FindByID(ctx, actor)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "User not found",
+				"error":   err,
+			})
+		}
+		if !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "Verify your email before creating a store",
+			})
+		}
+	}
+
 	// Validation
 	validate := utils.NewValidator()
 	if err := validate.Struct(store); err != nil {
@@ -196,8 +125,7 @@ func CreateStore(c *fiber.Ctx) error {
 	}
 
 	// Attempt insert
-	result, err := storesCollection.InsertOne(ctx, store)
-	if err != nil {
+	if err := h.repos.Stores.Create(ctx, store); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Failed to create the store",
@@ -205,17 +133,25 @@ func CreateStore(c *fiber.Ctx) error {
 		})
 	}
 
+	if actorType == models.ActorTypeUser {
+		// The creator owns the store
+		err := h.repos.Members.Add(ctx, store.ID, actor, rbac.RoleStoreOwner, actor)
+		if err != nil {
+			h.undoStore(ctx, store.ID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to add the store owner",
+				"error":   err.Error(),
+			})
+		}
+	}
+
 	// Update user's stores list
-	if tokenUserId != nil {
-		usersCollection := config.MI.DB.Collection("users")
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	if actorType == models.ActorTypeUser {
+		ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*10)
 		defer cancel()
-		update := bson.M{
-			"$push": bson.M{"stores": result.InsertedID},
-		}
-		userId, _ := primitive.ObjectIDFromHex(tokenUserId.(string))
-		_, err := usersCollection.UpdateOne(ctx, bson.M{"_id": userId}, update, options.Update().SetUpsert(true))
-		if err != nil {
+		if err := h.repos.Users.AddStore(ctx, actor, store.ID); err != nil {
+			h.undoStore(ctx, store.ID)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
 				"message": "Failed to update user",
@@ -224,16 +160,28 @@ func CreateStore(c *fiber.Ctx) error {
 		}
 	}
 
+	audit.Created(c, "stores", store.ID)
+
 	// Success
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
-		"data":    result,
+		"data":    fiber.Map{"InsertedID": store.ID},
 		"message": "Store created successfully",
 	})
 }
 
-func DeleteStore(c *fiber.Ctx) error {
+// Deletes a store whose owner couldn't be set up, logging what can't be undone
+func (h *Handler) undoStore(ctx context.Context, storeId primitive.ObjectID) {
+	log := logging.FromContext(ctx).With("store", storeId)
+	if err := h.repos.Members.DeleteByStore(ctx, storeId); err != nil {
+		log.Error("removing the owner of a store being undone", "error", err)
+	}
+	if err := h.repos.Stores.Delete(ctx, storeId); err != nil {
+		log.Error("deleting a store being undone", "error", err)
+	}
+}
 
+func (h *Handler) DeleteStore(c *fiber.Ctx) error {
 	storeId, err := primitive.ObjectIDFromHex(c.Params("storeId"))
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -243,58 +191,13 @@ func DeleteStore(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenUserId := claims["user_id"]
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	} else if tokenUserId != nil {
-		usersCollection := config.MI.DB.Collection("users")
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-		defer cancel()
-
-		var user models.User
-
-		userId, _ := primitive.ObjectIDFromHex(tokenUserId.(string))
-		findResult := usersCollection.FindOne(ctx, bson.M{"_id": userId})
-		if err := findResult.Err(); err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"success": false,
-				"message": "User not found",
-				"error":   err,
-			})
-		}
-		// Check user own store
-		if err := findResult.Decode(&user); err == nil {
-			for _, v := range user.Stores {
-				if v == storeId {
-					authorized = true
-					// Remove store ref from stores array
-					updates := bson.M{
-						"$pull": bson.M{"stores": storeId},
-					}
-					usersCollection.UpdateByID(ctx, userId, updates)
-				}
-			}
-		}
-
-	}
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
 	// Authorized
-	storesCollection := config.MI.DB.Collection("stores")
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 20*time.Second)
 	defer cancel()
 
-	_, err = storesCollection.DeleteOne(ctx, bson.M{"_id": storeId})
+	audit.Target(c, "stores", storeId)
+
+	err = h.repos.Stores.Delete(ctx, storeId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -303,6 +206,49 @@ func DeleteStore(c *fiber.Ctx) error {
 		})
 	}
 
+	// The store is gone whatever fails below, the leftovers are only logged
+	log := logging.Ctx(c).With("store", storeId)
+
+	// Remove store ref from the owners' stores array
+	if err := h.repos.Users.RemoveStore(ctx, storeId); err != nil {
+		log.Error("removing the store from its users", "error", err)
+	}
+
+	// Unpaid orders can't be paid anymore, cancelling them releases their
+	// reservations. Paid orders stay for the records.
+	actorType, actor := tokenActor(c)
+	orders, _, err := h.repos.Orders.List(ctx, repository.OrderFilter{Stores: []primitive.ObjectID{storeId}, Status: models.OrderStatusPending}, repository.Page{})
+	if err != nil {
+		log.Error("listing the pending orders of the store", "error", err)
+	}
+	for i := range orders {
+		err := h.transitionOrder(ctx, &orders[i], models.OrderStatusCancelled, actorType, actor, "store deleted")
+		if err != nil && err != ErrInvalidTransition {
+			log.Error("cancelling the order of the store", "order", orders[i].ID, "error", err)
+		}
+	}
+
+	// Remove the store's products and the carts holding them
+	if err := h.repos.Products.DeleteByStore(ctx, storeId); err != nil {
+		log.Error("deleting the products of the store", "error", err)
+	}
+	if err := h.repos.Carts.DeleteByStore(ctx, storeId); err != nil {
+		log.Error("deleting the carts of the store", "error", err)
+	}
+
+	// Remove the roles given for the store
+	if err := h.repos.Roles.DeleteByStore(ctx, storeId); err != nil {
+		log.Error("deleting the roles of the store", "error", err)
+	}
+
+	// Remove the store's staff and their invites
+	if err := h.repos.Members.DeleteByStore(ctx, storeId); err != nil {
+		log.Error("deleting the members of the store", "error", err)
+	}
+	if err := h.repos.Invites.DeleteByStore(ctx, storeId); err != nil {
+		log.Error("deleting the invites of the store", "error", err)
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"message": "Store deleted successfully",
@@ -0,0 +1,514 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/lockout"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/totp"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	twoFactorChallengePurpose = "2fa_challenge"
+	twoFactorEnrollPurpose    = "2fa_enroll"
+	twoFactorTokenTTL         = 5 * time.Minute
+	recoveryCodesCount        = 10
+)
+
+// The parts of users and admins the second factor needs
+type twoFactorAccount struct {
+	ID       primitive.ObjectID
+	Username string
+	models.TwoFactor
+}
+
+// Second factors of the kind of accounts
+func (h *Handler) twoFactors(subjectType string) repository.TwoFactorRepository {
+	if subjectType == models.ActorTypeAdmin {
+		return h.repos.Admins
+	}
+	return h.repos.Users
+}
+
+func (h *Handler) findTwoFactorAccount(ctx context.Context, subjectType string, id primitive.ObjectID) (*twoFactorAccount, error) {
+	if subjectType == models.ActorTypeAdmin {
+		admin, err := h.repos.Admins.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return &twoFactorAccount{ID: admin.ID, Username: admin.Username, TwoFactor: admin.TwoFactor}, nil
+	}
+
+	user, err := h.repos.Users.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactorAccount{ID: user.ID, Username: user.Username, TwoFactor: user.TwoFactor}, nil
+}
+
+// Whether every admin must use a second factor
+func (h *Handler) requireAdminTwoFactor(ctx context.Context) bool {
+	settings, err := h.repos.Settings.Security(ctx)
+	if err != nil {
+		return false
+	}
+	return settings.RequireAdminTwoFactor
+}
+
+// Answer of the password step when the account has a second factor, the
+// challenge token is exchanged for the session with a code
+func (h *Handler) twoFactorChallenge(c *fiber.Ctx, subjectType string, subject primitive.ObjectID) error {
+	token, err := h.keys.SignPurpose(twoFactorChallengePurpose, jwt.MapClaims{
+		"sub":          subject.Hex(),
+		"subject_type": subjectType,
+	}, twoFactorTokenTTL)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":             true,
+		"message":             "Two-factor code required",
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_in":          int64(twoFactorTokenTTL.Seconds()),
+	})
+}
+
+// Answer of the password step for admins without a second factor when it is
+// required, the enrollment token only lets them set one up
+func (h *Handler) twoFactorEnrollmentRequired(c *fiber.Ctx, adminId primitive.ObjectID) error {
+	token, err := h.keys.SignPurpose(twoFactorEnrollPurpose, jwt.MapClaims{
+		"sub":          adminId.Hex(),
+		"subject_type": models.ActorTypeAdmin,
+	}, twoFactorTokenTTL)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"success":          false,
+		"message":          "Two-factor authentication is required, enroll to log in",
+		"enrollment_token": token,
+		"expires_in":       int64(twoFactorTokenTTL.Seconds()),
+	})
+}
+
+// Subject of a single purpose token
+func (h *Handler) purposeSubject(purpose string, token string) (string, primitive.ObjectID, bool) {
+	claims, err := h.keys.ParsePurpose(purpose, token)
+	if err != nil {
+		return "", primitive.NilObjectID, false
+	}
+	subjectType, _ := claims["subject_type"].(string)
+	sub, _ := claims["sub"].(string)
+	subject, err := primitive.ObjectIDFromHex(sub)
+	if err != nil || (subjectType != models.ActorTypeUser && subjectType != models.ActorTypeAdmin) {
+		return "", primitive.NilObjectID, false
+	}
+	return subjectType, subject, true
+}
+
+// Account setting up its second factor, from the access token or else an
+// enrollment token
+func (h *Handler) enrollingSubject(c *fiber.Ctx, enrollmentToken string) (string, primitive.ObjectID, bool) {
+	if _, ok := c.Locals("user").(*jwt.Token); ok {
+		subjectType, subject := tokenActor(c)
+		return subjectType, subject, subjectType != ""
+	}
+	return h.purposeSubject(twoFactorEnrollPurpose, enrollmentToken)
+}
+
+func hashRecoveryCode(code string) string {
+	return utils.HashToken(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
+
+// Single use codes replacing the authenticator, returned once and stored hashed
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		random, err := utils.RandomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = random[:5] + "-" + random[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// Accepts a current TOTP code, each one only once, or uses up a recovery code
+func (h *Handler) checkSecondFactor(ctx context.Context, subjectType string, account *twoFactorAccount, code string, recoveryCode string) bool {
+	twoFactors := h.twoFactors(subjectType)
+
+	if code != "" {
+		counter, ok := totp.Validate(account.TOTPSecret, code, time.Now(), 1)
+		if !ok {
+			return false
+		}
+		used, err := twoFactors.UseTOTPCounter(ctx, account.ID, counter)
+		return err == nil && used
+	}
+
+	if recoveryCode != "" && account.TOTPEnabled {
+		used, err := twoFactors.UseRecoveryCode(ctx, account.ID, hashRecoveryCode(recoveryCode))
+		return err == nil && used
+	}
+
+	return false
+}
+
+// Starts setting up an authenticator app, the secret is only used once confirmed
+func (h *Handler) EnrollTwoFactor(c *fiber.Ctx) error {
+	type EnrollInput struct {
+		EnrollmentToken string `json:"enrollment_token"`
+	}
+
+	input := new(EnrollInput)
+	c.BodyParser(input)
+
+	subjectType, subject, ok := h.enrollingSubject(c, input.EnrollmentToken)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired token",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	account, err := h.findTwoFactorAccount(ctx, subjectType, subject)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Account not found",
+			"error":   err,
+		})
+	}
+	if account.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = h.twoFactors(subjectType).SetTOTPSecret(ctx, subject, secret)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to enroll",
+			"error":   err,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Scan the code with an authenticator app and confirm with a code",
+		"data": fiber.Map{
+			"secret":      secret,
+			"otpauth_uri": totp.URI(h.config.TOTPIssuer, account.Username, secret),
+		},
+	})
+}
+
+// Enables the enrolled secret after checking a code from it and returns the
+// recovery codes
+func (h *Handler) ConfirmTwoFactor(c *fiber.Ctx) error {
+	type ConfirmInput struct {
+		Code            string `json:"code" validate:"required"`
+		EnrollmentToken string `json:"enrollment_token"`
+	}
+
+	input := new(ConfirmInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	subjectType, subject, ok := h.enrollingSubject(c, input.EnrollmentToken)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired token",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	account, err := h.findTwoFactorAccount(ctx, subjectType, subject)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Account not found",
+			"error":   err,
+		})
+	}
+	if account.TOTPEnabled || account.TOTPSecret == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "No two-factor enrollment in progress",
+		})
+	}
+
+	if !h.checkSecondFactor(ctx, subjectType, account, input.Code, "") {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid code",
+		})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = h.twoFactors(subjectType).EnableTOTP(ctx, subject, account.TOTPSecret, hashes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to enable two-factor authentication",
+			"error":   err,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication enabled, keep the recovery codes somewhere safe",
+		"data": fiber.Map{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// Second login step, exchanges the challenge token and a code for the session
+func (h *Handler) VerifyTwoFactor(c *fiber.Ctx) error {
+	type VerifyInput struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+		Code           string `json:"code" validate:"required_without=RecoveryCode"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	input := new(VerifyInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	subjectType, subject, ok := h.purposeSubject(twoFactorChallengePurpose, input.ChallengeToken)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired challenge",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	account, err := h.findTwoFactorAccount(ctx, subjectType, subject)
+	if err != nil || !account.TOTPEnabled {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid code",
+		})
+	}
+
+	// Codes are guessed like passwords
+	accountKey := lockout.AccountKey(subjectType, account.Username)
+	if wait := h.lockoutWait(c, accountKey); wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if !h.checkSecondFactor(ctx, subjectType, account, input.Code, input.RecoveryCode) {
+		h.recordLoginFailure(c, subjectType, account.Username)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid code",
+		})
+	}
+
+	return h.completeLogin(c, subjectType, account.ID, account.Username)
+}
+
+// Turns the second factor off, confirmed with a code
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	type DisableInput struct {
+		Code         string `json:"code" validate:"required_without=RecoveryCode"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	input := new(DisableInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	subjectType, subject := tokenActor(c)
+	if subjectType == models.ActorTypeAdmin && h.requireAdminTwoFactor(ctx) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "Two-factor authentication is required for admins",
+		})
+	}
+
+	account, err := h.findTwoFactorAccount(ctx, subjectType, subject)
+	if err != nil || !account.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Two-factor authentication is not enabled",
+		})
+	}
+
+	// Locked out like the logins, a stolen session mustn't guess the codes
+	accountKey := lockout.AccountKey(subjectType, account.Username)
+	if wait := h.lockoutWait(c, accountKey); wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if !h.checkSecondFactor(ctx, subjectType, account, input.Code, input.RecoveryCode) {
+		h.recordLoginFailure(c, subjectType, account.Username)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid code",
+		})
+	}
+
+	err = h.twoFactors(subjectType).DisableTOTP(ctx, subject)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to disable two-factor authentication",
+			"error":   err,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// Replaces the recovery codes, confirmed with a code
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	type RegenerateInput struct {
+		Code string `json:"code" validate:"required"`
+	}
+
+	input := new(RegenerateInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	subjectType, subject := tokenActor(c)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	account, err := h.findTwoFactorAccount(ctx, subjectType, subject)
+	if err != nil || !account.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Two-factor authentication is not enabled",
+		})
+	}
+
+	// Locked out like the logins
+	accountKey := lockout.AccountKey(subjectType, account.Username)
+	if wait := h.lockoutWait(c, accountKey); wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if !h.checkSecondFactor(ctx, subjectType, account, input.Code, "") {
+		h.recordLoginFailure(c, subjectType, account.Username)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid code",
+		})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	err = h.twoFactors(subjectType).SetRecoveryCodes(ctx, subject, hashes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to replace the recovery codes",
+			"error":   err,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Recovery codes replaced",
+		"data": fiber.Map{
+			"recovery_codes": codes,
+		},
+	})
+}
@@ -2,78 +2,28 @@ package controllers
 
 import (
 	"context"
-	"log"
-	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func GetAllUsers(c *fiber.Ctx) error {
-
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
-	// Authorized
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (h *Handler) GetAllUsers(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	var users []models.User
-
-	filter := bson.M{}
-	findOptions := options.Find()
-
-	// Search
-	if s := c.Query("s"); s != "" {
-		filter = bson.M{
-			"$or": []bson.M{
-				{
-					"username": bson.M{
-						"$regex": primitive.Regex{
-							Pattern: s,
-							Options: "i",
-						},
-					},
-				},
-			},
-		}
-	}
-
 	// Pagination
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limitVal, _ := strconv.Atoi(c.Query("limit", "10"))
-	var limit int64 = int64(limitVal)
-
-	total, _ := usersCollection.CountDocuments(ctx, filter)
-
-	findOptions.SetSkip((int64(page) - 1) * limit)
-	findOptions.SetLimit(limit)
+	page, window := paginate(c)
 
-	// Find users
-	cursor, err := usersCollection.Find(ctx, filter, findOptions)
+	// Find users matching the search
+	users, total, err := h.repos.Users.List(ctx, c.Query("s"), window)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
@@ -81,52 +31,19 @@ func GetAllUsers(c *fiber.Ctx) error {
 			"error":   err,
 		})
 	}
-	defer cursor.Close(ctx)
 
 	// Success
-	for cursor.Next(ctx) {
-		var user models.User
-		cursor.Decode(&user)
-		users = append(users, user)
-	}
-
-	last := float64(total / limit)
-	if last < 1 && total > 0 {
-		last = 1
-	}
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"data":      users,
 		"total":     total,
 		"page":      page,
-		"last_page": last,
-		"limit":     limit,
+		"last_page": lastPage(total, window.Limit),
+		"limit":     window.Limit,
 	})
 
 }
 
-func GetSingleUser(c *fiber.Ctx) error {
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenUserId := claims["user_id"]
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	} else if tokenUserId != nil {
-		if tokenUserId == c.Params("userId") {
-			authorized = true
-		}
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
+func (h *Handler) GetSingleUser(c *fiber.Ctx) error {
 	// Bad request
 	userId, err := primitive.ObjectIDFromHex(c.Params("userId"))
 	if err != nil {
@@ -137,23 +54,11 @@ func GetSingleUser(c *fiber.Ctx) error {
 		})
 	}
 
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	var user models.User
-
 	// Not Found
-	findResult := usersCollection.FindOne(ctx, bson.M{"_id": userId})
-	if err := findResult.Err(); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "User not found",
-			"error":   err,
-		})
-	}
-
-	err = findResult.Decode(&user)
+	user, err := h.repos.Users.FindByID(ctx, userId)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
@@ -169,31 +74,14 @@ func GetSingleUser(c *fiber.Ctx) error {
 	})
 }
 
-func CreateUser(c *fiber.Ctx) error {
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+func (h *Handler) CreateUser(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*10)
 	defer cancel()
 	user := new(models.User)
 
 	// Bad request
 	if err := c.BodyParser(user); err != nil {
-		log.Println(err)
+		logging.Ctx(c).Debug("parsing the request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"sucess":  false,
 			"message": "Failed to parse the request body",
@@ -220,9 +108,16 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 	user.Password = hashed
+	user.TwoFactor = models.TwoFactor{}
 
 	// Attempt insert
-	result, err := usersCollection.InsertOne(ctx, user)
+	err = h.repos.Users.Create(ctx, user)
+	if err == repository.ErrConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Username or email already in use",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -231,39 +126,19 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	audit.Created(c, "users", user.ID)
+
 	// Success
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
-		"data":    result,
+		"data":    fiber.Map{"InsertedID": user.ID},
 		"message": "User created successfully",
 	})
 
 }
 
-func UpdateUser(c *fiber.Ctx) error {
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenUserId := claims["user_id"]
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	} else if tokenUserId != nil {
-		if tokenUserId == c.Params("userId") {
-			authorized = true
-		}
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (h *Handler) UpdateUser(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 	user := new(models.User)
 
@@ -285,12 +160,45 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update document
-	update := bson.M{
-		"$set": user,
+	audit.Target(c, "users", userId)
+
+	// The stores list mirrors the owner memberships, it only changes with the stores
+	user.Stores = nil
+
+	// Hash password
+	if user.Password != "" {
+		hashed, err := utils.HashPassword(user.Password)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to update user",
+				"error":   err,
+			})
+		}
+		user.Password = hashed
+	}
+
+	// Second factors are managed by their owner
+	user.TwoFactor = models.TwoFactor{}
+
+	// Only the verification link verifies an email
+	user.EmailVerified = false
+	user.EmailVerifiedAt = time.Time{}
+
+	// A new address has to be verified again
+	emailChanged := false
+	if user.Email != "" {
+		current, err := h.repos.Users.FindByID(ctx, userId)
+		emailChanged = err == nil && current.Email != user.Email
 	}
 
-	_, err = usersCollection.UpdateOne(ctx, bson.M{"_id": userId}, update)
+	err = h.repos.Users.Update(ctx, userId, user)
+	if err == repository.ErrConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Username or email already in use",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -299,6 +207,21 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// A new password ends the sessions started with the old one
+	if user.Password != "" {
+		if err := h.revokeSessions(ctx, models.ActorTypeUser, userId); err != nil {
+			logging.Ctx(c).Error("revoking the sessions", "error", err)
+		}
+	}
+
+	if emailChanged {
+		if updated, err := h.repos.Users.FindByID(ctx, userId); err == nil {
+			if err := h.sendVerificationEmail(ctx, updated); err != nil {
+				logging.Ctx(c).Error("sending the verification email", "error", err)
+			}
+		}
+	}
+
 	// Success
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -307,31 +230,8 @@ func UpdateUser(c *fiber.Ctx) error {
 
 }
 
-func DeleteUser(c *fiber.Ctx) error {
-	// Check authorization
-	authorized := false
-	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
-	tokenUserId := claims["user_id"]
-	tokenAdminId := claims["admin_id"]
-
-	if tokenAdminId != nil {
-		authorized = true
-	} else if tokenUserId != nil {
-		if tokenUserId == c.Params("userId") {
-			authorized = true
-		}
-	}
-
-	if !authorized {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"message": "Unauthorized",
-		})
-	}
-
-	// Authorized
-	usersCollection := config.MI.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	userId, err := primitive.ObjectIDFromHex(c.Params("userId"))
@@ -343,7 +243,9 @@ func DeleteUser(c *fiber.Ctx) error {
 		})
 	}
 
-	_, err = usersCollection.DeleteOne(ctx, bson.M{"_id": userId})
+	audit.Target(c, "users", userId)
+
+	err = h.repos.Users.Delete(ctx, userId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -352,6 +254,9 @@ func DeleteUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// Log the user out everywhere
+	h.revokeSessions(ctx, models.ActorTypeUser, userId)
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"message": "User deleted successfully",
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const verifyEmailPurpose = "verify_email"
+
+// Emails the user a signed link confirming they own their address. The token
+// names the address so it stops working if the email changes.
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := h.keys.SignPurpose(verifyEmailPurpose, jwt.MapClaims{
+		"sub":   user.ID.Hex(),
+		"email": user.Email,
+	}, h.config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address: %s/verify-email?token=%s\n\nThe link expires in %s.",
+			user.Username, h.config.URL, token, h.config.EmailVerificationTTL),
+	})
+}
+
+// Marks the user of the verification token verified
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	type VerifyInput struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	input := new(VerifyInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to parse the request body",
+			"error":   err,
+		})
+	}
+
+	// Validation
+	validate := utils.NewValidator()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": utils.ValidationErrors(err),
+		})
+	}
+
+	invalid := fiber.Map{
+		"success": false,
+		"message": "Invalid or expired verification token",
+	}
+
+	claims, err := h.keys.ParsePurpose(verifyEmailPurpose, input.Token)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	userId, err := primitive.ObjectIDFromHex(subject)
+	if err != nil || email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// The address must still be the one the link was sent to
+	err = h.repos.Users.VerifyEmail(ctx, userId, email, time.Now())
+	if err == repository.ErrNotFound {
+		return c.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to verify the email",
+			"error":   err,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Email verified successfully",
+	})
+}
+
+// Sends a new verification link to the logged in user
+func (h *Handler) ResendVerificationEmail(c *fiber.Ctx) error {
+	actorType, userId := tokenActor(c)
+	if actorType != models.ActorTypeUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Only users verify their email",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.repos.Users.FindByID(ctx, userId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "User not found",
+			"error":   err,
+		})
+	}
+
+	if user.EmailVerified {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Email already verified",
+		})
+	}
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to send the verification email",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
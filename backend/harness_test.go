@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/auth"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/lockout"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/totp"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The end-to-end tests run the API of main.go against the in-memory
+// repositories, nothing outside the process is needed. Every test server has
+// its own mailer, lockout, payment providers and rate limits, so the tests run
+// in parallel.
+
+const (
+	testPassword        = "correct-horse-battery"
+	testPaymentsSecret  = "test-payments-secret"
+	testAccessTokenTTL  = 15 * time.Minute
+	testMailWaitTimeout = 5 * time.Second
+)
+
+// Signing keys of every test server, only read
+var testKeys *auth.KeySet
+
+func TestMain(m *testing.M) {
+	logging.Default = logging.New(io.Discard, logging.LevelError)
+
+	keys, err := auth.NewKeySet(auth.Config{Algorithm: auth.AlgorithmHS256, Secret: "test-secret"})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testKeys = keys
+
+	os.Exit(m.Run())
+}
+
+// Mailer keeping the messages for the tests to read
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, message mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages sent to the address so far
+func (m *mailbox) to(address string) []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []mailer.Message
+	for _, message := range m.messages {
+		if strings.EqualFold(message.To, address) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Waits for the n-th message to the address, some emails are sent in the
+// background after the response
+func (m *mailbox) wait(t *testing.T, address string, n int) mailer.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(testMailWaitTimeout)
+	for {
+		if messages := m.to(address); len(messages) >= n {
+			return messages[n-1]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no email number %d to %s", n, address)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Token of the link in the email
+func linkToken(t *testing.T, message mailer.Message) string {
+	t.Helper()
+
+	i := strings.Index(message.Body, "token=")
+	if i < 0 {
+		t.Fatalf("no token in the email %q", message.Body)
+	}
+	return strings.Fields(message.Body[i+len("token="):])[0]
+}
+
+// Config of the test servers
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.Env = config.EnvTest
+	cfg.App.PaymentProvider = payments.FakeProviderName
+	cfg.Payments.Fake.Enabled = true
+	cfg.Payments.Fake.Secret = testPaymentsSecret
+
+	// Limits high enough to never get in the way, the rate limit tests set
+	// their own
+	cfg.RateLimits.Auth = "100000/1m"
+	cfg.RateLimits.API = "100000/1m"
+	cfg.RateLimits.Storefront = "100000/1m"
+	return cfg
+}
+
+// API running on fresh repositories
+type testServer struct {
+	t     *testing.T
+	app   *fiber.App
+	cfg   config.Config
+	repos *repository.Repositories
+	// What the API was built with, the mailer is mail
+	services controllers.Services
+	mail     *mailbox
+	// Last TOTP counter used per secret, each one is accepted once
+	counters map[string]int64
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWith(t, testConfig())
+}
+
+// API running on fresh repositories with the config
+func newTestServerWith(t *testing.T, cfg config.Config) *testServer {
+	t.Helper()
+
+	mail := &mailbox{}
+	lockouts := &lockout.Lockout{
+		Store: lockout.NewMemoryStore(time.Minute),
+		Account: lockout.Policy{
+			FreeAttempts:    2,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+			Threshold:       5,
+			LockoutDuration: time.Minute,
+			Window:          time.Minute,
+		},
+		IP: lockout.Policy{
+			FreeAttempts:    1000,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			Threshold:       10000,
+			LockoutDuration: time.Minute,
+			Window:          time.Minute,
+		},
+	}
+
+	// No webhook url for the fake provider, the tests deliver the webhooks
+	// themselves
+	services := controllers.Services{
+		Keys:     testKeys,
+		Mailer:   mail,
+		Lockout:  lockouts,
+		Payments: payments.NewRegistry(payments.NewFakeProvider(testPaymentsSecret, "", 0)),
+	}
+
+	repos := repository.NewMemory()
+	app, _ := newApp(repos, services, middlewares.NewMemoryRateLimitStore(), cfg)
+
+	return &testServer{
+		t:        t,
+		app:      app,
+		cfg:      cfg,
+		repos:    repos,
+		services: services,
+		mail:     mail,
+		counters: map[string]int64{},
+	}
+}
+
+// Decoded response of the API
+type response struct {
+	t      *testing.T
+	status int
+	header http.Header
+	body   map[string]interface{}
+}
+
+// Builds a request with a JSON body, body may be nil or raw JSON as a string
+func (s *testServer) request(method string, path string, token string, body interface{}) *http.Request {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	case []byte:
+		reader = bytes.NewReader(body)
+	default:
+		payload, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	return req
+}
+
+func (s *testServer) send(req *http.Request) *response {
+	s.t.Helper()
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	r := &response{t: s.t, status: resp.StatusCode, header: resp.Header, body: map[string]interface{}{}}
+	if len(raw) > 0 && strings.HasPrefix(resp.Header.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		if err := json.Unmarshal(raw, &r.body); err != nil {
+			s.t.Fatalf("%s %s: decoding %q: %v", req.Method, req.URL.Path, raw, err)
+		}
+	}
+	return r
+}
+
+// Sends the request and decodes the response
+func (s *testServer) call(method string, path string, token string, body interface{}) *response {
+	s.t.Helper()
+	return s.send(s.request(method, path, token, body))
+}
+
+// Fails the test unless the response has the status
+func (r *response) expect(status int) *response {
+	r.t.Helper()
+	if r.status != status {
+		r.t.Fatalf("status %d, want %d: %v", r.status, status, r.body)
+	}
+	return r
+}
+
+// Fails the test unless the response is a success envelope with the status
+func (r *response) expectSuccess(status int) *response {
+	r.t.Helper()
+	r.expect(status)
+	if r.body["success"] != true {
+		r.t.Fatalf("success is %v, want true: %v", r.body["success"], r.body)
+	}
+	return r
+}
+
+// Fails the test unless the response is a failure envelope with the status
+// and, when not empty, the message
+func (r *response) expectFailure(status int, message string) *response {
+	r.t.Helper()
+	r.expect(status)
+	if r.body["success"] != false {
+		r.t.Fatalf("success is %v, want false: %v", r.body["success"], r.body)
+	}
+	if message != "" && r.body["message"] != message {
+		r.t.Fatalf("message %q, want %q", r.body["message"], message)
+	}
+	return r
+}
+
+// Fails the test unless the request was denied for missing the permission
+func (r *response) expectForbidden(permission string) *response {
+	r.t.Helper()
+	r.expectFailure(fiber.StatusForbidden, "Forbidden")
+	if r.body["permission"] != permission {
+		r.t.Fatalf("permission %v, want %s", r.body["permission"], permission)
+	}
+	return r
+}
+
+// Value at the dotted path of the body, like "data.items"
+func (r *response) get(path string) interface{} {
+	r.t.Helper()
+
+	var value interface{} = r.body
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			r.t.Fatalf("no %s in %v", path, r.body)
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func (r *response) str(path string) string {
+	r.t.Helper()
+	value, ok := r.get(path).(string)
+	if !ok {
+		r.t.Fatalf("%s is not a string in %v", path, r.body)
+	}
+	return value
+}
+
+func (r *response) num(path string) int64 {
+	r.t.Helper()
+	value, ok := r.get(path).(float64)
+	if !ok {
+		r.t.Fatalf("%s is not a number in %v", path, r.body)
+	}
+	return int64(value)
+}
+
+func (r *response) list(path string) []interface{} {
+	r.t.Helper()
+	value, ok := r.get(path).([]interface{})
+	if !ok {
+		r.t.Fatalf("%s is not a list in %v", path, r.body)
+	}
+	return value
+}
+
+// An account of the API with its current session
+type account struct {
+	ID           string
+	Username     string
+	Password     string
+	Email        string
+	Token        string
+	RefreshToken string
+}
+
+func (s *testServer) register(username string) *account {
+	s.t.Helper()
+
+	a := &account{Username: username, Password: testPassword, Email: username + "@example.com"}
+	res := s.call("POST", "/api/auth/register", "", fiber.Map{
+		"username":  a.Username,
+		"password":  a.Password,
+		"email":     a.Email,
+		"full_name": username,
+	}).expectSuccess(fiber.StatusCreated)
+	a.ID = res.str("data.InsertedID")
+	return a
+}
+
+// Registers a user and logs them in
+func (s *testServer) registerUser(username string) *account {
+	s.t.Helper()
+
+	a := s.register(username)
+	s.login(a)
+	return a
+}
+
+// Registers a user, confirms their email from the verification email and logs
+// them in
+func (s *testServer) verifiedUser(username string) *account {
+	s.t.Helper()
+
+	a := s.register(username)
+	token := linkToken(s.t, s.mail.wait(s.t, a.Email, 1))
+	s.call("POST", "/api/auth/verify-email", "", fiber.Map{"token": token}).expectSuccess(fiber.StatusOK)
+	s.login(a)
+	return a
+}
+
+// Creates an admin in the repository, there is no endpoint for it, and logs
+// them in
+func (s *testServer) createAdmin(username string) *account {
+	s.t.Helper()
+
+	a := &account{Username: username, Password: testPassword, Email: username + "@example.com"}
+	hashed, err := utils.HashPassword(a.Password)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	admin := &models.Admin{Username: a.Username, Password: hashed, Email: a.Email}
+	if err := s.repos.Admins.Create(context.Background(), admin); err != nil {
+		s.t.Fatal(err)
+	}
+	a.ID = admin.ID.Hex()
+
+	s.loginAdmin(a)
+	return a
+}
+
+// Keeps the tokens of a successful login
+func (a *account) keepSession(r *response) {
+	r.t.Helper()
+	r.expectSuccess(fiber.StatusOK)
+	a.Token = r.str("data")
+	a.RefreshToken = r.str("refresh_token")
+}
+
+func (s *testServer) login(a *account) {
+	s.t.Helper()
+	a.keepSession(s.call("POST", "/api/auth/login", "", fiber.Map{"username": a.Username, "password": a.Password}))
+}
+
+func (s *testServer) loginAdmin(a *account) {
+	s.t.Helper()
+	a.keepSession(s.call("POST", "/api/auth/login-admin", "", fiber.Map{"username": a.Username, "password": a.Password}))
+}
+
+// Signs an access token with the claims, valid for the usual lifetime unless
+// the claims set exp
+func mintToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(testAccessTokenTTL).Unix()
+	}
+	if _, ok := claims["jti"]; !ok {
+		claims["jti"] = primitive.NewObjectID().Hex()
+	}
+	token, err := testKeys.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// Next code of the secret, every counter is only accepted once so the codes
+// move forward within the window the API accepts
+func (s *testServer) totpCode(secret string) string {
+	s.t.Helper()
+
+	current := totp.Counter(time.Now())
+	counter := current - 1
+	if last, ok := s.counters[secret]; ok && last >= counter {
+		counter = last + 1
+	}
+	if counter > current+1 {
+		s.t.Fatal("no TOTP code left in the accepted window")
+	}
+	s.counters[secret] = counter
+
+	code, err := totp.Code(secret, counter)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return code
+}
+
+// Creates a store owned by the verified user
+func (s *testServer) createStore(owner *account, name string) string {
+	s.t.Helper()
+	return s.call("POST", "/api/stores", owner.Token, fiber.Map{"name": name}).
+		expectSuccess(fiber.StatusCreated).
+		str("data.InsertedID")
+}
+
+// Creates an active product with the price and stock
+func (s *testServer) createProduct(owner *account, storeId string, sku string, price int64, stock int64) string {
+	s.t.Helper()
+	return s.call("POST", "/api/stores/"+storeId+"/products", owner.Token, fiber.Map{
+		"title":  "Product " + sku,
+		"sku":    sku,
+		"price":  price,
+		"stock":  stock,
+		"status": models.ProductStatusActive,
+	}).expectSuccess(fiber.StatusCreated).str("data.InsertedID")
+}
+
+// Puts the quantity of the product in the customer's cart and checks out
+func (s *testServer) placeOrder(customer *account, storeId string, productId string, quantity int64) string {
+	s.t.Helper()
+
+	s.call("POST", "/api/stores/"+storeId+"/cart/items", customer.Token, fiber.Map{
+		"product":  productId,
+		"quantity": quantity,
+	}).expectSuccess(fiber.StatusOK)
+
+	return s.call("POST", "/api/stores/"+storeId+"/orders", customer.Token, nil).
+		expectSuccess(fiber.StatusCreated).
+		str("data._id")
+}
+
+// Posts the event to the fake provider's webhook, signed like the provider
+// signs it
+func (s *testServer) webhook(event payments.Event) *response {
+	s.t.Helper()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testPaymentsSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	req := s.request("POST", "/api/payments/webhooks/fake", "", payload)
+	req.Header.Set("X-Fake-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return s.send(req)
+}
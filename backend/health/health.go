@@ -0,0 +1,109 @@
+// Package health tells whether the process can serve traffic: the checks of
+// its dependencies, the draining flag and the build it runs.
+package health
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Set at build time with -ldflags "-X .../backend/health.Version=v1.2.3"
+var Version = "dev"
+
+var started = time.Now()
+
+// Check returns an error when its dependency can't be used
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Name    string  `json:"name"`
+	Healthy bool    `json:"healthy"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	checks   = map[string]Check{}
+	draining int32
+)
+
+// Adds a check to the readiness, replacing the one with the same name
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Marks the process as shutting down, it stops being ready
+func SetDraining(value bool) {
+	var flag int32
+	if value {
+		flag = 1
+	}
+	atomic.StoreInt32(&draining, flag)
+}
+
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// Runs every check at the same time. The process is ready when they all pass
+// and it isn't draining.
+func Ready(ctx context.Context) (bool, []Result) {
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	results := make([]Result, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string, check Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			results[i] = Result{Name: name, Healthy: err == nil, Latency: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, name, checks[name])
+	}
+	mu.RUnlock()
+	wg.Wait()
+
+	ready := !Draining()
+	for _, result := range results {
+		ready = ready && result.Healthy
+	}
+	return ready, results
+}
+
+func Uptime() time.Duration {
+	return time.Since(started)
+}
+
+// Go version and version control details of the binary
+func BuildInfo() map[string]string {
+	info := map[string]string{"version": Version}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info["go_version"] = build.GoVersion
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			info[setting.Key] = setting.Value
+		}
+	}
+	return info
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/health"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+)
+
+func TestProbes(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+
+	s.call("GET", "/", "", nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", "/healthz", "", nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", "/readyz", "", nil).expectSuccess(fiber.StatusOK)
+
+	// Draining instances stop getting traffic but stay alive
+	health.SetDraining(true)
+	defer health.SetDraining(false)
+
+	res := s.call("GET", "/readyz", "", nil).expectFailure(fiber.StatusServiceUnavailable, "")
+	if failing := res.list("failing"); len(failing) != 1 || failing[0] != "draining" {
+		t.Fatalf("unexpected readiness %v", res.body)
+	}
+	s.call("GET", "/healthz", "", nil).expectSuccess(fiber.StatusOK)
+}
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+
+	req := s.request("GET", "/healthz", "", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "test-request-1")
+	if res := s.send(req).expect(fiber.StatusOK); res.header.Get(fiber.HeaderXRequestID) != "test-request-1" {
+		t.Fatalf("request id not kept: %v", res.header)
+	}
+
+	if res := s.call("GET", "/healthz", "", nil); res.header.Get(fiber.HeaderXRequestID) == "" {
+		t.Fatal("no request id")
+	}
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.RateLimits.Auth = "2/1m"
+	s := newTestServerWith(t, cfg)
+
+	login := fiber.Map{"username": "nobody", "password": testPassword}
+	s.call("POST", "/api/auth/login", "", login).expect(fiber.StatusUnauthorized)
+	s.call("POST", "/api/auth/login", "", login).expect(fiber.StatusUnauthorized)
+	s.call("POST", "/api/auth/login", "", login).expect(fiber.StatusTooManyRequests)
+
+	// Only the attempts let through are audited
+	entries, err := s.repos.Audit.List(context.Background(), repository.AuditFilter{}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d audit entries, want the 2 failed logins: %+v", len(entries), entries)
+	}
+
+	// The other groups have their own budget
+	s.call("GET", "/api/stores/000000000000000000000000", "", nil).expect(fiber.StatusNotFound)
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	t.Parallel()
+	login := func(s *testServer, ip string) *response {
+		req := s.request("POST", "/api/auth/login", "", fiber.Map{"username": "nobody", "password": testPassword})
+		req.Header.Set("X-Real-IP", ip)
+		return s.send(req)
+	}
+
+	// Each client of a trusted proxy has its own budget
+	cfg := testConfig()
+	cfg.RateLimits.Auth = "1/1m"
+	cfg.HTTP.ProxyHeader = "X-Real-IP"
+	cfg.HTTP.TrustedProxies = []string{"0.0.0.0/0"}
+	s := newTestServerWith(t, cfg)
+	login(s, "203.0.113.1").expect(fiber.StatusUnauthorized)
+	login(s, "203.0.113.2").expect(fiber.StatusUnauthorized)
+	login(s, "203.0.113.1").expect(fiber.StatusTooManyRequests)
+
+	// Anyone else can't pick their IP with the header
+	cfg.HTTP.TrustedProxies = []string{"192.0.2.0/24"}
+	s = newTestServerWith(t, cfg)
+	login(s, "203.0.113.1").expect(fiber.StatusUnauthorized)
+	login(s, "203.0.113.2").expect(fiber.StatusTooManyRequests)
+}
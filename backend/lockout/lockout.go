@@ -0,0 +1,148 @@
+// Package lockout slows down and then temporarily blocks login attempts after
+// repeated failures, per account and per IP address.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Failed attempts of a key
+type Counter struct {
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"last_failure"`
+}
+
+// Store keeps the counters, shared between instances when backed by a database
+type Store interface {
+	// Adds a failure, starting over when the last one is older than window
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error)
+	Get(ctx context.Context, key string) (Counter, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// How failures of a key are punished
+type Policy struct {
+	// Failures allowed without any delay
+	FreeAttempts int
+	// Delay after the first failure past the free attempts, doubled with every
+	// failure after it
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Failures locking the key for LockoutDuration
+	Threshold       int
+	LockoutDuration time.Duration
+	// Failures older than this are forgotten
+	Window time.Duration
+}
+
+// How long the key has to wait before the next attempt, zero if it can go on
+func (p Policy) Wait(counter Counter, now time.Time) time.Duration {
+	if counter.Failures == 0 || now.Sub(counter.LastFailure) > p.Window {
+		return 0
+	}
+
+	var delay time.Duration
+	if p.Threshold > 0 && counter.Failures >= p.Threshold {
+		delay = p.LockoutDuration
+	} else if counter.Failures > p.FreeAttempts {
+		delay = p.BaseDelay << (counter.Failures - p.FreeAttempts - 1)
+		if delay > p.MaxDelay || delay <= 0 {
+			delay = p.MaxDelay
+		}
+	}
+
+	if wait := counter.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+type Lockout struct {
+	Store   Store
+	Account Policy
+	IP      Policy
+}
+
+func AccountKey(accountType string, username string) string {
+	return "account:" + accountType + ":" + strings.ToLower(username)
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// How long the attempt on the account from the IP has to wait, zero if it can
+// go on
+func (l *Lockout) Check(ctx context.Context, account string, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	accountCounter, err := l.Store.Get(ctx, account)
+	if err != nil {
+		return 0, err
+	}
+	ipCounter, err := l.Store.Get(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	wait := l.Account.Wait(accountCounter, now)
+	if ipWait := l.IP.Wait(ipCounter, now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait, nil
+}
+
+// Records a failed attempt and returns the keys it just locked
+func (l *Lockout) Fail(ctx context.Context, account string, ip string) ([]string, error) {
+	now := time.Now()
+	locked := []string{}
+
+	accountCounter, err := l.Store.Fail(ctx, account, now, l.Account.Window)
+	if err != nil {
+		return nil, err
+	}
+	if l.Account.Threshold > 0 && accountCounter.Failures == l.Account.Threshold {
+		locked = append(locked, account)
+	}
+
+	ipCounter, err := l.Store.Fail(ctx, ip, now, l.IP.Window)
+	if err != nil {
+		return nil, err
+	}
+	if l.IP.Threshold > 0 && ipCounter.Failures == l.IP.Threshold {
+		locked = append(locked, ip)
+	}
+
+	return locked, nil
+}
+
+// Forgets the failures of the account after a successful login
+func (l *Lockout) Succeed(ctx context.Context, account string) error {
+	return l.Store.Reset(ctx, account)
+}
+
+// Lifts the lockout of an account or IP key
+func (l *Lockout) Unlock(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+// Whether the key is locked out right now, not just slowed down
+func (l *Lockout) Locked(ctx context.Context, key string) (bool, time.Time, error) {
+	policy := l.Account
+	if strings.HasPrefix(key, "ip:") {
+		policy = l.IP
+	}
+
+	counter, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if policy.Threshold == 0 || counter.Failures < policy.Threshold {
+		return false, time.Time{}, nil
+	}
+
+	until := counter.LastFailure.Add(policy.LockoutDuration)
+	return until.After(time.Now()), until, nil
+}
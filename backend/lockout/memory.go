@@ -0,0 +1,59 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the counters in the process, for a single instance
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+	// Counters untouched for this long are dropped
+	ttl time.Duration
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{counters: map[string]Counter{}, ttl: ttl}
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+
+	counter := s.counters[key]
+	if now.Sub(counter.LastFailure) > window {
+		counter.Failures = 0
+	}
+	counter.Failures++
+	counter.LastFailure = now
+	s.counters[key] = counter
+
+	return counter, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[key], nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	for key, counter := range s.counters {
+		if now.Sub(counter.LastFailure) > s.ttl {
+			delete(s.counters, key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the counters in a collection so every instance sees the
+// same failures. Documents are keyed by the counter key and carry expires_at,
+// the end of their window, for a TTL index to delete them.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	// Single atomic update, starting over when the last failure is too old
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$lt": bson.A{"$last_failure", now.Add(-window)}},
+				1,
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+			}},
+			"last_failure": now,
+			"expires_at":   now.Add(window),
+		}}},
+	}
+
+	var counter Counter
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, findOptions).Decode(&counter)
+	return counter, err
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string) (Counter, error) {
+	var counter Counter
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&counter)
+	if err == mongo.ErrNoDocuments {
+		return Counter{}, nil
+	}
+	return counter, err
+}
+
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
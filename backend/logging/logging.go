@@ -0,0 +1,213 @@
+// Package logging writes structured JSON logs, one object per line.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	}
+	return "error"
+}
+
+// Reads a level name as set in LOG_LEVEL
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("logging: unknown level %q", name)
+}
+
+// Output shared by a logger and the loggers derived from it
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Logger writes entries at or above its level with its fields attached. The
+// fields of a call are key value pairs, errors are written as their message.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []interface{}
+}
+
+// Logger used outside of requests and by requests without their own
+var Default = New(os.Stdout, LevelInfo)
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level}
+}
+
+// Settings of the logger, loaded by the config package
+type Config struct {
+	// debug, info, warn or error
+	Level string `yaml:"level"`
+	// stdout, stderr or the path of a file to append to
+	Output string `yaml:"output"`
+}
+
+// Builds the configured logger
+func Open(config Config) (*Logger, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	switch output := config.Output; output {
+	case "", "stdout":
+		return New(os.Stdout, level), nil
+	case "stderr":
+		return New(os.Stderr, level), nil
+	default:
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("logging: %w", err)
+		}
+		return New(file, level), nil
+	}
+}
+
+// Logger with more fields on every entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{out: l.out, level: l.level, fields: fields}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.Log(LevelDebug, msg, keyvals...) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.Log(LevelInfo, msg, keyvals...) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.Log(LevelWarn, msg, keyvals...) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.Log(LevelError, msg, keyvals...) }
+
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeValue(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, msg)
+	writeFields(&buf, l.fields)
+	writeFields(&buf, keyvals)
+	buf.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+func writeFields(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		buf.WriteByte(',')
+		writeValue(buf, key)
+		buf.WriteByte(':')
+		writeValue(buf, value)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case json.Marshaler:
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
+
+// Writer logging every write as an info entry, to route the standard log
+// package through the logger
+func (l *Logger) Writer() io.Writer {
+	return writer{l}
+}
+
+type writer struct {
+	logger *Logger
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+type contextKey struct{}
+
+// Context carrying the logger
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Logger of the context, the default one if it has none
+func FromContext(ctx context.Context) *Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return logger
+	}
+	return Default
+}
+
+// Logger of the request, with its request id and account
+func Ctx(c *fiber.Ctx) *Logger {
+	return FromContext(c.UserContext())
+}
+
+// Replaces the logger of the request
+func SetCtx(c *fiber.Ctx, logger *Logger) {
+	c.SetUserContext(NewContext(c.UserContext(), logger))
+}
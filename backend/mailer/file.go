@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes every message to its own .eml file in a directory, so
+// development setups and tests can pick the links out of them
+type FileMailer struct {
+	mu  sync.Mutex
+	dir string
+	n   int
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.n++
+	now := time.Now()
+	name := fmt.Sprintf("%s-%04d.eml", now.Format("20060102T150405"), m.n)
+	content := fmt.Sprintf("Date: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		now.Format(time.RFC1123Z), message.To, message.Subject, message.Body)
+
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644)
+}
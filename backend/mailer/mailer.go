@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by every way of delivering emails
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Settings of the mailer, loaded by the config package
+type Config struct {
+	// "log" prints the messages, "file" writes them to Dir and "smtp" sends
+	// them through SMTPHost:SMTPPort
+	Mailer       string `yaml:"mailer"`
+	Dir          string `yaml:"dir"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	// Sender of the messages
+	From string `yaml:"from"`
+}
+
+const (
+	MailerLog  = "log"
+	MailerFile = "file"
+	MailerSMTP = "smtp"
+)
+
+// Builds the mailer of the config
+func New(config Config) (Mailer, error) {
+	switch config.Mailer {
+	case "", MailerLog:
+		return NewLogMailer(os.Stdout), nil
+	case MailerFile:
+		return NewFileMailer(config.Dir)
+	case MailerSMTP:
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(config.SMTPHost, config.SMTPPort),
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.From,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("mailer: unknown mailer %q", config.Mailer)
+}
+
+// LogMailer writes the messages to an output instead of sending them, for
+// development and tests
+type LogMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogMailer(out io.Writer) *LogMailer {
+	return &LogMailer{out: out}
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "----- email %s -----\nTo: %s\nSubject: %s\n\n%s\n-----\n",
+		time.Now().Format(time.RFC3339), message.To, message.Subject, message.Body)
+	return err
+}
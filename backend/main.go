@@ -2,76 +2,286 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/joho/godotenv"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/auth"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
-	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/health"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/lockout"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/mailer"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/metrics"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/routes"
-	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/tracing"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-// If there's no admin (first setup) ask for an admin
-func setupAdminIfNotExist() {
-	// Check if there is already an admin
-	adminsCollection := config.MI.DB.Collection("admins")
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
-	countAdmins, _ := adminsCollection.CountDocuments(ctx, fiber.Map{})
-
-	// No admins ask for one to be created
-	if countAdmins == 0 {
-		var answer string
-		fmt.Println("WARRNING: There is no admin, configure a new admin ?")
-		fmt.Scan(&answer)
-
-		if strings.ToUpper(answer) == "Y" {
-			admin := new(models.Admin)
-			fmt.Println("Enter the admin's username:")
-			fmt.Scan(&answer)
-			admin.Username = answer
-
-			fmt.Println("Enter the admin's password:")
-			fmt.Scan(&answer)
-			hashed, err := utils.HashPassword(answer)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error hashing password")
-				os.Exit(1)
-			}
-			admin.Password = hashed
+// JSON logs with the configured level and output, the standard log package
+// included
+func setupLogging(cfg logging.Config) {
+	logger, err := logging.Open(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.Default = logger
+
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer())
+}
+
+// Export the request spans
+func setupTracing(cfg tracing.Config) {
+	if err := tracing.Init(context.Background(), cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Load the token signing keys
+func setupAuth(cfg auth.Config) *auth.KeySet {
+	keys, err := auth.NewKeySet(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return keys
+}
+
+// Choose how emails are delivered
+func setupMailer(cfg mailer.Config) mailer.Mailer {
+	m, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+// Slow down and block password guessing
+func setupLockout(cfg config.Lockout) *lockout.Lockout {
+	lockoutDuration := cfg.Duration
+
+	var store lockout.Store
+	if cfg.Store == config.StoreMemory {
+		store = lockout.NewMemoryStore(lockoutDuration)
+	} else {
+		store = lockout.NewMongoStore(config.MI.DB.Collection("login_attempts"))
+	}
+
+	return &lockout.Lockout{
+		Store: store,
+		Account: lockout.Policy{
+			FreeAttempts:    2,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+			Threshold:       cfg.Threshold,
+			LockoutDuration: lockoutDuration,
+			Window:          lockoutDuration,
+		},
+		IP: lockout.Policy{
+			FreeAttempts:    10,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			Threshold:       cfg.IPThreshold,
+			LockoutDuration: lockoutDuration,
+			Window:          lockoutDuration,
+		},
+	}
+}
+
+// Register the payment providers
+func setupPayments(cfg config.Payments, http config.HTTP) *payments.Registry {
+	registry := payments.NewRegistry()
+
+	fake := cfg.Fake
+	if !fake.Enabled {
+		return registry
+	}
+
+	webhookURL := fake.WebhookURL
+	if webhookURL == "" {
+		webhookURL = "http://localhost:" + http.Port + "/api/payments/webhooks/fake"
+	}
 
-			fmt.Println("Enter the admin's email:")
-			fmt.Scan(&answer)
-			admin.Email = answer
+	registry.Register(payments.NewFakeProvider(fake.Secret, webhookURL, fake.Delay))
+	return registry
+}
+
+// Dependencies checked by the readiness probe
+func setupHealth() {
+	health.Register("mongo", func(ctx context.Context) error {
+		return config.MI.Client.Ping(ctx, readpref.Primary())
+	})
+}
 
-			result, err := adminsCollection.InsertOne(ctx, admin)
-			if err != nil {
-				fmt.Println("Error inserting the new admin to the database")
-				fmt.Println("Details: ", err)
-				os.Exit(2)
+// Periodically give back the stock of unpaid orders. The returned func stops
+// the sweeper once the sweep in progress is done.
+func startReservationSweeper(h *controllers.Handler) func() {
+	ticker := time.NewTicker(time.Minute)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ticker.C:
+				h.ReleaseExpiredReservations()
+			case <-stop:
+				return
 			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(stop)
+		<-done
+	}
+}
+
+// Where the rate limit counters live, Mongo to share them between instances
+func setupRateLimits(cfg config.RateLimits) middlewares.RateLimitStore {
+	if cfg.Store == config.StoreMongo {
+		return middlewares.NewMongoRateLimitStore(config.MI.DB.Collection("rate_limits"))
+	}
+	return middlewares.NewMemoryRateLimitStore()
+}
+
+// Serve the metrics on their own port, or with the API when it isn't set. The
+// metrics server is returned when there is one.
+func setupMetrics(app *fiber.App, cfg config.HTTP) *http.Server {
+	port := cfg.MetricsPort
+	if port == "" {
+		app.Get("/metrics", metrics.Handler())
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.HTTPHandler())
+	server := &http.Server{Addr: ":" + port, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("metrics: ", err)
+		}
+	}()
+	return server
+}
+
+// Stops accepting connections and waits for the requests in flight, giving up
+// after the timeout. Fiber v2.32 has no ShutdownWithTimeout of its own.
+func shutdownWithTimeout(app *fiber.App, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Shutdown()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("requests still running after %s", timeout)
+	}
+}
+
+// Runs the func, giving up when the context is done
+func waitOrDone(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Takes the instance out of rotation, lets the requests in flight finish and
+// releases everything it holds. The drain delay is how long it keeps serving
+// while failing the readiness probe, the shutdown timeout how long the
+// requests and the background work get to finish, all together.
+func shutdown(cfg config.HTTP, app *fiber.App, h *controllers.Handler, providers *payments.Registry, metricsServer *http.Server, stopSweeper func()) {
+	logger := logging.Default
+
+	// Fail the readiness probe so the load balancer stops sending traffic
+	health.SetDraining(true)
+	logger.Info("draining")
+	time.Sleep(cfg.DrainDelay)
+
+	// One deadline shared by every step
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
 
-			// Success
-			fmt.Println("Admin created with success")
-			fmt.Println(result.InsertedID)
+	// Requests in flight
+	if err := shutdownWithTimeout(app, time.Until(deadline)); err != nil {
+		logger.Error("shutting down the server", "error", err)
+	}
 
-		} else {
-			fmt.Println("there's nothing to do")
-			os.Exit(0)
+	// Background workers
+	if err := waitOrDone(ctx, stopSweeper); err != nil {
+		logger.Error("stopping the reservation sweeper", "error", err)
+	}
+	if err := waitOrDone(ctx, h.Wait); err != nil {
+		logger.Error("waiting for the background work of the handlers", "error", err)
+	}
+	if err := waitOrDone(ctx, providers.Wait); err != nil {
+		logger.Error("waiting for the payment webhooks", "error", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			logger.Error("shutting down the metrics server", "error", err)
 		}
 	}
+	if err := tracing.Shutdown(ctx); err != nil {
+		logger.Error("flushing the traces", "error", err)
+	}
+
+	// Database last, the workers above may still use it
+	if err := config.MI.Client.Disconnect(ctx); err != nil {
+		logger.Error("disconnecting from the database", "error", err)
+	}
+
+	logger.Info("stopped")
+}
 
+// Settings of the handlers
+func appConfig(cfg config.App) controllers.Config {
+	return controllers.Config{
+		URL:                  cfg.URL,
+		AccessTokenTTL:       cfg.AccessTokenTTL,
+		RefreshTokenTTL:      cfg.RefreshTokenTTL,
+		EmailVerificationTTL: cfg.EmailVerificationTTL,
+		PasswordResetTTL:     cfg.PasswordResetTTL,
+		InviteTTL:            cfg.InviteTTL,
+		ReservationTTL:       cfg.ReservationTTL,
+		TOTPIssuer:           cfg.TOTPIssuer,
+		PaymentProvider:      cfg.PaymentProvider,
+	}
 }
 
-// Setup the routes by grouping them
-func setupRoutes(app *fiber.App) {
+// Setup the routes by grouping them, the handler serving them is returned
+func setupRoutes(app *fiber.App, repos *repository.Repositories, services controllers.Services, rateLimits middlewares.RateLimitStore, cfg config.Config) *controllers.Handler {
+	m := middlewares.NewAuth(repos, services.Keys)
+	h := controllers.New(repos, m, services, appConfig(cfg.App))
+
+	// Who is calling, for the logs, the audit and the rate limits
+	app.Use(m.Identify())
+
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"success": true,
@@ -79,38 +289,177 @@ func setupRoutes(app *fiber.App) {
 		})
 	})
 
-	api := app.Group("/api")
+	// Probes
+	routes.HealthRoutes(app)
 
-	routes.UsersRoute(api.Group("/users"))
-	routes.AuthRoutes(api.Group("/auth"))
-	routes.StoresRoutes(api.Group("/stores"))
-}
+	// Public keys of the access tokens
+	app.Get("/.well-known/jwks.json", h.GetJWKS)
 
-func main() {
-	config.ConnectDB()
+	// The rates were checked when the config was loaded
+	rates := cfg.RateLimits
 
-	setupAdminIfNotExist()
+	// Password guessing gets a small budget per IP
+	authLimit, authPeriod, _ := config.ParseRate(rates.Auth)
+	authRateLimit := middlewares.RateLimit(middlewares.RateLimitPolicy{
+		Name:      "auth",
+		Algorithm: middlewares.SlidingWindow{Max: authLimit, Window: authPeriod},
+		Key:       middlewares.RateLimitByIP,
+		Store:     rateLimits,
+	})
 
-	if os.Getenv("APP_ENV") != "production" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Fatal("Error loading .env file")
-		}
-	}
+	// Everything else per account, bursts allowed
+	apiLimit, apiPeriod, _ := config.ParseRate(rates.API)
+	apiRateLimit := middlewares.RateLimit(middlewares.RateLimitPolicy{
+		Name:      "api",
+		Algorithm: middlewares.TokenBucket{Capacity: apiLimit, Period: apiPeriod},
+		Key:       middlewares.RateLimitByUser,
+		Store:     rateLimits,
+	})
+
+	// Storefront reads per store so one busy store can't starve the others
+	storefrontLimit, storefrontPeriod, _ := config.ParseRate(rates.Storefront)
+	storefrontRateLimit := middlewares.RateLimit(middlewares.RateLimitPolicy{
+		Name:      "storefront",
+		Algorithm: middlewares.SlidingWindow{Max: storefrontLimit, Window: storefrontPeriod},
+		Key:       middlewares.RateLimitByStore,
+		Store:     rateLimits,
+		Skip: func(c *fiber.Ctx) bool {
+			return c.Method() != fiber.MethodGet
+		},
+	})
+
+	// Every change is audited, after the rate limits so the requests they
+	// reject can't flood the log
+	auditLog := middlewares.Audit(repos.Audit, repos.Snapshots)
+	api := app.Group("/api")
+
+	stores := api.Group("/stores", apiRateLimit, auditLog)
+	stores.Use("/:storeId/products", storefrontRateLimit)
+
+	routes.UsersRoute(api.Group("/users", apiRateLimit, auditLog), h, m)
+	routes.AuthRoutes(api.Group("/auth", authRateLimit, auditLog), h, m)
+	routes.StoresRoutes(stores, h, m)
+	routes.OrdersRoutes(api.Group("/orders", apiRateLimit, auditLog), h, m)
+	routes.PaymentsRoutes(api.Group("/payments", apiRateLimit, auditLog), h, m)
+	routes.RolesRoutes(api.Group("/roles", apiRateLimit, auditLog), h, m)
+	routes.InvitesRoutes(api.Group("/invites", apiRateLimit, auditLog), h, m)
+	routes.SettingsRoutes(api.Group("/settings", apiRateLimit, auditLog), h, m)
+	routes.LockoutsRoutes(api.Group("/lockouts", apiRateLimit, auditLog), h, m)
+	routes.AuditRoutes(api.Group("/audit", apiRateLimit, auditLog), h, m)
+	routes.StatusRoutes(api.Group("/status", apiRateLimit, auditLog), m)
+
+	return h
+}
 
+// The API served from the repositories and services, the handler serving it is
+// returned
+func newApp(repos *repository.Repositories, services controllers.Services, rateLimits middlewares.RateLimitStore, cfg config.Config) (*fiber.App, *controllers.Handler) {
+	// c.IP() is the proxy header only on requests from the trusted proxies
 	app := fiber.New(fiber.Config{
-		Prefork: false,
+		Prefork:                 false,
+		ProxyHeader:             cfg.HTTP.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.HTTP.TrustedProxies,
 	})
 
 	app.Use(cors.New())
-	app.Use(logger.New())
+	app.Use(middlewares.RequestID())
+	app.Use(middlewares.Tracing())
+	app.Use(middlewares.Logger())
+	app.Use(middlewares.Metrics())
+
+	h := setupRoutes(app, repos, services, rateLimits, cfg)
+	return app, h
+}
+
+const usage = `Usage: server [flags] [command]
 
-	setupRoutes(app)
+Commands:
+  serve                serve the API, the default
+  migrate [up|status]  apply the pending migrations, or list them
+  admin <command>      create, list, reset the password of or delete admins
 
-	port := os.Getenv("PORT")
-	err := app.Listen(":" + port)
+Flags:`
+
+func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, usage)
+		config.Usage(os.Stderr)
+		return
+	}
 	if err != nil {
-		log.Fatal("Error app failed to start")
-		panic(err)
+		log.Fatal(err)
+	}
+
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if command != "serve" && command != "migrate" && command != "admin" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s\n", command, usage)
+		config.Usage(os.Stderr)
+		os.Exit(2)
+	}
+	if command == "admin" && adminHelp(args) {
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return
+	}
+
+	setupLogging(cfg.Logging)
+	if err := config.ConnectDB(cfg.Database); err != nil {
+		log.Fatal(err)
+	}
+	repos := repository.NewMongo(config.MI.DB)
+
+	switch command {
+	case "migrate":
+		runMigrate(cfg.Migrations, args)
+	case "admin":
+		// The admin commands only need the repositories
+		h := controllers.New(repos, middlewares.NewAuth(repos, nil), controllers.Services{}, appConfig(cfg.App))
+		if err := runAdmin(repos, h, args); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	default:
+		serve(cfg, repos)
+	}
+}
+
+// Serves the API until asked to stop, a second signal stops at once
+func serve(cfg config.Config, repos *repository.Repositories) {
+	logging.Default.Info("config loaded", "config", cfg)
+
+	setupMigrations(cfg.Migrations)
+	bootstrapAdmin(cfg.AdminBootstrap, repos.Admins)
+
+	setupTracing(cfg.Tracing)
+	services := controllers.Services{
+		Keys:     setupAuth(cfg.Auth),
+		Mailer:   setupMailer(cfg.Mail),
+		Lockout:  setupLockout(cfg.Lockout),
+		Payments: setupPayments(cfg.Payments, cfg.HTTP),
 	}
+	rateLimits := setupRateLimits(cfg.RateLimits)
+	setupHealth()
+
+	app, h := newApp(repos, services, rateLimits, cfg)
+	metricsServer := setupMetrics(app, cfg.HTTP)
+	stopSweeper := startReservationSweeper(h)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		err := app.Listen(":" + cfg.HTTP.Port)
+		if err != nil {
+			log.Fatal("Error app failed to start: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	shutdown(cfg.HTTP, app, h, services.Payments, metricsServer, stopSweeper)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInviteAndManageMembers(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	eve := s.registerUser("eve")
+	storeId := s.createStore(bob, "Bob's shop")
+	invites := "/api/stores/" + storeId + "/invites"
+	members := "/api/stores/" + storeId + "/members"
+
+	invite := fiber.Map{"email": alice.Email, "role": "store_manager"}
+	s.call("POST", invites, alice.Token, invite).expectForbidden("member:invite")
+	s.call("POST", invites, bob.Token, fiber.Map{"email": alice.Email, "role": "store_owner"}).
+		expectFailure(fiber.StatusBadRequest, "Role must be one of store_manager, store_fulfillment, store_read_only")
+	s.call("POST", invites, bob.Token, invite).expectSuccess(fiber.StatusCreated)
+
+	res := s.call("GET", invites, bob.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 1 {
+		t.Fatalf("unexpected invites %v", res.body)
+	}
+
+	// Only the invited address can accept
+	token := linkToken(t, s.mail.wait(t, alice.Email, 2))
+	s.call("POST", "/api/invites/accept", "", fiber.Map{"token": token}).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("POST", "/api/invites/accept", eve.Token, fiber.Map{"token": token}).
+		expectFailure(fiber.StatusNotFound, "Invalid or expired invite")
+	s.call("POST", "/api/invites/accept", alice.Token, fiber.Map{"token": token}).expectSuccess(fiber.StatusOK)
+	s.call("POST", "/api/invites/accept", alice.Token, fiber.Map{"token": token}).
+		expectFailure(fiber.StatusNotFound, "Invalid or expired invite")
+
+	// Managers run the store but don't manage the staff
+	s.createProduct(alice, storeId, "MUG-1", 1200, 3)
+	res = s.call("GET", members, alice.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 2 {
+		t.Fatalf("unexpected members %v", res.body)
+	}
+	s.call("PATCH", members+"/"+alice.ID, alice.Token, fiber.Map{"role": "store_read_only"}).expectForbidden("member:update")
+	s.call("GET", members, eve.Token, nil).expectForbidden("member:list")
+
+	s.call("PATCH", members+"/"+alice.ID, bob.Token, fiber.Map{"role": "store_read_only"}).expectSuccess(fiber.StatusOK)
+	s.call("POST", "/api/stores/"+storeId+"/products", alice.Token, fiber.Map{"title": "Cup", "sku": "CUP-1"}).
+		expectForbidden("product:create")
+	s.call("PATCH", members+"/"+primitive.NewObjectID().Hex(), bob.Token, fiber.Map{"role": "store_read_only"}).
+		expectFailure(fiber.StatusNotFound, "Member not found")
+
+	// Owners stay
+	s.call("DELETE", members+"/"+bob.ID, bob.Token, nil).expectFailure(fiber.StatusNotFound, "Member not found")
+	s.call("DELETE", members+"/"+alice.ID, alice.Token, nil).expectForbidden("member:remove")
+	s.call("DELETE", members+"/"+alice.ID, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", members, alice.Token, nil).expectForbidden("member:list")
+}
+
+func TestDeclineAndRevokeInvites(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	invites := "/api/stores/" + storeId + "/invites"
+
+	s.call("POST", invites, bob.Token, fiber.Map{"email": alice.Email, "role": "store_fulfillment"}).expectSuccess(fiber.StatusCreated)
+	token := linkToken(t, s.mail.wait(t, alice.Email, 2))
+
+	// Declining needs nothing but the token
+	s.call("POST", "/api/invites/decline", "", fiber.Map{"token": "bogus"}).expectFailure(fiber.StatusNotFound, "Invalid or expired invite")
+	s.call("POST", "/api/invites/decline", "", fiber.Map{"token": token}).expectSuccess(fiber.StatusOK)
+	s.call("POST", "/api/invites/accept", alice.Token, fiber.Map{"token": token}).
+		expectFailure(fiber.StatusNotFound, "Invalid or expired invite")
+
+	inviteId := s.call("POST", invites, bob.Token, fiber.Map{"email": alice.Email, "role": "store_fulfillment"}).
+		expectSuccess(fiber.StatusCreated).
+		str("data._id")
+	token = linkToken(t, s.mail.wait(t, alice.Email, 3))
+
+	s.call("DELETE", invites+"/"+inviteId, alice.Token, nil).expectForbidden("member:invite")
+	s.call("DELETE", invites+"/"+inviteId, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("DELETE", invites+"/"+inviteId, bob.Token, nil).expectFailure(fiber.StatusNotFound, "Invite not found")
+	s.call("POST", "/api/invites/accept", alice.Token, fiber.Map{"token": token}).
+		expectFailure(fiber.StatusNotFound, "Invalid or expired invite")
+
+	if res := s.call("GET", invites, bob.Token, nil).expect(fiber.StatusOK); res.num("total") != 0 {
+		t.Fatalf("unexpected invites %v", res.body)
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Command monitor timing every MongoDB command of the client it's set on
+func MongoMonitor() *event.CommandMonitor {
+	// Collections of the commands in flight by request id
+	var started sync.Map
+
+	finished := func(requestID int64, command string, outcome string, duration time.Duration) {
+		collection, ok := started.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		MongoDuration.WithLabelValues(collection.(string), command, outcome).Observe(duration.Seconds())
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			// The first element of a command names its collection
+			collection := ""
+			if elements, err := e.Command.Elements(); err == nil && len(elements) > 0 {
+				collection, _ = elements[0].Value().StringValueOK()
+			}
+			started.Store(e.RequestID, collection)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finished(e.RequestID, e.CommandName, "success", time.Duration(e.DurationNanos))
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finished(e.RequestID, e.CommandName, "failure", time.Duration(e.DurationNanos))
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package middlewares
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/audit"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Writes an audit entry for every request that may change something, with the
+// target and its states described by the handler through audit.Target and
+// read from the source
+func Audit(log audit.Log, source audit.Source) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		audit.Begin(c, source)
+		err := c.Next()
+
+		// Attempts refused for coming too fast changed nothing, and would let
+		// anyone flood the log
+		status := responseStatus(c, err)
+		if status == fiber.StatusTooManyRequests {
+			return err
+		}
+
+		entry := models.AuditEntry{
+			ActorType: models.ActorTypeAnonymous,
+			Action:    c.Method() + " " + c.Route().Path,
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Status:    status,
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+			RequestID: audit.RequestID(c),
+		}
+
+		// Actor
+		claims := bearerClaims(c)
+		if adminId, ok := claims["admin_id"].(string); ok {
+			entry.ActorType = models.ActorTypeAdmin
+			entry.Actor, _ = primitive.ObjectIDFromHex(adminId)
+		} else if userId, ok := claims["user_id"].(string); ok {
+			entry.ActorType = models.ActorTypeUser
+			entry.Actor, _ = primitive.ObjectIDFromHex(userId)
+		}
+
+		// Target and its states
+		if change, ok := audit.Lookup(c); ok {
+			if change.Action != "" {
+				entry.Action = change.Action
+			}
+			entry.TargetType = change.TargetType
+			entry.Target = change.Target
+			entry.Details = change.Details
+			entry.Before = change.Before
+			entry.After = change.After()
+			entry.Changes = audit.Diff(entry.Before, entry.After)
+
+			// Found by another field than its id
+			if entry.Target == "" {
+				for _, state := range []bson.M{entry.After, entry.Before} {
+					if id, ok := state["_id"].(primitive.ObjectID); ok {
+						entry.Target = id.Hex()
+						break
+					}
+				}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+		audit.Record(ctx, log, entry)
+
+		return err
+	}
+}
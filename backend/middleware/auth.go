@@ -1,27 +1,139 @@
 package middlewares
 
 import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
-	jwtware "github.com/gofiber/jwt/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/auth"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func Protected() fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		SigningKey:   []byte("secret"),
-		ErrorHandler: jwtError,
-	})
+// Auth checks the access tokens with the key set and the permissions of their
+// holders against the repositories
+type Auth struct {
+	repos *repository.Repositories
+	keys  *auth.KeySet
+}
+
+func NewAuth(repos *repository.Repositories, keys *auth.KeySet) *Auth {
+	return &Auth{repos: repos, keys: keys}
+}
+
+// Requires a valid access token, its parsed *jwt.Token is stored in the
+// "user" local
+func (m *Auth) Protected() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return m.authenticate(c)
+	}
+}
+
+// Same as Protected but lets requests without an Authorization header through
+func (m *Auth) OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderAuthorization) == "" {
+			return c.Next()
+		}
+		return m.authenticate(c)
+	}
 }
 
-func jwtError(c *fiber.Ctx, err error) error {
-	if err.Error() == "missing or malformed JWT" {
+func (m *Auth) authenticate(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "Bearer ") {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
 			"message": "Missing or malformed token",
 		})
 	}
 
-	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		"success": false,
-		"message": "Invalid or expired token",
-	})
+	token, err := m.keys.Parse(header[7:])
+	if err != nil || !token.Valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired token",
+		})
+	}
+
+	// A token that can't be checked is refused, it may be revoked
+	revoked, err := m.revoked(c.UserContext(), token.Claims.(jwt.MapClaims))
+	if err != nil {
+		logging.Ctx(c).Error("checking the token revocation", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to check the token",
+		})
+	}
+	if revoked {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid or expired token",
+		})
+	}
+
+	c.Locals("user", token)
+
+	// The handlers' logs tell whose request it was
+	claims := token.Claims.(jwt.MapClaims)
+	if adminId, ok := claims["admin_id"].(string); ok {
+		logging.SetCtx(c, logging.Ctx(c).With("admin_id", adminId))
+	} else if userId, ok := claims["user_id"].(string); ok {
+		logging.SetCtx(c, logging.Ctx(c).With("user_id", userId))
+	}
+
+	return c.Next()
+}
+
+// Keeps the claims of a well signed bearer token, even on the routes that
+// don't require one, for the logs, the audit and the rate limits to tell the
+// callers apart
+func (m *Auth) Identify() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+			if token, err := m.keys.Parse(header[7:]); err == nil {
+				c.Locals("bearer", token.Claims.(jwt.MapClaims))
+			}
+		}
+		return c.Next()
+	}
+}
+
+// Claims of the token checked by Protected, or of the bearer token kept by
+// Identify when the route doesn't require one. Only for telling callers apart,
+// not for authorization.
+func bearerClaims(c *fiber.Ctx) jwt.MapClaims {
+	claims := tokenClaims(c)
+	if len(claims) == 0 {
+		if bearer, ok := c.Locals("bearer").(jwt.MapClaims); ok {
+			claims = bearer
+		}
+	}
+	return claims
+}
+
+// Checks if the access token was revoked by its jti, or with all the tokens of
+// its subject, before it expired
+func (m *Auth) revoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	jti, _ := claims["jti"].(string)
+
+	subject, _ := claims["user_id"].(string)
+	if adminId, ok := claims["admin_id"].(string); ok {
+		subject = adminId
+	}
+	subjectId, _ := primitive.ObjectIDFromHex(subject)
+	var issuedAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return m.repos.Sessions.AccessTokenRevoked(ctx, jti, subjectId, issuedAt)
 }
@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Longest request id accepted from callers
+const maxRequestIDLength = 128
+
+// Gives every request an id, the caller's X-Request-ID when it sends a sane
+// one, and echoes it in the response
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(id) {
+			id, _ = utils.RandomToken(16)
+		}
+
+		c.Locals("requestid", id)
+		c.Set(fiber.HeaderXRequestID, id)
+		return c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Puts a logger with the request and trace ids in the request context and logs every
+// request once it's done
+func Logger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		logger := logging.Default
+		if id, ok := c.Locals("requestid").(string); ok {
+			logger = logger.With("request_id", id)
+		}
+		if span := trace.SpanContextFromContext(c.UserContext()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+		logging.SetCtx(c, logger)
+
+		err := c.Next()
+
+		// The account and store are only known once the route ran
+		status := responseStatus(c, err)
+		fields := []interface{}{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"ip", c.IP(),
+		}
+		claims := bearerClaims(c)
+		if adminId, ok := claims["admin_id"].(string); ok {
+			fields = append(fields, "admin_id", adminId)
+		} else if userId, ok := claims["user_id"].(string); ok {
+			fields = append(fields, "user_id", userId)
+		}
+		if storeId := c.Params("storeId"); storeId != "" {
+			fields = append(fields, "store_id", storeId)
+		}
+
+		level := logging.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = logging.LevelError
+		} else if status >= fiber.StatusBadRequest {
+			level = logging.LevelWarn
+		}
+		logging.Ctx(c).Log(level, "request", fields...)
+
+		return err
+	}
+}
+
+// Status the response will have, errors are turned into responses after the
+// middlewares ran
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	if e, ok := err.(*fiber.Error); ok {
+		return e.Code
+	}
+	return fiber.StatusInternalServerError
+}
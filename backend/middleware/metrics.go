@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/metrics"
+)
+
+// Counts and times every request by its route template
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+
+		// Paths without a route would make a label per URL
+		status := responseStatus(c, err)
+		route := c.Route().Path
+		if err != nil && status == fiber.StatusNotFound {
+			route = "unmatched"
+		}
+
+		labels := []string{c.Method(), route, strconv.Itoa(status)}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
@@ -0,0 +1,221 @@
+package middlewares
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+)
+
+// Saved state of a rate limited key, each algorithm uses its own fields
+type RateLimitState struct {
+	Tokens      float64   `bson:"tokens,omitempty"`
+	Count       int       `bson:"count,omitempty"`
+	PrevCount   int       `bson:"prev_count,omitempty"`
+	WindowStart time.Time `bson:"window_start,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// Decision on a request
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// RateLimitAlgorithm decides from the saved state if one more request fits
+type RateLimitAlgorithm interface {
+	// Requests allowed per period, for the X-RateLimit-Limit header
+	Limit() int
+	// How long the state of an idle key is worth keeping
+	TTL() time.Duration
+	take(state RateLimitState, exists bool, now time.Time) (RateLimitState, rateLimitResult)
+}
+
+// Bucket of Capacity tokens refilled evenly over Period, allows bursts up to
+// the capacity
+type TokenBucket struct {
+	Capacity int
+	Period   time.Duration
+}
+
+func (b TokenBucket) Limit() int         { return b.Capacity }
+func (b TokenBucket) TTL() time.Duration { return b.Period }
+
+func (b TokenBucket) take(state RateLimitState, exists bool, now time.Time) (RateLimitState, rateLimitResult) {
+	rate := float64(b.Capacity) / b.Period.Seconds()
+
+	tokens := float64(b.Capacity)
+	if exists {
+		tokens = math.Min(tokens, state.Tokens+now.Sub(state.UpdatedAt).Seconds()*rate)
+	}
+
+	result := rateLimitResult{}
+	if tokens >= 1 {
+		tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = seconds((1 - tokens) / rate)
+	}
+	result.remaining = int(tokens)
+	result.reset = seconds((float64(b.Capacity) - tokens) / rate)
+
+	return RateLimitState{Tokens: tokens, UpdatedAt: now}, result
+}
+
+// At most Max requests in any Window, estimated from the counts of the
+// current and previous fixed windows
+type SlidingWindow struct {
+	Max    int
+	Window time.Duration
+}
+
+func (w SlidingWindow) Limit() int         { return w.Max }
+func (w SlidingWindow) TTL() time.Duration { return 2 * w.Window }
+
+func (w SlidingWindow) take(state RateLimitState, exists bool, now time.Time) (RateLimitState, rateLimitResult) {
+	start := now.Truncate(w.Window)
+
+	// Move the counts along to the current window
+	if !exists || !state.WindowStart.Equal(start) {
+		if exists && state.WindowStart.Equal(start.Add(-w.Window)) {
+			state.PrevCount = state.Count
+		} else {
+			state.PrevCount = 0
+		}
+		state.Count = 0
+		state.WindowStart = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/w.Window.Seconds()
+	estimate := float64(state.PrevCount)*weight + float64(state.Count)
+
+	result := rateLimitResult{reset: start.Add(w.Window).Sub(now)}
+	if estimate+1 <= float64(w.Max) {
+		state.Count++
+		estimate++
+		result.allowed = true
+	} else {
+		result.retryAfter = w.retryAfter(state, elapsed)
+	}
+	result.remaining = int(math.Max(0, float64(w.Max)-math.Ceil(estimate)))
+	state.UpdatedAt = now
+
+	return state, result
+}
+
+// Time until the estimate leaves room for one more request
+func (w SlidingWindow) retryAfter(state RateLimitState, elapsed time.Duration) time.Duration {
+	room := float64(w.Max - state.Count - 1)
+	if room >= 0 && state.PrevCount > 0 {
+		// The previous window weighs less and less
+		x := 1 - room/float64(state.PrevCount)
+		return seconds(x*w.Window.Seconds() - elapsed.Seconds())
+	}
+
+	// Only the next window has room, where the current count becomes the
+	// previous one
+	next := w.Window - elapsed
+	if state.Count == 0 || w.Max < 1 {
+		return next
+	}
+	x := math.Max(0, 1-float64(w.Max-1)/float64(state.Count))
+	return next + seconds(x*w.Window.Seconds())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RateLimitStore keeps the state of every key. Update must apply take
+// atomically, even with other instances sharing the store.
+type RateLimitStore interface {
+	Update(ctx context.Context, key string, ttl time.Duration, take func(state RateLimitState, exists bool) RateLimitState) error
+}
+
+type RateLimitPolicy struct {
+	// Keeps the keys of the policies apart
+	Name      string
+	Algorithm RateLimitAlgorithm
+	// Who the limit applies to, see RateLimitByIP, RateLimitByUser and
+	// RateLimitByStore
+	Key func(c *fiber.Ctx) string
+	// Where the states are kept, in memory when not set
+	Store RateLimitStore
+	// Requests the policy ignores
+	Skip func(c *fiber.Ctx) bool
+}
+
+// Limits the requests of each key of the policy. Errors of the store let the
+// request through rather than taking the API down.
+func RateLimit(policy RateLimitPolicy) fiber.Handler {
+	if policy.Key == nil {
+		policy.Key = RateLimitByIP
+	}
+	if policy.Store == nil {
+		policy.Store = NewMemoryRateLimitStore()
+	}
+
+	return func(c *fiber.Ctx) error {
+		if policy.Skip != nil && policy.Skip(c) {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+		defer cancel()
+
+		var result rateLimitResult
+		key := "ratelimit:" + policy.Name + ":" + policy.Key(c)
+		err := policy.Store.Update(ctx, key, policy.Algorithm.TTL(), func(state RateLimitState, exists bool) RateLimitState {
+			state, result = policy.Algorithm.take(state, exists, time.Now())
+			return state
+		})
+		if err != nil {
+			logging.Ctx(c).Error("updating the rate limit", "policy", policy.Name, "error", err)
+			return c.Next()
+		}
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(policy.Algorithm.Limit()))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+		c.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+
+		if !result.allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Max(1, math.Ceil(result.retryAfter.Seconds())))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"message": "Too many requests",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// The client IP, read from the proxy header only on requests of the trusted
+// proxies of the app
+func RateLimitByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// The account of the access token, read by Identify even before Protected
+// runs, or the IP for anonymous requests
+func RateLimitByUser(c *fiber.Ctx) string {
+	claims := bearerClaims(c)
+	if adminId, ok := claims["admin_id"].(string); ok {
+		return "admin:" + adminId
+	}
+	if userId, ok := claims["user_id"].(string); ok {
+		return "user:" + userId
+	}
+	return RateLimitByIP(c)
+}
+
+// The store of the route, shared by all its visitors
+func RateLimitByStore(c *fiber.Ctx) string {
+	return "store:" + c.Params("storeId")
+}
@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryRateLimitEntry struct {
+	state     RateLimitState
+	expiresAt time.Time
+}
+
+// MemoryRateLimitStore keeps the states in the process, for a single instance
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryRateLimitEntry
+	updates int
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: map[string]memoryRateLimitEntry{}}
+}
+
+func (s *MemoryRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, take func(state RateLimitState, exists bool) RateLimitState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop the idle keys once in a while
+	s.updates++
+	if s.updates%1000 == 0 {
+		for k, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	entry, exists := s.entries[key]
+	if exists && now.After(entry.expiresAt) {
+		exists = false
+	}
+
+	s.entries[key] = memoryRateLimitEntry{
+		state:     take(entry.state, exists),
+		expiresAt: now.Add(ttl),
+	}
+	return nil
+}
+
+var ErrRateLimitContention = errors.New("rate limit: too many concurrent updates")
+
+type mongoRateLimitDocument struct {
+	ID        string         `bson:"_id"`
+	State     RateLimitState `bson:"state"`
+	Version   int64          `bson:"version"`
+	ExpiresAt time.Time      `bson:"expires_at"`
+}
+
+// MongoRateLimitStore shares the states between instances. Updates are
+// optimistic: they only apply if nobody changed the key since it was read,
+// and are retried otherwise.
+type MongoRateLimitStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRateLimitStore(collection *mongo.Collection) *MongoRateLimitStore {
+	return &MongoRateLimitStore{collection: collection}
+}
+
+func (s *MongoRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, take func(state RateLimitState, exists bool) RateLimitState) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		var document mongoRateLimitDocument
+		err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&document)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		now := time.Now()
+		found := err == nil
+		state := take(document.State, found && now.Before(document.ExpiresAt))
+
+		if !found {
+			_, err := s.collection.InsertOne(ctx, mongoRateLimitDocument{ID: key, State: state, Version: 1, ExpiresAt: now.Add(ttl)})
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			return err
+		}
+
+		result, err := s.collection.UpdateOne(ctx, bson.M{"_id": key, "version": document.Version}, bson.M{
+			"$set": bson.M{"state": state, "version": document.Version + 1, "expires_at": now.Add(ttl)},
+		})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 1 {
+			return nil
+		}
+	}
+
+	return ErrRateLimitContention
+}
@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/rbac"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Requires the token holder to have the permission. Store scoped roles are
+// resolved against the route's storeId param when there is one.
+func (m *Auth) RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		storeId, _ := primitive.ObjectIDFromHex(c.Params("storeId"))
+		if !m.Can(c, permission, storeId) {
+			return Forbidden(c, permission)
+		}
+		return c.Next()
+	}
+}
+
+// Same as RequirePermission but also lets users act on their own account,
+// identified by the route param
+func (m *Auth) RequireSelfOrPermission(param string, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if userId, ok := tokenClaims(c)["user_id"].(string); ok && userId == c.Params(param) {
+			return c.Next()
+		}
+
+		storeId, _ := primitive.ObjectIDFromHex(c.Params("storeId"))
+		if !m.Can(c, permission, storeId) {
+			return Forbidden(c, permission)
+		}
+		return c.Next()
+	}
+}
+
+// Checks if the token holder has the permission, for the store if storeId is
+// not nil
+func (m *Auth) Can(c *fiber.Ctx, permission string, storeId primitive.ObjectID) bool {
+	return rbac.Can(m.Roles(c, storeId), permission)
+}
+
+// Consistent response for denied requests
+func Forbidden(c *fiber.Ctx, permission string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"success":    false,
+		"message":    "Forbidden",
+		"permission": permission,
+	})
+}
+
+// Resolves the roles of the token holder: admins from the admin_id claim,
+// customers from the user_id claim plus their assignments and their
+// membership of the store
+func (m *Auth) Roles(c *fiber.Ctx, storeId primitive.ObjectID) []string {
+	claims := tokenClaims(c)
+	roles := []string{}
+
+	if _, ok := claims["admin_id"].(string); ok {
+		return append(roles, rbac.RoleAdmin)
+	}
+
+	tokenUserId, ok := claims["user_id"].(string)
+	if !ok {
+		return roles
+	}
+	userId, err := primitive.ObjectIDFromHex(tokenUserId)
+	if err != nil {
+		return roles
+	}
+	roles = append(roles, rbac.RoleCustomer)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Global assignments and the ones for the store
+	assignments, _ := m.repos.Roles.ForUser(ctx, userId, storeId)
+	for _, assignment := range assignments {
+		roles = append(roles, assignment.Role)
+	}
+
+	if !storeId.IsZero() {
+		// Store members get the role of their membership
+		if member, err := m.repos.Members.Find(ctx, storeId, userId); err == nil {
+			roles = append(roles, member.Role)
+		} else if owner, _ := m.repos.Stores.IsOwner(ctx, storeId, userId); owner {
+			// Stores created before memberships only know their owner
+			roles = append(roles, rbac.RoleStoreOwner)
+		}
+	}
+
+	return roles
+}
+
+func tokenClaims(c *fiber.Ctx) jwt.MapClaims {
+	if token, ok := c.Locals("user").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			return claims
+		}
+	}
+	return jwt.MapClaims{}
+}
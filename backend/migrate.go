@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/config"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/health"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/migrations"
+)
+
+// Bring the schema up to date, unless deploys run "server migrate" first.
+// Instances stay unready while migrations are pending.
+func setupMigrations(cfg config.Migrations) {
+	runner := migrations.New(config.MI.DB)
+
+	if cfg.OnStart {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+
+		if _, err := runner.Up(ctx); err != nil {
+			log.Fatal("Error migrating the database: ", err)
+		}
+	}
+
+	health.Register("migrations", runner.Check)
+}
+
+// server migrate [up|status]: applies the pending migrations, or lists them
+// all with when they were applied
+func runMigrate(cfg config.Migrations, args []string) {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	runner := migrations.New(config.MI.DB)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	switch command {
+	case "up":
+		done, err := runner.Up(ctx)
+		for _, migration := range done {
+			fmt.Printf("applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal("Error migrating the database: ", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("nothing to apply")
+		}
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatal("Error reading the migrations: ", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied != nil {
+				applied = status.Applied.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Migration.Version, status.Migration.Name, applied)
+		}
+		w.Flush()
+
+	default:
+		log.Fatalf("Unknown migrate command %q, use up or status", command)
+	}
+}
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Most duplicated values listed in a report
+const duplicatesReported = 50
+
+// Documents of the filter sharing the values of the keys, one line per value
+// naming the documents. A unique index can't be built over them.
+func duplicates(ctx context.Context, collection *mongo.Collection, filter bson.M, keys ...string) ([]string, error) {
+	group := bson.M{}
+	for _, key := range keys {
+		group[key] = "$" + key
+	}
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": group, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: duplicatesReported}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		Values bson.M               `bson:"_id"`
+		IDs    []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	found := []string{}
+	for _, group := range groups {
+		values := []string{}
+		for _, key := range keys {
+			values = append(values, fmt.Sprintf("%s=%s", key, formatValue(group.Values[key])))
+		}
+		ids := []string{}
+		for _, id := range group.IDs {
+			ids = append(ids, id.Hex())
+		}
+		found = append(found, fmt.Sprintf("%s %s: %s", collection.Name(), strings.Join(values, " "), strings.Join(ids, ", ")))
+	}
+	return found, nil
+}
+
+func formatValue(value interface{}) string {
+	if id, ok := value.(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
+
+// Error of the duplicates found, nil without any. The migration runs again
+// once the documents are merged, changed or deleted.
+func duplicatesError(found []string) error {
+	if len(found) == 0 {
+		return nil
+	}
+	return fmt.Errorf("duplicates prevent a unique index, merge, change or delete these documents and migrate again:\n  %s",
+		strings.Join(found, "\n  "))
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Deletes the login attempt counters at the end of their window. Counters
+// written before expires_at existed get a day.
+func loginAttemptsExpiry(ctx context.Context, db *mongo.Database) error {
+	attempts := db.Collection("login_attempts")
+
+	_, err := attempts.UpdateMany(ctx, bson.M{"expires_at": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"expires_at": bson.M{"$add": bson.A{"$last_failure", (24 * time.Hour).Milliseconds()}}}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = attempts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Deletes the rate limit states once their key has been idle long enough
+// to start over. Every state has expires_at already.
+func rateLimitsExpiry(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("rate_limits").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
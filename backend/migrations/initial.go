@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Every migration of the code, new ones go at the end with the next version
+var All = []Migration{
+	{Version: 1, Name: "unique usernames and emails", Up: uniqueAccounts},
+	{Version: 2, Name: "stores by owner", Up: storesByOwner},
+	{Version: 3, Name: "text search", Up: textSearch},
+	{Version: 4, Name: "one active payment per order", Up: activePayments},
+	{Version: 5, Name: "session lookups and expiry", Up: sessionIndexes},
+	{Version: 6, Name: "lookups by store, member and payment intent", Up: lookupIndexes},
+	{Version: 7, Name: "login attempts expiry", Up: loginAttemptsExpiry},
+	{Version: 8, Name: "rate limits expiry", Up: rateLimitsExpiry},
+}
+
+// Unique usernames and emails of users and admins. Documents without the
+// field (users only holding their stores) aren't indexed. Accounts already
+// sharing one are all reported, nothing is indexed until they are cleaned up.
+func uniqueAccounts(ctx context.Context, db *mongo.Database) error {
+	found := []string{}
+	for _, collection := range []string{"users", "admins"} {
+		for _, field := range []string{"username", "email"} {
+			duplicated, err := duplicates(ctx, db.Collection(collection), bson.M{field: bson.M{"$type": "string"}}, field)
+			if err != nil {
+				return err
+			}
+			found = append(found, duplicated...)
+		}
+	}
+	if err := duplicatesError(found); err != nil {
+		return err
+	}
+
+	for _, collection := range []string{"users", "admins"} {
+		models := []mongo.IndexModel{}
+		for _, field := range []string{"username", "email"} {
+			models = append(models, mongo.IndexModel{
+				Keys: bson.D{{Key: field, Value: 1}},
+				Options: options.Index().
+					SetName(field + "_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{field: bson.M{"$type": "string"}}),
+			})
+		}
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stores of a user
+func storesByOwner(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("stores").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "owner", Value: 1}},
+		Options: options.Index().SetName("owner"),
+	})
+	return err
+}
+
+// Text indexes the list searches run on, a collection has at most one
+func textSearch(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string]bson.D{
+		"users":    {{Key: "username", Value: "text"}},
+		"stores":   {{Key: "name", Value: "text"}},
+		"products": {{Key: "title", Value: "text"}, {Key: "sku", Value: "text"}},
+	}
+	for collection, keys := range indexes {
+		_, err := db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetName("search"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
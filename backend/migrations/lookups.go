@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Indexes of the lookups made on most requests: the products, orders, carts
+// and members of a store, the stores of a member and the payment of a
+// provider's webhook
+func lookupIndexes(ctx context.Context, db *mongo.Database) error {
+	// Unique ones first, nothing is built while they have duplicates
+	found, err := duplicates(ctx, db.Collection("store_members"), bson.M{}, "store", "user")
+	if err != nil {
+		return err
+	}
+	duplicated, err := duplicates(ctx, db.Collection("payments"), bson.M{}, "provider", "intent_id")
+	if err != nil {
+		return err
+	}
+	if err := duplicatesError(append(found, duplicated...)); err != nil {
+		return err
+	}
+
+	indexes := map[string][]mongo.IndexModel{
+		"products": {
+			{Keys: bson.D{{Key: "store", Value: 1}, {Key: "status", Value: 1}}, Options: options.Index().SetName("store_status")},
+			{Keys: bson.D{{Key: "store", Value: 1}, {Key: "sku", Value: 1}}, Options: options.Index().SetName("store_sku")},
+		},
+		"orders": {
+			{Keys: bson.D{{Key: "store", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("store_created_at")},
+			{Keys: bson.D{{Key: "customer", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("customer_created_at")},
+		},
+		"carts": {
+			{Keys: bson.D{{Key: "store", Value: 1}, {Key: "user", Value: 1}}, Options: options.Index().SetName("store_user")},
+			{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetName("token")},
+		},
+		"store_members": {
+			{Keys: bson.D{{Key: "store", Value: 1}, {Key: "user", Value: 1}}, Options: options.Index().SetName("store_user_unique").SetUnique(true)},
+			{Keys: bson.D{{Key: "user", Value: 1}}, Options: options.Index().SetName("user")},
+		},
+		"payments": {
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "intent_id", Value: 1}}, Options: options.Index().SetName("provider_intent_unique").SetUnique(true)},
+		},
+	}
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Package migrations brings the database schema (indexes, reshaped documents)
+// to the version the code expects. Every migration runs once per database,
+// the applied ones are recorded in the schema_migrations collection.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	recordsCollection = "schema_migrations"
+	lockCollection    = "schema_migrations_lock"
+	lockID            = "lock"
+)
+
+// How long a lock is honoured, a runner that died while holding it doesn't
+// block the others for longer
+const lockTimeout = 10 * time.Minute
+
+// How often a runner waiting for the lock tries again
+const lockRetry = time.Second
+
+// A change of the schema. Up must be safe to run again after failing halfway,
+// creating an index that already exists is.
+type Migration struct {
+	// Order of the migrations, never reused
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// An applied migration as recorded in the database
+type Record struct {
+	Version   int       `json:"version" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	AppliedAt time.Time `json:"applied_at" bson:"applied_at"`
+	// How long Up took, in milliseconds
+	Duration int64 `json:"duration_ms" bson:"duration_ms"`
+}
+
+// Whether a migration has been applied
+type Status struct {
+	Migration Migration
+	// Nil when the migration is pending
+	Applied *Record
+}
+
+type Runner struct {
+	DB         *mongo.Database
+	Migrations []Migration
+	Logger     *logging.Logger
+
+	// Set once nothing is pending, migrations are never unapplied
+	upToDate int32
+}
+
+// Runner of every migration of the code against the database
+func New(db *mongo.Database) *Runner {
+	return &Runner{DB: db, Migrations: All, Logger: logging.Default}
+}
+
+// The migrations by version
+func (r *Runner) sorted() []Migration {
+	migrations := append([]Migration{}, r.Migrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// Applied migrations by version
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	cursor, err := r.DB.Collection(recordsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Record{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Every migration with whether it was applied, by version
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range r.sorted() {
+		status := Status{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = &record
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Migrations still to apply, by version
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, status := range statuses {
+		if status.Applied == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Applies the pending migrations in order and returns them. Instances
+// starting together take turns, the ones waiting find nothing left to do.
+// Stops at the first failing migration, the ones before it stay applied.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	release, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range pending {
+		r.Logger.Info("applying migration", "version", migration.Version, "name", migration.Name)
+
+		start := time.Now()
+		if err := migration.Up(ctx, r.DB); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err := r.DB.Collection(recordsCollection).InsertOne(ctx, Record{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+			Duration:  time.Since(start).Milliseconds(),
+		})
+		if err != nil {
+			return done, fmt.Errorf("recording migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	atomic.StoreInt32(&r.upToDate, 1)
+	return done, nil
+}
+
+// Readiness check failing while migrations are pending, the code may rely on
+// indexes that don't exist yet
+func (r *Runner) Check(ctx context.Context) error {
+	if atomic.LoadInt32(&r.upToDate) == 1 {
+		return nil
+	}
+
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		names := []string{}
+		for _, migration := range pending {
+			names = append(names, fmt.Sprintf("%d %s", migration.Version, migration.Name))
+		}
+		return fmt.Errorf("pending migrations: %s", strings.Join(names, ", "))
+	}
+
+	atomic.StoreInt32(&r.upToDate, 1)
+	return nil
+}
+
+// Takes the lock of the database, waiting for the runner holding it. The
+// returned func gives it back.
+func (r *Runner) lock(ctx context.Context) (func(), error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%d/%d", hostname, os.Getpid(), time.Now().UnixNano())
+	collection := r.DB.Collection(lockCollection)
+
+	for {
+		// Free or expired, a held lock fails the upsert on the duplicate _id
+		now := time.Now()
+		_, err := collection.UpdateOne(ctx, bson.M{
+			"_id": lockID,
+			"$or": []bson.M{
+				{"owner": ""},
+				{"locked_at": bson.M{"$lt": now.Add(-lockTimeout)}},
+			},
+		}, bson.M{
+			"$set": bson.M{"owner": owner, "locked_at": now},
+		}, options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		r.Logger.Info("waiting for the migrations lock")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetry):
+		}
+	}
+
+	return func() {
+		// The context may be over, the lock still has to go
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": lockID, "owner": owner}, bson.M{"$set": bson.M{"owner": ""}})
+		if err != nil {
+			r.Logger.Error("releasing the migrations lock", "error", err)
+		}
+	}, nil
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Marks the pending, processing and succeeded payments active and allows one
+// of them per order, so an order can't be paid twice
+func activePayments(ctx context.Context, db *mongo.Database) error {
+	payments := db.Collection("payments")
+
+	active := bson.A{models.PaymentStatusPending, models.PaymentStatusProcessing, models.PaymentStatusSucceeded}
+	_, err := payments.UpdateMany(ctx, bson.M{"status": bson.M{"$in": active}}, bson.M{"$set": bson.M{"active": true}})
+	if err != nil {
+		return err
+	}
+
+	found, err := duplicates(ctx, payments, bson.M{"active": true}, "order")
+	if err != nil {
+		return err
+	}
+	if err := duplicatesError(found); err != nil {
+		return err
+	}
+
+	_, err = payments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "order", Value: 1}},
+		Options: options.Index().
+			SetName("order_active_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"active": true}),
+	})
+	return err
+}
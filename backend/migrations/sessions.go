@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Indexes of the refresh token lookups and of the access token revocations
+// checked on every request. Revocations are deleted once the tokens they
+// cover have expired.
+func sessionIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("refresh_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetName("token_hash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "family", Value: 1}},
+			Options: options.Index().SetName("family"),
+		},
+		{
+			Keys:    bson.D{{Key: "subject", Value: 1}, {Key: "subject_type", Value: 1}},
+			Options: options.Index().SetName("subject"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("revoked_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "jti", Value: 1}},
+			Options: options.Index().
+				SetName("jti").
+				SetPartialFilterExpression(bson.M{"jti": bson.M{"$type": "string"}}),
+		},
+		{
+			Keys: bson.D{{Key: "subject", Value: 1}, {Key: "issued_before", Value: 1}},
+			Options: options.Index().
+				SetName("subject_issued_before").
+				SetPartialFilterExpression(bson.M{"subject": bson.M{"$exists": true}}),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
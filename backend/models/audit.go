@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Entry of the append only audit log
+type AuditEntry struct {
+	ID         primitive.ObjectID     `json:"_id,omitempty" bson:"_id,omitempty"`
+	ActorType  string                 `json:"actor_type" bson:"actor_type"`
+	Actor      primitive.ObjectID     `json:"actor,omitempty" bson:"actor,omitempty"`
+	Action     string                 `json:"action" bson:"action"`
+	TargetType string                 `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	Target     string                 `json:"target,omitempty" bson:"target,omitempty"`
+	Before     bson.M                 `json:"before,omitempty" bson:"before,omitempty"`
+	After      bson.M                 `json:"after,omitempty" bson:"after,omitempty"`
+	Changes    map[string]AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty" bson:"details,omitempty"`
+	Method     string                 `json:"method,omitempty" bson:"method,omitempty"`
+	Path       string                 `json:"path,omitempty" bson:"path,omitempty"`
+	Status     int                    `json:"status,omitempty" bson:"status,omitempty"`
+	IP         string                 `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent  string                 `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	CreatedAt  time.Time              `json:"created_at" bson:"created_at"`
+}
+
+// Value of a field before and after the action
+type AuditChange struct {
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CartItem struct {
+	Product  primitive.ObjectID `json:"product" bson:"product"`
+	Title    string             `json:"title" bson:"title"`
+	SKU      string             `json:"sku" bson:"sku"`
+	Quantity int64              `json:"quantity" bson:"quantity"`
+	// Current unit price of the product, refreshed every time the cart is read
+	Price int64 `json:"price" bson:"price"`
+	Total int64 `json:"total" bson:"total"`
+}
+
+// A cart belongs either to a logged in user or to an anonymous cart token
+type Cart struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store     primitive.ObjectID `json:"store" bson:"store"`
+	User      primitive.ObjectID `json:"user,omitempty" bson:"user,omitempty"`
+	Token     string             `json:"token,omitempty" bson:"token,omitempty"`
+	Items     []CartItem         `json:"items" bson:"items"`
+	Subtotal  int64              `json:"subtotal" bson:"subtotal"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ReservationStatusHeld      = "held"
+	ReservationStatusCommitted = "committed"
+	ReservationStatusReleased  = "released"
+)
+
+const (
+	InventoryReasonInitial     = "initial"
+	InventoryReasonManual      = "manual"
+	InventoryReasonReservation = "reservation"
+	InventoryReasonRelease     = "release"
+)
+
+// Stock taken out of a product while the order waits for payment
+type Reservation struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store     primitive.ObjectID `json:"store" bson:"store"`
+	Product   primitive.ObjectID `json:"product" bson:"product"`
+	Order     primitive.ObjectID `json:"order" bson:"order"`
+	Quantity  int64              `json:"quantity" bson:"quantity"`
+	Status    string             `json:"status" bson:"status"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// A change of a product's stock
+type InventoryAdjustment struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store      primitive.ObjectID `json:"store" bson:"store"`
+	Product    primitive.ObjectID `json:"product" bson:"product"`
+	Delta      int64              `json:"delta" bson:"delta"`
+	StockAfter int64              `json:"stock_after" bson:"stock_after"`
+	Reason     string             `json:"reason" bson:"reason"`
+	Note       string             `json:"note,omitempty" bson:"note,omitempty"`
+	Order      primitive.ObjectID `json:"order,omitempty" bson:"order,omitempty"`
+	ActorType  string             `json:"actor_type" bson:"actor_type"`
+	Actor      primitive.ObjectID `json:"actor,omitempty" bson:"actor,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusDeclined = "declined"
+	InviteStatusRevoked  = "revoked"
+)
+
+// A user working on a store with one of the store roles
+type StoreMember struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store     primitive.ObjectID `json:"store" bson:"store"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Role      string             `json:"role" bson:"role"`
+	InvitedBy primitive.ObjectID `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Invitation to join a store, the token is only sent by email and stored hashed
+type StoreInvite struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store      primitive.ObjectID `json:"store" bson:"store"`
+	Email      string             `json:"email" bson:"email"`
+	Role       string             `json:"role" bson:"role"`
+	TokenHash  string             `json:"-" bson:"token_hash"`
+	Status     string             `json:"status" bson:"status"`
+	InvitedBy  primitive.ObjectID `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	AnsweredAt time.Time          `json:"answered_at,omitempty" bson:"answered_at,omitempty"`
+}
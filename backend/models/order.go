@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusFulfilled = "fulfilled"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+const (
+	ActorTypeUser      = "user"
+	ActorTypeAdmin     = "admin"
+	ActorTypeSystem    = "system"
+	ActorTypeAnonymous = "anonymous"
+)
+
+// Allowed status changes of an order. A paid order is only undone by refunding
+// its payment, so the money and the order always agree.
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusFulfilled, OrderStatusRefunded},
+	OrderStatusFulfilled: {OrderStatusShipped, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+}
+
+// Checks if an order can move from a status to another
+func CanTransitionOrder(from string, to string) bool {
+	for _, v := range orderTransitions[from] {
+		if v == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Snapshot of a product at checkout time
+type OrderItem struct {
+	Product  primitive.ObjectID `json:"product" bson:"product"`
+	Title    string             `json:"title" bson:"title"`
+	SKU      string             `json:"sku" bson:"sku"`
+	Quantity int64              `json:"quantity" bson:"quantity"`
+	Price    int64              `json:"price" bson:"price"`
+	Total    int64              `json:"total" bson:"total"`
+}
+
+// A status change, the actor is a user or an admin
+type OrderTransition struct {
+	From      string             `json:"from,omitempty" bson:"from,omitempty"`
+	To        string             `json:"to" bson:"to"`
+	At        time.Time          `json:"at" bson:"at"`
+	ActorType string             `json:"actor_type" bson:"actor_type"`
+	Actor     primitive.ObjectID `json:"actor,omitempty" bson:"actor,omitempty"`
+	Note      string             `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+type Order struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store     primitive.ObjectID `json:"store" bson:"store"`
+	Customer  primitive.ObjectID `json:"customer" bson:"customer"`
+	Items     []OrderItem        `json:"items" bson:"items"`
+	Subtotal  int64              `json:"subtotal" bson:"subtotal"`
+	Status    string             `json:"status" bson:"status"`
+	History   []OrderTransition  `json:"history" bson:"history"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
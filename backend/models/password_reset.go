@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Pending password reset of a user. The emailed token is the reset's id and a
+// secret only stored hashed.
+type PasswordReset struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	User       primitive.ObjectID `json:"user" bson:"user"`
+	SecretHash string             `json:"-" bson:"secret_hash"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UsedAt     time.Time          `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
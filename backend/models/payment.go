@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusProcessing = "processing"
+	PaymentStatusSucceeded  = "succeeded"
+	PaymentStatusFailed     = "failed"
+	PaymentStatusRefunded   = "refunded"
+)
+
+// Whether a payment in the status holds its order, an order has one such
+// payment at most
+func PaymentStatusActive(status string) bool {
+	return status == PaymentStatusPending || status == PaymentStatusProcessing || status == PaymentStatusSucceeded
+}
+
+type Payment struct {
+	ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store    primitive.ObjectID `json:"store" bson:"store"`
+	Payer    primitive.ObjectID `json:"payer" bson:"payer"`
+	Order    primitive.ObjectID `json:"order,omitempty" bson:"order,omitempty"`
+	Provider string             `json:"provider" bson:"provider"`
+	// Id of the payment on the provider side
+	IntentID      string `json:"intent_id" bson:"intent_id"`
+	Amount        int64  `json:"amount" bson:"amount"`
+	Currency      string `json:"currency" bson:"currency"`
+	Status        string `json:"status" bson:"status"`
+	FailureReason string `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	// Follows the status, the unique index on the active payments of an
+	// order is built on it
+	Active    bool      `json:"-" bson:"active,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
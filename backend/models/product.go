@@ -0,0 +1,22 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	ProductStatusDraft    = "draft"
+	ProductStatusActive   = "active"
+	ProductStatusArchived = "archived"
+)
+
+type Product struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Store       primitive.ObjectID `json:"store,omitempty" bson:"store,omitempty"`
+	Title       string             `json:"title,omitempty" bson:"title,omitempty" validate:"required"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	// Price in the smallest currency unit (cents)
+	Price  int64    `json:"price" bson:"price" validate:"gte=0"`
+	SKU    string   `json:"sku,omitempty" bson:"sku,omitempty" validate:"required"`
+	Stock  int64    `json:"stock" bson:"stock" validate:"gte=0"`
+	Images []string `json:"images,omitempty" bson:"images,omitempty" validate:"dive,url"`
+	Status string   `json:"status,omitempty" bson:"status,omitempty" validate:"omitempty,oneof=draft active archived"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Grants a role to a user, for a single store if Store is set
+type RoleAssignment struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Role      string             `json:"role" bson:"role"`
+	Store     primitive.ObjectID `json:"store,omitempty" bson:"store,omitempty"`
+	CreatedBy primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Refresh token of a login session. Every refresh replaces the token with a
+// new one of the same family, the token itself is only stored hashed.
+type RefreshToken struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Family      primitive.ObjectID `json:"family" bson:"family"`
+	TokenHash   string             `json:"-" bson:"token_hash"`
+	SubjectType string             `json:"subject_type" bson:"subject_type"`
+	Subject     primitive.ObjectID `json:"subject" bson:"subject"`
+	ExpiresAt   time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UsedAt      time.Time          `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	RevokedAt   time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// Access tokens rejected before their expiry, either the one with the jti or
+// all the tokens of the subject issued before IssuedBefore
+type RevokedToken struct {
+	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	JTI          string             `json:"jti,omitempty" bson:"jti,omitempty"`
+	Subject      primitive.ObjectID `json:"subject,omitempty" bson:"subject,omitempty"`
+	IssuedBefore time.Time          `json:"issued_before,omitempty" bson:"issued_before,omitempty"`
+	ExpiresAt    time.Time          `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,9 @@
+package models
+
+const SecuritySettingsID = "security"
+
+// Platform wide security policy, a single document of the settings collection
+type SecuritySettings struct {
+	ID                    string `json:"-" bson:"_id"`
+	RequireAdminTwoFactor bool   `json:"require_admin_two_factor" bson:"require_admin_two_factor"`
+}
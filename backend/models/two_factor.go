@@ -0,0 +1,10 @@
+package models
+
+// TOTP second factor of an account. The secret is set on enrollment and only
+// enabled once a code from it is confirmed.
+type TwoFactor struct {
+	TOTPSecret      string   `json:"-" bson:"totp_secret,omitempty"`
+	TOTPEnabled     bool     `json:"totp_enabled" bson:"totp_enabled,omitempty"`
+	TOTPLastCounter int64    `json:"-" bson:"totp_last_counter,omitempty"`
+	RecoveryCodes   []string `json:"-" bson:"recovery_codes,omitempty"`
+}
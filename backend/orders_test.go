@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reservations failing to record the reservations after the first ones
+type failingReservations struct {
+	repository.ReservationRepository
+	allowed int
+}
+
+func (r *failingReservations) CreateMany(ctx context.Context, reservations []models.Reservation) error {
+	if r.allowed == 0 {
+		return errors.New("reservations unavailable")
+	}
+	r.allowed--
+	return r.ReservationRepository.CreateMany(ctx, reservations)
+}
+
+func TestCheckout(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	orders := "/api/stores/" + storeId + "/orders"
+
+	s.call("POST", orders, "", nil).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("POST", orders, alice.Token, nil).expectFailure(fiber.StatusBadRequest, "Cart is empty")
+	s.call("POST", orders, admin.Token, nil).expectForbidden("order:create")
+
+	orderId := s.placeOrder(alice, storeId, mugId, 2)
+
+	res := s.call("GET", orders+"/"+orderId, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.status") != "pending" || res.num("data.subtotal") != 2400 {
+		t.Fatalf("unexpected order %v", res.body)
+	}
+
+	// The cart is emptied and the stock held for the order
+	res = s.call("GET", "/api/stores/"+storeId+"/cart", alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if len(res.list("data.items")) != 0 {
+		t.Fatalf("cart not emptied %v", res.body)
+	}
+	res = s.call("GET", "/api/stores/"+storeId+"/products/"+mugId, "", nil).expectSuccess(fiber.StatusOK)
+	if res.num("data.stock") != 1 {
+		t.Fatalf("stock not reserved %v", res.body)
+	}
+
+	s.call("POST", "/api/stores/"+storeId+"/cart/items", alice.Token, fiber.Map{"product": mugId, "quantity": 2}).
+		expectFailure(fiber.StatusConflict, "Not enough stock")
+}
+
+func TestCheckoutReservationFailure(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	capId := s.createProduct(bob, storeId, "CAP-1", 800, 3)
+
+	for _, productId := range []string{mugId, capId} {
+		s.call("POST", "/api/stores/"+storeId+"/cart/items", alice.Token, fiber.Map{"product": productId, "quantity": 2}).
+			expectSuccess(fiber.StatusOK)
+	}
+
+	// Failing on the first item, then on the second once the first is recorded
+	reservations := s.repos.Reservations
+	for _, allowed := range []int{0, 1} {
+		s.repos.Reservations = &failingReservations{ReservationRepository: reservations, allowed: allowed}
+		s.call("POST", "/api/stores/"+storeId+"/orders", alice.Token, nil).
+			expectFailure(fiber.StatusInternalServerError, "Failed to reserve the stock")
+
+		// Every item got its stock back
+		for _, productId := range []string{mugId, capId} {
+			res := s.call("GET", "/api/stores/"+storeId+"/products/"+productId, "", nil).expectSuccess(fiber.StatusOK)
+			if res.num("data.stock") != 3 {
+				t.Fatalf("stock not given back after %d reservations %v", allowed, res.body)
+			}
+		}
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	eve := s.verifiedUser("eve")
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+	storeId := s.createStore(bob, "Bob's shop")
+	s.createStore(eve, "Eve's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	orderId := s.placeOrder(alice, storeId, mugId, 1)
+	orders := "/api/stores/" + storeId + "/orders"
+
+	s.call("GET", orders, alice.Token, nil).expectForbidden("order:list")
+	s.call("GET", orders, eve.Token, nil).expectForbidden("order:list")
+	if res := s.call("GET", orders, bob.Token, nil).expect(fiber.StatusOK); res.num("total") != 1 {
+		t.Fatalf("unexpected orders %v", res.body)
+	}
+
+	// Single orders are for the customer and the store
+	s.call("GET", orders+"/"+orderId, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", orders+"/"+orderId, eve.Token, nil).expectForbidden("order:read")
+	s.call("GET", orders+"/"+primitive.NewObjectID().Hex(), bob.Token, nil).expectFailure(fiber.StatusNotFound, "Order not found")
+
+	// Across stores
+	for _, tc := range []struct {
+		token string
+		path  string
+		total int64
+	}{
+		{alice.Token, "/api/orders/mine", 1},
+		{bob.Token, "/api/orders/mine", 0},
+		{admin.Token, "/api/orders/mine", 0},
+		{bob.Token, "/api/orders", 1},
+		{eve.Token, "/api/orders", 0},
+		{admin.Token, "/api/orders", 1},
+	} {
+		if res := s.call("GET", tc.path, tc.token, nil).expect(fiber.StatusOK); res.num("total") != tc.total {
+			t.Fatalf("%s: unexpected orders %v", tc.path, res.body)
+		}
+	}
+	s.call("GET", "/api/orders", "", nil).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	eve := s.verifiedUser("eve")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	orders := "/api/stores/" + storeId + "/orders"
+
+	first := s.placeOrder(alice, storeId, mugId, 1)
+	second := s.placeOrder(alice, storeId, mugId, 1)
+
+	s.call("PATCH", orders+"/"+first+"/status", eve.Token, fiber.Map{"status": "paid"}).expectForbidden("order:update")
+	s.call("PATCH", orders+"/"+first+"/status", bob.Token, fiber.Map{}).expectFailure(fiber.StatusBadRequest, "")
+	s.call("PATCH", orders+"/"+first+"/status", bob.Token, fiber.Map{"status": "shipped"}).
+		expectFailure(fiber.StatusConflict, "Cannot move the order from pending to shipped")
+
+	// Customers can only cancel their pending orders
+	s.call("PATCH", orders+"/"+first+"/status", alice.Token, fiber.Map{"status": "paid"}).expectForbidden("order:update")
+	s.call("PATCH", orders+"/"+first+"/status", alice.Token, fiber.Map{"status": "cancelled"}).expectSuccess(fiber.StatusOK)
+
+	// Only the payments pay and refund orders
+	s.call("PATCH", orders+"/"+second+"/status", bob.Token, fiber.Map{"status": "paid", "note": "paid in store"}).
+		expectFailure(fiber.StatusBadRequest, "Orders are paid and refunded through their payments")
+	payment := s.call("POST", "/api/payments", alice.Token, fiber.Map{"order": second}).expectSuccess(fiber.StatusCreated)
+	s.webhook(payments.Event{Type: payments.EventPaymentSucceeded, IntentID: payment.str("data.intent_id"), Amount: 1200, Currency: "usd"}).
+		expect(fiber.StatusOK)
+	s.call("PATCH", orders+"/"+second+"/status", bob.Token, fiber.Map{"status": "refunded"}).
+		expectFailure(fiber.StatusBadRequest, "Orders are paid and refunded through their payments")
+	s.call("PATCH", orders+"/"+second+"/status", alice.Token, fiber.Map{"status": "cancelled"}).expectForbidden("order:update")
+
+	// Nor can the store cancel it while the customer keeps having paid
+	s.call("PATCH", orders+"/"+second+"/status", bob.Token, fiber.Map{"status": "cancelled"}).
+		expectFailure(fiber.StatusConflict, "Paid orders are cancelled by refunding their payment")
+
+	res := s.call("GET", orders+"/"+second, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.status") != "paid" || len(res.list("data.history")) != 2 {
+		t.Fatalf("unexpected order %v", res.body)
+	}
+	res = s.call("GET", "/api/payments/"+payment.str("data._id"), alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.status") != "succeeded" {
+		t.Fatalf("unexpected payment %v", res.body)
+	}
+
+	// The cancelled order gave its stock back
+	res = s.call("GET", "/api/stores/"+storeId+"/products/"+mugId, "", nil).expectSuccess(fiber.StatusOK)
+	if res.num("data.stock") != 2 {
+		t.Fatalf("unexpected stock %v", res.body)
+	}
+}
@@ -0,0 +1,232 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/logging"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/utils"
+)
+
+// Payment methods understood by the fake gateway
+const (
+	FakeMethodSuccess = "fake_success"
+	FakeMethodDecline = "fake_decline"
+	FakeMethodDelayed = "fake_delayed"
+)
+
+// Name of the fake gateway
+const FakeProviderName = "fake"
+
+const fakeSignatureTolerance = 5 * time.Minute
+
+// FakeProvider is an in-process gateway for development and CI. The payment
+// method decides the outcome: fake_success and fake_decline settle right away,
+// fake_delayed only settles after Delay. Outcomes are reported like a real
+// gateway would, by posting a signed webhook to WebhookURL.
+type FakeProvider struct {
+	Secret     string
+	WebhookURL string
+	Delay      time.Duration
+
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	pending sync.WaitGroup
+}
+
+type fakeIntent struct {
+	Intent
+	reference string
+	method    string
+}
+
+func NewFakeProvider(secret string, webhookURL string, delay time.Duration) *FakeProvider {
+	return &FakeProvider{
+		Secret:     secret,
+		WebhookURL: webhookURL,
+		Delay:      delay,
+		intents:    map[string]*fakeIntent{},
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return FakeProviderName
+}
+
+func (p *FakeProvider) SignatureHeader() string {
+	return "X-Fake-Signature"
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, params IntentParams) (*Intent, error) {
+	token, err := utils.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	method := params.Method
+	if method == "" {
+		method = FakeMethodSuccess
+	}
+	if method != FakeMethodSuccess && method != FakeMethodDecline && method != FakeMethodDelayed {
+		return nil, fmt.Errorf("unknown payment method %q", method)
+	}
+
+	intent := &fakeIntent{
+		Intent: Intent{
+			ID:       "fake_pi_" + token,
+			Amount:   params.Amount,
+			Currency: params.Currency,
+			Status:   IntentStatusRequiresCapture,
+		},
+		reference: params.Reference,
+		method:    method,
+	}
+
+	p.mu.Lock()
+	p.intents[intent.ID] = intent
+	p.mu.Unlock()
+
+	result := intent.Intent
+	return &result, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if intent.Status != IntentStatusRequiresCapture {
+		return nil, fmt.Errorf("cannot capture a %s payment", intent.Status)
+	}
+
+	switch intent.method {
+	case FakeMethodDecline:
+		intent.Status = IntentStatusFailed
+		p.notify(0, Event{Type: EventPaymentFailed, IntentID: intent.ID, Reference: intent.reference, Amount: intent.Amount, Currency: intent.Currency, Reason: "card_declined"})
+		return nil, ErrDeclined
+	case FakeMethodDelayed:
+		intent.Status = IntentStatusProcessing
+		p.notify(p.Delay, Event{Type: EventPaymentSucceeded, IntentID: intent.ID, Reference: intent.reference, Amount: intent.Amount, Currency: intent.Currency})
+	default:
+		intent.Status = IntentStatusSucceeded
+		p.notify(0, Event{Type: EventPaymentSucceeded, IntentID: intent.ID, Reference: intent.reference, Amount: intent.Amount, Currency: intent.Currency})
+	}
+
+	result := intent.Intent
+	return &result, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentID string, amount int64) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if intent.Status != IntentStatusSucceeded && !(intent.Status == IntentStatusProcessing && intent.method == FakeMethodDelayed) {
+		return nil, fmt.Errorf("cannot refund a %s payment", intent.Status)
+	}
+	if amount <= 0 || amount > intent.Amount {
+		amount = intent.Amount
+	}
+
+	intent.Status = IntentStatusRefunded
+	p.notify(0, Event{Type: EventPaymentRefunded, IntentID: intent.ID, Reference: intent.reference, Amount: amount, Currency: intent.Currency})
+
+	result := intent.Intent
+	return &result, nil
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, signature string) (*Event, error) {
+	// Signature is "t=<unix time>,v1=<hex hmac of "t.payload">"
+	var timestamp, mac string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			mac = kv[1]
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || mac == "" {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > fakeSignatureTolerance || age < -fakeSignatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	expected := p.sign(timestamp, payload)
+	if !hmac.Equal([]byte(expected), []byte(mac)) {
+		return nil, ErrInvalidSignature
+	}
+
+	event := new(Event)
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Waits for the webhooks that are still to be delivered
+func (p *FakeProvider) Wait() {
+	p.pending.Wait()
+}
+
+func (p *FakeProvider) sign(timestamp string, payload []byte) string {
+	h := hmac.New(sha256.New, []byte(p.Secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Posts the signed event to the webhook url after the delay
+func (p *FakeProvider) notify(delay time.Duration, event Event) {
+	if p.WebhookURL == "" {
+		return
+	}
+
+	p.pending.Add(1)
+	time.AfterFunc(delay, func() {
+		defer p.pending.Done()
+
+		payload, _ := json.Marshal(event)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		req, err := http.NewRequest(http.MethodPost, p.WebhookURL, bytes.NewReader(payload))
+		if err != nil {
+			logging.Default.Error("fake payments: building the webhook", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(p.SignatureHeader(), "t="+timestamp+",v1="+p.sign(timestamp, payload))
+
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			logging.Default.Error("fake payments: webhook delivery failed", "error", err)
+			return
+		}
+		resp.Body.Close()
+	})
+}
@@ -0,0 +1,110 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	IntentStatusRequiresCapture = "requires_capture"
+	IntentStatusProcessing      = "processing"
+	IntentStatusSucceeded       = "succeeded"
+	IntentStatusFailed          = "failed"
+	IntentStatusRefunded        = "refunded"
+)
+
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventPaymentRefunded  = "payment.refunded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrIntentNotFound   = errors.New("payment intent not found")
+	ErrDeclined         = errors.New("payment declined")
+)
+
+// What we ask the gateway to charge
+type IntentParams struct {
+	Amount   int64
+	Currency string
+	// Our payment id, echoed back in the webhook events
+	Reference string
+	// Payment method token collected by the storefront
+	Method string
+}
+
+// A payment as seen by the gateway
+type Intent struct {
+	ID       string
+	Amount   int64
+	Currency string
+	Status   string
+}
+
+// A verified webhook notification
+type Event struct {
+	Type      string `json:"type"`
+	IntentID  string `json:"intent_id"`
+	Reference string `json:"reference"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Provider is implemented by every payment gateway
+type Provider interface {
+	// Name used in the webhook route and stored on payments
+	Name() string
+	CreateIntent(ctx context.Context, params IntentParams) (*Intent, error)
+	Capture(ctx context.Context, intentID string) (*Intent, error)
+	Refund(ctx context.Context, intentID string, amount int64) (*Intent, error)
+	// Header carrying the webhook signature
+	SignatureHeader() string
+	// Verifies the signature and decodes the webhook body
+	ParseWebhook(payload []byte, signature string) (*Event, error)
+}
+
+// Registry holds the providers available to the API by their names
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: map[string]Provider{}}
+	for _, provider := range providers {
+		r.Register(provider)
+	}
+	return r
+}
+
+// Makes a provider available under its name
+func (r *Registry) Register(provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[provider.Name()] = provider
+}
+
+// Returns the registered provider with the name
+func (r *Registry) Get(name string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Waits for the background work of the registered providers, like the webhooks
+// still to be delivered
+func (r *Registry) Wait() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, provider := range r.providers {
+		if waiter, ok := provider.(interface{ Wait() }); ok {
+			waiter.Wait()
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/payments"
+)
+
+func TestPaymentLifecycle(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	eve := s.verifiedUser("eve")
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+	storeId := s.createStore(bob, "Bob's shop")
+	s.createStore(eve, "Eve's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	orderId := s.placeOrder(alice, storeId, mugId, 2)
+
+	pay := fiber.Map{"order": orderId, "method": payments.FakeMethodSuccess}
+	s.call("POST", "/api/payments", "", pay).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("POST", "/api/payments", admin.Token, pay).expectForbidden("payment:create")
+	s.call("POST", "/api/payments", bob.Token, pay).expectFailure(fiber.StatusNotFound, "Order not found")
+	s.call("POST", "/api/payments", alice.Token, fiber.Map{"order": orderId, "method": "cash"}).
+		expectFailure(fiber.StatusBadRequest, "Failed to create the payment")
+
+	res := s.call("POST", "/api/payments", alice.Token, pay).expectSuccess(fiber.StatusCreated)
+	paymentId := res.str("data._id")
+	intentId := res.str("data.intent_id")
+	if res.str("data.status") != "processing" || res.num("data.amount") != 2400 {
+		t.Fatalf("unexpected payment %v", res.body)
+	}
+
+	// One payment at a time
+	s.call("POST", "/api/payments", alice.Token, pay).expectFailure(fiber.StatusConflict, "Order already has a payment")
+
+	// Settled by the provider's webhook, moving the order along. A retried
+	// event changes nothing.
+	succeeded := payments.Event{Type: payments.EventPaymentSucceeded, IntentID: intentId, Reference: paymentId, Amount: 2400, Currency: "usd"}
+	s.webhook(succeeded).expect(fiber.StatusOK)
+	s.webhook(succeeded).expect(fiber.StatusOK)
+	res = s.call("GET", "/api/payments/"+paymentId, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.status") != "succeeded" {
+		t.Fatalf("unexpected payment %v", res.body)
+	}
+	res = s.call("GET", "/api/stores/"+storeId+"/orders/"+orderId, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.status") != "paid" {
+		t.Fatalf("unexpected order %v", res.body)
+	}
+	s.call("POST", "/api/payments", alice.Token, pay).expectFailure(fiber.StatusConflict, "Order is not waiting for payment")
+
+	// Payments are for the payer and the store
+	s.call("GET", "/api/payments/"+paymentId, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", "/api/payments/"+paymentId, eve.Token, nil).expectForbidden("payment:read")
+
+	// Refunds are for the store
+	s.call("POST", "/api/payments/"+paymentId+"/refund", alice.Token, nil).expectForbidden("payment:refund")
+	s.call("POST", "/api/payments/"+paymentId+"/refund", eve.Token, nil).expectForbidden("payment:refund")
+	s.call("POST", "/api/payments/"+paymentId+"/refund", bob.Token, nil).expectSuccess(fiber.StatusAccepted)
+
+	s.webhook(payments.Event{Type: payments.EventPaymentRefunded, IntentID: intentId, Reference: paymentId, Amount: 2400, Currency: "usd"}).
+		expect(fiber.StatusOK)
+	res = s.call("GET", "/api/stores/"+storeId+"/orders/"+orderId, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.status") != "refunded" {
+		t.Fatalf("unexpected order %v", res.body)
+	}
+	s.call("POST", "/api/payments/"+paymentId+"/refund", bob.Token, nil).
+		expectFailure(fiber.StatusConflict, "Only succeeded payments can be refunded")
+}
+
+func TestPaymentDeclined(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	orderId := s.placeOrder(alice, storeId, mugId, 1)
+
+	res := s.call("POST", "/api/payments", alice.Token, fiber.Map{"order": orderId, "method": payments.FakeMethodDecline}).
+		expectFailure(fiber.StatusPaymentRequired, "Payment declined")
+	if res.str("data.status") != "failed" {
+		t.Fatalf("unexpected payment %v", res.body)
+	}
+
+	// The order can still be paid
+	s.call("POST", "/api/payments", alice.Token, fiber.Map{"order": orderId}).expectSuccess(fiber.StatusCreated)
+}
+
+func TestPaymentsOff(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.App.PaymentProvider = ""
+	s := newTestServerWith(t, cfg)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	orderId := s.placeOrder(alice, storeId, mugId, 1)
+
+	s.call("POST", "/api/payments", alice.Token, fiber.Map{"order": orderId}).
+		expectFailure(fiber.StatusServiceUnavailable, "Payments are not available")
+}
+
+func TestPaymentUnusable(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	storeId := s.createStore(bob, "Bob's shop")
+	mugId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	order := "/api/stores/" + storeId + "/orders/"
+
+	pay := func(orderId string) (string, string) {
+		res := s.call("POST", "/api/payments", alice.Token, fiber.Map{"order": orderId}).expectSuccess(fiber.StatusCreated)
+		return res.str("data._id"), res.str("data.intent_id")
+	}
+	expectOrder := func(orderId string, status string) {
+		t.Helper()
+		if res := s.call("GET", order+orderId, alice.Token, nil).expectSuccess(fiber.StatusOK); res.str("data.status") != status {
+			t.Fatalf("unexpected order %v", res.body)
+		}
+	}
+
+	// Charged less than the order costs: refunded, the order waits
+	orderId := s.placeOrder(alice, storeId, mugId, 1)
+	paymentId, intentId := pay(orderId)
+	s.webhook(payments.Event{Type: payments.EventPaymentSucceeded, IntentID: intentId, Reference: paymentId, Amount: 1, Currency: "usd"}).
+		expect(fiber.StatusOK)
+	expectOrder(orderId, "pending")
+	s.webhook(payments.Event{Type: payments.EventPaymentRefunded, IntentID: intentId, Reference: paymentId, Amount: 1, Currency: "usd"}).
+		expect(fiber.StatusOK)
+	expectOrder(orderId, "pending")
+
+	// Another currency is no better
+	paymentId, intentId = pay(orderId)
+	s.webhook(payments.Event{Type: payments.EventPaymentSucceeded, IntentID: intentId, Reference: paymentId, Amount: 1200, Currency: "eur"}).
+		expect(fiber.StatusOK)
+	expectOrder(orderId, "pending")
+
+	// Settling after the order was cancelled: refunded, the order stays cancelled
+	orderId = s.placeOrder(alice, storeId, mugId, 1)
+	paymentId, intentId = pay(orderId)
+	s.call("PATCH", order+orderId+"/status", alice.Token, fiber.Map{"status": "cancelled"}).expectSuccess(fiber.StatusOK)
+	s.webhook(payments.Event{Type: payments.EventPaymentSucceeded, IntentID: intentId, Reference: paymentId, Amount: 1200, Currency: "usd"}).
+		expect(fiber.StatusOK)
+	expectOrder(orderId, "cancelled")
+	s.call("POST", "/api/payments/"+paymentId+"/refund", bob.Token, nil).
+		expectFailure(fiber.StatusBadGateway, "Failed to refund the payment")
+}
+
+func TestPaymentWebhookSignature(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+
+	s.call("POST", "/api/payments/webhooks/unknown", "", "{}").expectFailure(fiber.StatusNotFound, "Unknown payment provider")
+
+	req := s.request("POST", "/api/payments/webhooks/fake", "", `{"type":"payment.succeeded","intent_id":"fake_pi_x"}`)
+	req.Header.Set("X-Fake-Signature", "t=1,v1=00")
+	s.send(req).expectFailure(fiber.StatusBadRequest, "Invalid webhook")
+
+	s.webhook(payments.Event{Type: payments.EventPaymentSucceeded, IntentID: "fake_pi_unknown"}).
+		expectFailure(fiber.StatusNotFound, "Payment not found")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProducts(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	eve := s.verifiedUser("eve")
+	storeId := s.createStore(bob, "Bob's shop")
+	products := "/api/stores/" + storeId + "/products"
+
+	product := fiber.Map{"title": "Mug", "sku": "MUG-1", "price": 1200, "stock": 3, "status": "active"}
+	s.call("POST", products, "", product).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("POST", products, eve.Token, product).expectForbidden("product:create")
+	s.call("POST", products, bob.Token, fiber.Map{"title": "Mug"}).expectFailure(fiber.StatusBadRequest, "")
+
+	mugId := s.call("POST", products, bob.Token, product).expectSuccess(fiber.StatusCreated).str("data.InsertedID")
+	s.call("POST", products, bob.Token, product).expectFailure(fiber.StatusConflict, "SKU already in use")
+
+	// Drafts aren't sold
+	draftId := s.call("POST", products, bob.Token, fiber.Map{"title": "Cup", "sku": "CUP-1", "price": 800}).
+		expectSuccess(fiber.StatusCreated).
+		str("data.InsertedID")
+	s.call("GET", products+"/"+draftId, "", nil).expectFailure(fiber.StatusNotFound, "Product not found")
+
+	res := s.call("GET", products, "", nil).expect(fiber.StatusOK)
+	if res.num("total") != 1 {
+		t.Fatalf("unexpected products %v", res.body)
+	}
+	res = s.call("GET", products+"/"+mugId, "", nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.title") != "Mug" || res.num("data.price") != 1200 {
+		t.Fatalf("unexpected product %v", res.body)
+	}
+	s.call("GET", products+"/"+primitive.NewObjectID().Hex(), "", nil).expectFailure(fiber.StatusNotFound, "Product not found")
+
+	// Update
+	s.call("PATCH", products+"/"+draftId, eve.Token, fiber.Map{"status": "active"}).expectForbidden("product:update")
+	s.call("PATCH", products+"/"+draftId, bob.Token, fiber.Map{"sku": "MUG-1"}).expectFailure(fiber.StatusConflict, "SKU already in use")
+	s.call("PATCH", products+"/"+draftId, bob.Token, fiber.Map{"status": "active"}).expectSuccess(fiber.StatusOK)
+	s.call("GET", products+"/"+draftId, "", nil).expectSuccess(fiber.StatusOK)
+
+	// Delete
+	s.call("DELETE", products+"/"+draftId, eve.Token, nil).expectForbidden("product:delete")
+	s.call("DELETE", products+"/"+draftId, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("DELETE", products+"/"+draftId, bob.Token, nil).expectFailure(fiber.StatusNotFound, "Product not found")
+}
+
+func TestInventory(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	eve := s.verifiedUser("eve")
+	storeId := s.createStore(bob, "Bob's shop")
+	productId := s.createProduct(bob, storeId, "MUG-1", 1200, 3)
+	inventory := "/api/stores/" + storeId + "/products/" + productId + "/inventory"
+
+	s.call("GET", inventory, eve.Token, nil).expectForbidden("inventory:read")
+	s.call("POST", inventory, eve.Token, fiber.Map{"delta": 5}).expectForbidden("inventory:adjust")
+
+	res := s.call("POST", inventory, bob.Token, fiber.Map{"delta": 5, "note": "restock"}).expectSuccess(fiber.StatusCreated)
+	if res.num("data.stock_after") != 8 {
+		t.Fatalf("unexpected adjustment %v", res.body)
+	}
+	s.call("POST", inventory, bob.Token, fiber.Map{"delta": -9}).expectFailure(fiber.StatusConflict, "Stock cannot go below zero")
+	s.call("POST", inventory, bob.Token, fiber.Map{}).expectFailure(fiber.StatusBadRequest, "")
+
+	// The initial stock and the restock
+	res = s.call("GET", inventory, bob.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 2 {
+		t.Fatalf("unexpected adjustments %v", res.body)
+	}
+
+	res = s.call("GET", "/api/stores/"+storeId+"/products/"+productId, "", nil).expectSuccess(fiber.StatusOK)
+	if res.num("data.stock") != 8 {
+		t.Fatalf("unexpected stock %v", res.body)
+	}
+}
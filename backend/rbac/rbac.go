@@ -0,0 +1,94 @@
+package rbac
+
+const (
+	// Platform administrator, can do everything
+	RoleAdmin = "admin"
+	// Owner of a store, scoped to the store
+	RoleStoreOwner = "store_owner"
+	// Staff running a store day to day, scoped to the store
+	RoleStoreManager = "store_manager"
+	// Staff preparing and shipping orders, scoped to the store
+	RoleStoreFulfillment = "store_fulfillment"
+	// Staff that can only look, scoped to the store
+	RoleStoreReadOnly = "store_read_only"
+	// Any logged in user
+	RoleCustomer = "customer"
+)
+
+// Permission granting every action
+const All = "*"
+
+var rolePermissions = map[string][]string{
+	RoleAdmin: {All},
+	RoleStoreOwner: {
+		"store:delete",
+		"product:create", "product:update", "product:delete",
+		"inventory:read", "inventory:adjust",
+		"order:list", "order:read", "order:update",
+		"payment:read", "payment:refund",
+		"member:list", "member:invite", "member:update", "member:remove",
+	},
+	RoleStoreManager: {
+		"product:create", "product:update", "product:delete",
+		"inventory:read", "inventory:adjust",
+		"order:list", "order:read", "order:update",
+		"payment:read", "payment:refund",
+		"member:list",
+	},
+	RoleStoreFulfillment: {
+		"inventory:read",
+		"order:list", "order:read", "order:update",
+	},
+	RoleStoreReadOnly: {
+		"inventory:read",
+		"order:list", "order:read",
+		"payment:read",
+		"member:list",
+	},
+	RoleCustomer: {
+		"store:create",
+		"order:create",
+		"payment:create",
+	},
+}
+
+// Roles that only make sense for a given store
+var storeRoles = map[string]bool{
+	RoleStoreOwner:       true,
+	RoleStoreManager:     true,
+	RoleStoreFulfillment: true,
+	RoleStoreReadOnly:    true,
+}
+
+// Checks if the role exists
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Checks if the role must be assigned for a store
+func IsStoreRole(role string) bool {
+	return storeRoles[role]
+}
+
+// Returns the permissions of every role
+func Roles() map[string][]string {
+	roles := map[string][]string{}
+	for role, permissions := range rolePermissions {
+		roles[role] = append([]string{}, permissions...)
+	}
+	return roles
+}
+
+// Checks if one of the roles grants the permission
+func Can(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, v := range rolePermissions[role] {
+			if v == All || v == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdminRepository keeps the platform administrators
+type AdminRepository interface {
+	TwoFactorRepository
+
+	// Every admin by username
+	List(ctx context.Context) ([]models.Admin, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Admin, error)
+	FindByUsername(ctx context.Context, username string) (*models.Admin, error)
+	Count(ctx context.Context) (int64, error)
+	// Inserts the admin and sets its ID, ErrConflict if the username or
+	// email is taken
+	Create(ctx context.Context, admin *models.Admin) error
+	SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error
+	// ErrNotFound if there is no such admin
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type mongoAdmins struct {
+	mongoTwoFactor
+}
+
+func (r *mongoAdmins) List(ctx context.Context) ([]models.Admin, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	admins := []models.Admin{}
+	return admins, cursor.All(ctx, &admins)
+}
+
+func (r *mongoAdmins) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Admin, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoAdmins) FindByUsername(ctx context.Context, username string) (*models.Admin, error) {
+	return r.findOne(ctx, bson.M{"username": username})
+}
+
+func (r *mongoAdmins) findOne(ctx context.Context, filter bson.M) (*models.Admin, error) {
+	var admin models.Admin
+	if err := r.collection.FindOne(ctx, filter).Decode(&admin); err != nil {
+		return nil, notFound(err)
+	}
+	return &admin, nil
+}
+
+func (r *mongoAdmins) Count(ctx context.Context) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{})
+}
+
+func (r *mongoAdmins) Create(ctx context.Context, admin *models.Admin) error {
+	result, err := r.collection.InsertOne(ctx, admin)
+	if err != nil {
+		return duplicate(err)
+	}
+	admin.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoAdmins) SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"password": hash}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAdmins) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryAdmins struct {
+	memoryTwoFactor
+}
+
+func (r *memoryAdmins) List(ctx context.Context) ([]models.Admin, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	admins := []models.Admin{}
+	if err := r.db.collection(r.name).all(&admins); err != nil {
+		return nil, err
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].Username < admins[j].Username })
+	return admins, nil
+}
+
+func (r *memoryAdmins) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Admin, error) {
+	return r.findOne(func(admin *models.Admin) bool { return admin.ID == id })
+}
+
+func (r *memoryAdmins) FindByUsername(ctx context.Context, username string) (*models.Admin, error) {
+	return r.findOne(func(admin *models.Admin) bool { return admin.Username == username })
+}
+
+func (r *memoryAdmins) findOne(match func(admin *models.Admin) bool) (*models.Admin, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var admins []models.Admin
+	if err := r.db.collection(r.name).all(&admins); err != nil {
+		return nil, err
+	}
+	for i := range admins {
+		if match(&admins[i]) {
+			return &admins[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryAdmins) Count(ctx context.Context) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	return int64(len(r.db.collection(r.name).docs)), nil
+}
+
+func (r *memoryAdmins) Create(ctx context.Context, admin *models.Admin) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	// Like the unique indexes
+	var admins []models.Admin
+	if err := r.db.collection(r.name).all(&admins); err != nil {
+		return err
+	}
+	for _, other := range admins {
+		if admin.Username != "" && other.Username == admin.Username || admin.Email != "" && other.Email == admin.Email {
+			return ErrConflict
+		}
+	}
+
+	admin.ID = newID(admin.ID)
+	return r.db.collection(r.name).insert(admin)
+}
+
+// Index of the admin with the id, -1 if there is none. The lock must be held.
+func (r *memoryAdmins) index(id primitive.ObjectID) (int, error) {
+	var admins []models.Admin
+	if err := r.db.collection(r.name).all(&admins); err != nil {
+		return -1, err
+	}
+	for i := range admins {
+		if admins[i].ID == id {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (r *memoryAdmins) SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return ErrNotFound
+	}
+	return r.db.collection(r.name).update(i, bson.M{"password": hash})
+}
+
+func (r *memoryAdmins) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.db.collection(r.name).remove(i)
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Shopper a cart of a store belongs to: a logged in user, or else an anonymous
+// cart token
+type CartOwner struct {
+	Store primitive.ObjectID
+	User  primitive.ObjectID
+	Token string
+}
+
+func (owner CartOwner) filter() bson.M {
+	if !owner.User.IsZero() {
+		return bson.M{"store": owner.Store, "user": owner.User}
+	}
+	return bson.M{"store": owner.Store, "token": owner.Token}
+}
+
+// CartRepository keeps the shopping carts
+type CartRepository interface {
+	Find(ctx context.Context, owner CartOwner) (*models.Cart, error)
+	// Anonymous carts of the token, in every store
+	ListAnonymous(ctx context.Context, token string) ([]models.Cart, error)
+	// Inserts the cart, setting its ID, or replaces it
+	Save(ctx context.Context, cart *models.Cart) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteByOwner(ctx context.Context, owner CartOwner) error
+	DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error
+}
+
+type mongoCarts struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoCarts) Find(ctx context.Context, owner CartOwner) (*models.Cart, error) {
+	var cart models.Cart
+	if err := r.collection.FindOne(ctx, owner.filter()).Decode(&cart); err != nil {
+		return nil, notFound(err)
+	}
+	return &cart, nil
+}
+
+func (r *mongoCarts) ListAnonymous(ctx context.Context, token string) ([]models.Cart, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"token": token, "user": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var carts []models.Cart
+	if err := cursor.All(ctx, &carts); err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
+
+func (r *mongoCarts) Save(ctx context.Context, cart *models.Cart) error {
+	if cart.ID.IsZero() {
+		result, err := r.collection.InsertOne(ctx, cart)
+		if err != nil {
+			return err
+		}
+		cart.ID = result.InsertedID.(primitive.ObjectID)
+		return nil
+	}
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": cart.ID}, cart)
+	return err
+}
+
+func (r *mongoCarts) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoCarts) DeleteByOwner(ctx context.Context, owner CartOwner) error {
+	_, err := r.collection.DeleteOne(ctx, owner.filter())
+	return err
+}
+
+func (r *mongoCarts) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"store": storeId})
+	return err
+}
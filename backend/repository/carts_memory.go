@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (owner CartOwner) owns(cart *models.Cart) bool {
+	if cart.Store != owner.Store {
+		return false
+	}
+	if !owner.User.IsZero() {
+		return cart.User == owner.User
+	}
+	return cart.Token == owner.Token
+}
+
+type memoryCarts struct {
+	db *memoryDB
+}
+
+func (r *memoryCarts) load() (*memoryCollection, []models.Cart, error) {
+	collection := r.db.collection("carts")
+	var carts []models.Cart
+	if err := collection.all(&carts); err != nil {
+		return nil, nil, err
+	}
+	return collection, carts, nil
+}
+
+func (r *memoryCarts) Find(ctx context.Context, owner CartOwner) (*models.Cart, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, carts, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range carts {
+		if owner.owns(&carts[i]) {
+			return &carts[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryCarts) ListAnonymous(ctx context.Context, token string) ([]models.Cart, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, carts, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []models.Cart{}
+	for _, cart := range carts {
+		if cart.Token == token && cart.User.IsZero() {
+			found = append(found, cart)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryCarts) Save(ctx context.Context, cart *models.Cart) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, carts, err := r.load()
+	if err != nil {
+		return err
+	}
+	if cart.ID.IsZero() {
+		cart.ID = primitive.NewObjectID()
+		return collection.insert(cart)
+	}
+	for i := range carts {
+		if carts[i].ID == cart.ID {
+			return collection.set(i, cart)
+		}
+	}
+	return nil
+}
+
+func (r *memoryCarts) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.remove(func(cart *models.Cart) bool { return cart.ID == id })
+}
+
+func (r *memoryCarts) DeleteByOwner(ctx context.Context, owner CartOwner) error {
+	return r.remove(owner.owns)
+}
+
+func (r *memoryCarts) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, carts, err := r.load()
+	if err != nil {
+		return err
+	}
+	indexes := []int{}
+	for i, cart := range carts {
+		if cart.Store == storeId {
+			indexes = append(indexes, i)
+		}
+	}
+	collection.remove(indexes...)
+	return nil
+}
+
+// Removes the first cart matching
+func (r *memoryCarts) remove(match func(cart *models.Cart) bool) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, carts, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i := range carts {
+		if match(&carts[i]) {
+			collection.remove(i)
+			break
+		}
+	}
+	return nil
+}
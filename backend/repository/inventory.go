@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InventoryRepository keeps the history of the stock changes
+type InventoryRepository interface {
+	// Inserts the adjustment and sets its ID
+	Create(ctx context.Context, adjustment *models.InventoryAdjustment) error
+	// Adjustments of the product, newest first
+	List(ctx context.Context, storeId primitive.ObjectID, productId primitive.ObjectID, page Page) ([]models.InventoryAdjustment, int64, error)
+}
+
+// ReservationRepository keeps the stock held for unpaid orders
+type ReservationRepository interface {
+	CreateMany(ctx context.Context, reservations []models.Reservation) error
+	// Reservations of the order with one of the statuses
+	ListByOrder(ctx context.Context, orderId primitive.ObjectID, statuses ...string) ([]models.Reservation, error)
+	// Moves every reservation of the order from a status to another
+	SetOrderStatus(ctx context.Context, orderId primitive.ObjectID, from string, to string) error
+	// Moves the reservation to a status if it is still in from, false when it
+	// isn't so only one caller acts on the change
+	SetStatus(ctx context.Context, id primitive.ObjectID, from string, to string) (bool, error)
+	// Orders with held reservations expired at now
+	ExpiredOrders(ctx context.Context, now time.Time) ([]primitive.ObjectID, error)
+}
+
+type mongoInventory struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoInventory) Create(ctx context.Context, adjustment *models.InventoryAdjustment) error {
+	result, err := r.collection.InsertOne(ctx, adjustment)
+	if err != nil {
+		return err
+	}
+	adjustment.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoInventory) List(ctx context.Context, storeId primitive.ObjectID, productId primitive.ObjectID, page Page) ([]models.InventoryAdjustment, int64, error) {
+	filter := bson.M{"store": storeId, "product": productId}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	var adjustments []models.InventoryAdjustment
+	total, err := findPage(ctx, r.collection, filter, findOptions, page, &adjustments)
+	return adjustments, total, err
+}
+
+type mongoReservations struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoReservations) CreateMany(ctx context.Context, reservations []models.Reservation) error {
+	documents := []interface{}{}
+	for _, reservation := range reservations {
+		documents = append(documents, reservation)
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+
+	_, err := r.collection.InsertMany(ctx, documents)
+	return err
+}
+
+func (r *mongoReservations) ListByOrder(ctx context.Context, orderId primitive.ObjectID, statuses ...string) ([]models.Reservation, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"order": orderId, "status": bson.M{"$in": statuses}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reservations []models.Reservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+func (r *mongoReservations) SetOrderStatus(ctx context.Context, orderId primitive.ObjectID, from string, to string) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{"order": orderId, "status": from}, bson.M{
+		"$set": bson.M{"status": to},
+	})
+	return err
+}
+
+func (r *mongoReservations) SetStatus(ctx context.Context, id primitive.ObjectID, from string, to string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{
+		"$set": bson.M{"status": to},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoReservations) ExpiredOrders(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	filter := bson.M{"status": models.ReservationStatusHeld, "expires_at": bson.M{"$lt": now}}
+	values, err := r.collection.Distinct(ctx, "order", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	orderIds := []primitive.ObjectID{}
+	for _, value := range values {
+		if orderId, ok := value.(primitive.ObjectID); ok {
+			orderIds = append(orderIds, orderId)
+		}
+	}
+	return orderIds, nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryInventory struct {
+	db *memoryDB
+}
+
+func (r *memoryInventory) Create(ctx context.Context, adjustment *models.InventoryAdjustment) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	adjustment.ID = newID(adjustment.ID)
+	return r.db.collection("inventory_adjustments").insert(adjustment)
+}
+
+func (r *memoryInventory) List(ctx context.Context, storeId primitive.ObjectID, productId primitive.ObjectID, page Page) ([]models.InventoryAdjustment, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var adjustments []models.InventoryAdjustment
+	if err := r.db.collection("inventory_adjustments").all(&adjustments); err != nil {
+		return nil, 0, err
+	}
+
+	// Newest first
+	found := []models.InventoryAdjustment{}
+	for i := len(adjustments) - 1; i >= 0; i-- {
+		if adjustments[i].Store == storeId && adjustments[i].Product == productId {
+			found = append(found, adjustments[i])
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+type memoryReservations struct {
+	db *memoryDB
+}
+
+func (r *memoryReservations) load() (*memoryCollection, []models.Reservation, error) {
+	collection := r.db.collection("reservations")
+	var reservations []models.Reservation
+	if err := collection.all(&reservations); err != nil {
+		return nil, nil, err
+	}
+	return collection, reservations, nil
+}
+
+func (r *memoryReservations) CreateMany(ctx context.Context, reservations []models.Reservation) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection := r.db.collection("reservations")
+	for _, reservation := range reservations {
+		reservation.ID = newID(reservation.ID)
+		if err := collection.insert(reservation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryReservations) ListByOrder(ctx context.Context, orderId primitive.ObjectID, statuses ...string) ([]models.Reservation, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, reservations, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []models.Reservation{}
+	for _, reservation := range reservations {
+		if reservation.Order != orderId {
+			continue
+		}
+		for _, status := range statuses {
+			if reservation.Status == status {
+				found = append(found, reservation)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryReservations) SetOrderStatus(ctx context.Context, orderId primitive.ObjectID, from string, to string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, reservations, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i, reservation := range reservations {
+		if reservation.Order == orderId && reservation.Status == from {
+			if err := collection.update(i, bson.M{"status": to}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memoryReservations) SetStatus(ctx context.Context, id primitive.ObjectID, from string, to string) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, reservations, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for i, reservation := range reservations {
+		if reservation.ID == id && reservation.Status == from {
+			return true, collection.update(i, bson.M{"status": to})
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryReservations) ExpiredOrders(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, reservations, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	orderIds := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, reservation := range reservations {
+		if reservation.Status != models.ReservationStatusHeld || !reservation.ExpiresAt.Before(now) || seen[reservation.Order] {
+			continue
+		}
+		seen[reservation.Order] = true
+		orderIds = append(orderIds, reservation.Order)
+	}
+	return orderIds, nil
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/rbac"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemberRepository keeps the staff of the stores. The store's owner is a
+// member too, its role can't be changed or removed.
+type MemberRepository interface {
+	// Adds the user to the store or changes their role
+	Add(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID, role string, invitedBy primitive.ObjectID) error
+	Find(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID) (*models.StoreMember, error)
+	List(ctx context.Context, storeId primitive.ObjectID, page Page) ([]models.StoreMember, int64, error)
+	// Memberships of the user in every store
+	ListByUser(ctx context.Context, userId primitive.ObjectID) ([]models.StoreMember, error)
+	// Changes the role of a member other than the owner
+	UpdateRole(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID, role string) error
+	// Removes a member other than the owner
+	Remove(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID) error
+	DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error
+}
+
+// InviteRepository keeps the invitations to join a store, found by the hash
+// of their token
+type InviteRepository interface {
+	// Inserts the invite and sets its ID
+	Create(ctx context.Context, invite *models.StoreInvite) error
+	FindByToken(ctx context.Context, tokenHash string) (*models.StoreInvite, error)
+	// Invites of the store still waiting for an answer at now
+	ListPending(ctx context.Context, storeId primitive.ObjectID, now time.Time, page Page) ([]models.StoreInvite, int64, error)
+	// Revokes a pending invite of the store
+	Revoke(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, at time.Time) error
+	// Answers the pending unexpired invite with the token and returns it.
+	// Only one caller can ever answer an invite.
+	Answer(ctx context.Context, tokenHash string, status string, at time.Time) (*models.StoreInvite, error)
+	DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error
+}
+
+type mongoMembers struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoMembers) Add(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID, role string, invitedBy primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"store": storeId, "user": userId}, bson.M{
+		"$set":         bson.M{"role": role},
+		"$setOnInsert": bson.M{"invited_by": invitedBy, "created_at": time.Now()},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoMembers) Find(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID) (*models.StoreMember, error) {
+	var member models.StoreMember
+	if err := r.collection.FindOne(ctx, bson.M{"store": storeId, "user": userId}).Decode(&member); err != nil {
+		return nil, notFound(err)
+	}
+	return &member, nil
+}
+
+func (r *mongoMembers) List(ctx context.Context, storeId primitive.ObjectID, page Page) ([]models.StoreMember, int64, error) {
+	var members []models.StoreMember
+	total, err := findPage(ctx, r.collection, bson.M{"store": storeId}, options.Find(), page, &members)
+	return members, total, err
+}
+
+func (r *mongoMembers) ListByUser(ctx context.Context, userId primitive.ObjectID) ([]models.StoreMember, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user": userId})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var members []models.StoreMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *mongoMembers) UpdateRole(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID, role string) error {
+	filter := bson.M{"store": storeId, "user": userId, "role": bson.M{"$ne": rbac.RoleStoreOwner}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoMembers) Remove(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID) error {
+	filter := bson.M{"store": storeId, "user": userId, "role": bson.M{"$ne": rbac.RoleStoreOwner}}
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoMembers) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"store": storeId})
+	return err
+}
+
+type mongoInvites struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoInvites) Create(ctx context.Context, invite *models.StoreInvite) error {
+	result, err := r.collection.InsertOne(ctx, invite)
+	if err != nil {
+		return err
+	}
+	invite.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoInvites) FindByToken(ctx context.Context, tokenHash string) (*models.StoreInvite, error) {
+	var invite models.StoreInvite
+	if err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&invite); err != nil {
+		return nil, notFound(err)
+	}
+	return &invite, nil
+}
+
+func (r *mongoInvites) ListPending(ctx context.Context, storeId primitive.ObjectID, now time.Time, page Page) ([]models.StoreInvite, int64, error) {
+	var invites []models.StoreInvite
+	filter := bson.M{"store": storeId, "status": models.InviteStatusPending, "expires_at": bson.M{"$gt": now}}
+	total, err := findPage(ctx, r.collection, filter, options.Find(), page, &invites)
+	return invites, total, err
+}
+
+func (r *mongoInvites) Revoke(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, at time.Time) error {
+	filter := bson.M{"_id": id, "store": storeId, "status": models.InviteStatusPending}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"status": models.InviteStatusRevoked, "answered_at": at},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoInvites) Answer(ctx context.Context, tokenHash string, status string, at time.Time) (*models.StoreInvite, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"status":     models.InviteStatusPending,
+		"expires_at": bson.M{"$gt": at},
+	}
+	update := bson.M{"$set": bson.M{"status": status, "answered_at": at}}
+
+	var invite models.StoreInvite
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&invite); err != nil {
+		return nil, notFound(err)
+	}
+	return &invite, nil
+}
+
+func (r *mongoInvites) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"store": storeId})
+	return err
+}
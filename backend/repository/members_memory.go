@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/rbac"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryMembers struct {
+	db *memoryDB
+}
+
+func (r *memoryMembers) load() (*memoryCollection, []models.StoreMember, error) {
+	collection := r.db.collection("store_members")
+	var members []models.StoreMember
+	if err := collection.all(&members); err != nil {
+		return nil, nil, err
+	}
+	return collection, members, nil
+}
+
+func (r *memoryMembers) Add(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID, role string, invitedBy primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, members, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i, member := range members {
+		if member.Store == storeId && member.User == userId {
+			return collection.update(i, bson.M{"role": role})
+		}
+	}
+	return collection.insert(models.StoreMember{
+		ID:        primitive.NewObjectID(),
+		Store:     storeId,
+		User:      userId,
+		Role:      role,
+		InvitedBy: invitedBy,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (r *memoryMembers) Find(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID) (*models.StoreMember, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, members, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range members {
+		if members[i].Store == storeId && members[i].User == userId {
+			return &members[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryMembers) List(ctx context.Context, storeId primitive.ObjectID, page Page) ([]models.StoreMember, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, members, err := r.load()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found := []models.StoreMember{}
+	for _, member := range members {
+		if member.Store == storeId {
+			found = append(found, member)
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryMembers) ListByUser(ctx context.Context, userId primitive.ObjectID) ([]models.StoreMember, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, members, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []models.StoreMember{}
+	for _, member := range members {
+		if member.User == userId {
+			found = append(found, member)
+		}
+	}
+	return found, nil
+}
+
+// Index of the member of the store other than the owner, -1 if there is none
+func (r *memoryMembers) staff(members []models.StoreMember, storeId primitive.ObjectID, userId primitive.ObjectID) int {
+	for i, member := range members {
+		if member.Store == storeId && member.User == userId && member.Role != rbac.RoleStoreOwner {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *memoryMembers) UpdateRole(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID, role string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, members, err := r.load()
+	if err != nil {
+		return err
+	}
+	i := r.staff(members, storeId, userId)
+	if i < 0 {
+		return ErrNotFound
+	}
+	return collection.update(i, bson.M{"role": role})
+}
+
+func (r *memoryMembers) Remove(ctx context.Context, storeId primitive.ObjectID, userId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, members, err := r.load()
+	if err != nil {
+		return err
+	}
+	i := r.staff(members, storeId, userId)
+	if i < 0 {
+		return ErrNotFound
+	}
+	collection.remove(i)
+	return nil
+}
+
+func (r *memoryMembers) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, members, err := r.load()
+	if err != nil {
+		return err
+	}
+	indexes := []int{}
+	for i, member := range members {
+		if member.Store == storeId {
+			indexes = append(indexes, i)
+		}
+	}
+	collection.remove(indexes...)
+	return nil
+}
+
+type memoryInvites struct {
+	db *memoryDB
+}
+
+func (r *memoryInvites) load() (*memoryCollection, []models.StoreInvite, error) {
+	collection := r.db.collection("store_invites")
+	var invites []models.StoreInvite
+	if err := collection.all(&invites); err != nil {
+		return nil, nil, err
+	}
+	return collection, invites, nil
+}
+
+func (r *memoryInvites) Create(ctx context.Context, invite *models.StoreInvite) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	invite.ID = newID(invite.ID)
+	return r.db.collection("store_invites").insert(invite)
+}
+
+func (r *memoryInvites) FindByToken(ctx context.Context, tokenHash string) (*models.StoreInvite, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, invites, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range invites {
+		if invites[i].TokenHash == tokenHash {
+			return &invites[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryInvites) ListPending(ctx context.Context, storeId primitive.ObjectID, now time.Time, page Page) ([]models.StoreInvite, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, invites, err := r.load()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found := []models.StoreInvite{}
+	for _, invite := range invites {
+		if invite.Store == storeId && invite.Status == models.InviteStatusPending && invite.ExpiresAt.After(now) {
+			found = append(found, invite)
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryInvites) Revoke(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, invites, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i, invite := range invites {
+		if invite.ID == id && invite.Store == storeId && invite.Status == models.InviteStatusPending {
+			return collection.update(i, bson.M{"status": models.InviteStatusRevoked, "answered_at": at})
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryInvites) Answer(ctx context.Context, tokenHash string, status string, at time.Time) (*models.StoreInvite, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, invites, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range invites {
+		invite := &invites[i]
+		if invite.TokenHash != tokenHash || invite.Status != models.InviteStatusPending || !invite.ExpiresAt.After(at) {
+			continue
+		}
+		invite.Status = status
+		invite.AnsweredAt = at
+		return invite, collection.set(i, invite)
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryInvites) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, invites, err := r.load()
+	if err != nil {
+		return err
+	}
+	indexes := []int{}
+	for i, invite := range invites {
+		if invite.Store == storeId {
+			indexes = append(indexes, i)
+		}
+	}
+	collection.remove(indexes...)
+	return nil
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Repositories kept in memory, empty on creation and gone with the process.
+// They behave like the Mongo ones, conditional changes included, so the HTTP
+// API can be run and tested without a database.
+func NewMemory() *Repositories {
+	db := &memoryDB{collections: map[string]*memoryCollection{}}
+	return &Repositories{
+		Users:          &memoryUsers{memoryTwoFactor{db, "users"}},
+		Admins:         &memoryAdmins{memoryTwoFactor{db, "admins"}},
+		Stores:         &memoryStores{db},
+		Members:        &memoryMembers{db},
+		Invites:        &memoryInvites{db},
+		Roles:          &memoryRoles{db},
+		Products:       &memoryProducts{db},
+		Inventory:      &memoryInventory{db},
+		Reservations:   &memoryReservations{db},
+		Carts:          &memoryCarts{db},
+		Orders:         &memoryOrders{db},
+		Payments:       &memoryPayments{db},
+		Sessions:       &memorySessions{db},
+		PasswordResets: &memoryPasswordResets{db},
+		Settings:       &memorySettings{db},
+		Audit:          &memoryAudit{db},
+		Snapshots:      db,
+	}
+}
+
+// Collections of documents behind a single lock, every repository method
+// holds it for its whole run so conditional changes are atomic
+type memoryDB struct {
+	mu          sync.Mutex
+	collections map[string]*memoryCollection
+}
+
+// Documents in insertion order, kept as BSON so callers only ever get copies
+// and the stored fields are the ones Mongo would store
+type memoryCollection struct {
+	docs []bson.Raw
+}
+
+// Collection of the name, created on first use. The lock must be held.
+func (db *memoryDB) collection(name string) *memoryCollection {
+	collection, ok := db.collections[name]
+	if !ok {
+		collection = &memoryCollection{}
+		db.collections[name] = collection
+	}
+	return collection
+}
+
+func (db *memoryDB) Snapshot(ctx context.Context, collection string, filter bson.M) (bson.M, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, doc := range db.collection(collection).docs {
+		var document bson.M
+		if err := bson.Unmarshal(doc, &document); err != nil {
+			return nil, err
+		}
+		if matches(document, filter) {
+			return document, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Whether every field of the filter equals the document's
+func matches(document bson.M, filter bson.M) bool {
+	for field, value := range filter {
+		if !reflect.DeepEqual(document[field], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Appends the document
+func (c *memoryCollection) insert(document interface{}) error {
+	doc, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	c.docs = append(c.docs, doc)
+	return nil
+}
+
+// Decodes every document into out, a pointer to a slice. The index of an
+// item is the one to change it with.
+func (c *memoryCollection) all(out interface{}) error {
+	slice := reflect.ValueOf(out).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(c.docs)))
+	for _, doc := range c.docs {
+		item := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(doc, item.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, item.Elem()))
+	}
+	return nil
+}
+
+// Replaces the document at i
+func (c *memoryCollection) set(i int, document interface{}) error {
+	doc, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	c.docs[i] = doc
+	return nil
+}
+
+// Sets the fields of changes on the document at i and removes the unset ones,
+// like $set and $unset
+func (c *memoryCollection) update(i int, changes interface{}, unset ...string) error {
+	var document bson.M
+	if err := bson.Unmarshal(c.docs[i], &document); err != nil {
+		return err
+	}
+
+	if changes != nil {
+		doc, err := bson.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		var fields bson.M
+		if err := bson.Unmarshal(doc, &fields); err != nil {
+			return err
+		}
+		for field, value := range fields {
+			document[field] = value
+		}
+	}
+	for _, field := range unset {
+		delete(document, field)
+	}
+
+	return c.set(i, document)
+}
+
+// Removes the documents at the indexes, in increasing order
+func (c *memoryCollection) remove(indexes ...int) {
+	for n, i := range indexes {
+		c.docs = append(c.docs[:i-n], c.docs[i-n+1:]...)
+	}
+}
+
+// Bounds of the page within total items
+func (page Page) bounds(total int) (int, int) {
+	start := int(page.Skip)
+	if start > total {
+		start = total
+	}
+	end := total
+	if page.Limit > 0 && start+int(page.Limit) < end {
+		end = start + int(page.Limit)
+	}
+	return start, end
+}
+
+// Matcher of the search like the text index of searchFilter: a value
+// matches when one of its words is one of the search words, ignoring case.
+// No stemming, phrases or negation. Matches everything when search is empty.
+func searchMatcher(search string) func(values ...string) bool {
+	terms := searchWords(search)
+	if len(terms) == 0 {
+		return func(values ...string) bool { return true }
+	}
+
+	return func(values ...string) bool {
+		for _, value := range values {
+			for _, word := range searchWords(value) {
+				for _, term := range terms {
+					if word == term {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Lower case words of the text, split on what isn't a letter or a digit
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ID for a document inserted without one
+func newID(id primitive.ObjectID) primitive.ObjectID {
+	if id.IsZero() {
+		return primitive.NewObjectID()
+	}
+	return id
+}
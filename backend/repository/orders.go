@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Orders to list
+type OrderFilter struct {
+	// Orders of these stores, of every store when nil
+	Stores []primitive.ObjectID
+	// Orders of the customer, of everyone when zero
+	Customer primitive.ObjectID
+	Status   string
+}
+
+// OrderRepository keeps the orders
+type OrderRepository interface {
+	// Inserts the order with its ID
+	Create(ctx context.Context, order *models.Order) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error)
+	// Orders matching the filter, newest first
+	List(ctx context.Context, filter OrderFilter, page Page) ([]models.Order, int64, error)
+	// Moves the order to the transition's status if it is still in from and
+	// appends the transition to its history, ErrConflict otherwise
+	Transition(ctx context.Context, id primitive.ObjectID, from string, transition models.OrderTransition) error
+}
+
+type mongoOrders struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoOrders) Create(ctx context.Context, order *models.Order) error {
+	_, err := r.collection.InsertOne(ctx, order)
+	return err
+}
+
+func (r *mongoOrders) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	var order models.Order
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&order); err != nil {
+		return nil, notFound(err)
+	}
+	return &order, nil
+}
+
+func (r *mongoOrders) List(ctx context.Context, filter OrderFilter, page Page) ([]models.Order, int64, error) {
+	query := bson.M{}
+	if filter.Stores != nil {
+		query["store"] = bson.M{"$in": filter.Stores}
+	}
+	if !filter.Customer.IsZero() {
+		query["customer"] = filter.Customer
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	var orders []models.Order
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	total, err := findPage(ctx, r.collection, query, findOptions, page, &orders)
+	return orders, total, err
+}
+
+func (r *mongoOrders) Transition(ctx context.Context, id primitive.ObjectID, from string, transition models.OrderTransition) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{
+		"$set":  bson.M{"status": transition.To, "updated_at": transition.At},
+		"$push": bson.M{"history": transition},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
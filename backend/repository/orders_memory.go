@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (filter OrderFilter) matches(order *models.Order) bool {
+	if filter.Stores != nil {
+		found := false
+		for _, store := range filter.Stores {
+			if order.Store == store {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !filter.Customer.IsZero() && order.Customer != filter.Customer {
+		return false
+	}
+	return filter.Status == "" || order.Status == filter.Status
+}
+
+type memoryOrders struct {
+	db *memoryDB
+}
+
+func (r *memoryOrders) load() (*memoryCollection, []models.Order, error) {
+	collection := r.db.collection("orders")
+	var orders []models.Order
+	if err := collection.all(&orders); err != nil {
+		return nil, nil, err
+	}
+	return collection, orders, nil
+}
+
+func (r *memoryOrders) Create(ctx context.Context, order *models.Order) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	order.ID = newID(order.ID)
+	return r.db.collection("orders").insert(order)
+}
+
+func (r *memoryOrders) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, orders, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		if orders[i].ID == id {
+			return &orders[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryOrders) List(ctx context.Context, filter OrderFilter, page Page) ([]models.Order, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, orders, err := r.load()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Newest first
+	found := []models.Order{}
+	for i := len(orders) - 1; i >= 0; i-- {
+		if filter.matches(&orders[i]) {
+			found = append(found, orders[i])
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryOrders) Transition(ctx context.Context, id primitive.ObjectID, from string, transition models.OrderTransition) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, orders, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		order := &orders[i]
+		if order.ID != id || order.Status != from {
+			continue
+		}
+		order.Status = transition.To
+		order.UpdatedAt = transition.At
+		order.History = append(order.History, transition)
+		return collection.set(i, order)
+	}
+	return ErrConflict
+}
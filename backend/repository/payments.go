@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PaymentRepository keeps the payments and their status
+type PaymentRepository interface {
+	// Inserts the payment with its ID, ErrConflict when the order already has
+	// an active payment
+	Create(ctx context.Context, payment *models.Payment) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+	// Payment of the provider's intent
+	FindByIntent(ctx context.Context, provider string, intentId string) (*models.Payment, error)
+	// Pending, processing or succeeded payment of the order
+	FindActiveByOrder(ctx context.Context, order primitive.ObjectID) (*models.Payment, error)
+	// Moves the payment to a status if it is in one of from, false when it
+	// isn't so a status is only applied once
+	SetStatus(ctx context.Context, id primitive.ObjectID, from []string, status string, reason string, at time.Time) (bool, error)
+}
+
+type mongoPayments struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPayments) Create(ctx context.Context, payment *models.Payment) error {
+	payment.Active = models.PaymentStatusActive(payment.Status)
+	_, err := r.collection.InsertOne(ctx, payment)
+	return duplicate(err)
+}
+
+func (r *mongoPayments) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoPayments) FindByIntent(ctx context.Context, provider string, intentId string) (*models.Payment, error) {
+	return r.findOne(ctx, bson.M{"provider": provider, "intent_id": intentId})
+}
+
+func (r *mongoPayments) FindActiveByOrder(ctx context.Context, order primitive.ObjectID) (*models.Payment, error) {
+	return r.findOne(ctx, bson.M{"order": order, "active": true})
+}
+
+func (r *mongoPayments) findOne(ctx context.Context, filter bson.M) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.collection.FindOne(ctx, filter).Decode(&payment); err != nil {
+		return nil, notFound(err)
+	}
+	return &payment, nil
+}
+
+func (r *mongoPayments) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, status string, reason string, at time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "status": bson.M{"$in": from}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"status": status, "active": models.PaymentStatusActive(status), "failure_reason": reason, "updated_at": at},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
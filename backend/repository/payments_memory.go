@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryPayments struct {
+	db *memoryDB
+}
+
+func (r *memoryPayments) load() (*memoryCollection, []models.Payment, error) {
+	collection := r.db.collection("payments")
+	var payments []models.Payment
+	if err := collection.all(&payments); err != nil {
+		return nil, nil, err
+	}
+	return collection, payments, nil
+}
+
+func (r *memoryPayments) Create(ctx context.Context, payment *models.Payment) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, payments, err := r.load()
+	if err != nil {
+		return err
+	}
+	payment.Active = models.PaymentStatusActive(payment.Status)
+	for _, other := range payments {
+		if payment.Active && other.Active && other.Order == payment.Order {
+			return ErrConflict
+		}
+	}
+
+	payment.ID = newID(payment.ID)
+	return r.db.collection("payments").insert(payment)
+}
+
+func (r *memoryPayments) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	return r.findOne(func(payment *models.Payment) bool { return payment.ID == id })
+}
+
+func (r *memoryPayments) FindByIntent(ctx context.Context, provider string, intentId string) (*models.Payment, error) {
+	return r.findOne(func(payment *models.Payment) bool {
+		return payment.Provider == provider && payment.IntentID == intentId
+	})
+}
+
+func (r *memoryPayments) FindActiveByOrder(ctx context.Context, order primitive.ObjectID) (*models.Payment, error) {
+	return r.findOne(func(payment *models.Payment) bool { return payment.Order == order && payment.Active })
+}
+
+func (r *memoryPayments) findOne(match func(payment *models.Payment) bool) (*models.Payment, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, payments, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range payments {
+		if match(&payments[i]) {
+			return &payments[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPayments) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, status string, reason string, at time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, payments, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for i, payment := range payments {
+		if payment.ID != id {
+			continue
+		}
+		for _, current := range from {
+			if payment.Status == current {
+				return true, collection.update(i, bson.M{"status": status, "active": models.PaymentStatusActive(status), "failure_reason": reason, "updated_at": at})
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
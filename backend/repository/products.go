@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProductRepository keeps the products of the stores
+type ProductRepository interface {
+	// Products of the store with the status whose title or SKU matches the
+	// search, all of them when it is empty
+	List(ctx context.Context, storeId primitive.ObjectID, status string, search string, page Page) ([]models.Product, int64, error)
+	Find(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID) (*models.Product, error)
+	// Products of the store among the ids, the missing ones are skipped
+	FindMany(ctx context.Context, storeId primitive.ObjectID, ids []primitive.ObjectID) ([]models.Product, error)
+	// Whether another product than except uses the SKU in the store
+	SKUExists(ctx context.Context, storeId primitive.ObjectID, sku string, except primitive.ObjectID) (bool, error)
+	// Inserts the product and sets its ID
+	Create(ctx context.Context, product *models.Product) error
+	// Sets the fields of changes, a struct whose empty fields are omitted
+	// from BSON
+	Update(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, changes interface{}) error
+	Delete(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID) error
+	DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error
+	// Atomically adds delta to the stock and returns the product. The stock
+	// never goes below zero, ErrConflict is returned instead.
+	AdjustStock(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, delta int64) (*models.Product, error)
+}
+
+type mongoProducts struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoProducts) List(ctx context.Context, storeId primitive.ObjectID, status string, search string, page Page) ([]models.Product, int64, error) {
+	filter := searchFilter(search)
+	filter["store"] = storeId
+	filter["status"] = status
+
+	var products []models.Product
+	total, err := findPage(ctx, r.collection, filter, options.Find(), page, &products)
+	return products, total, err
+}
+
+func (r *mongoProducts) Find(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID) (*models.Product, error) {
+	var product models.Product
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "store": storeId}).Decode(&product); err != nil {
+		return nil, notFound(err)
+	}
+	return &product, nil
+}
+
+func (r *mongoProducts) FindMany(ctx context.Context, storeId primitive.ObjectID, ids []primitive.ObjectID) ([]models.Product, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "store": storeId})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *mongoProducts) SKUExists(ctx context.Context, storeId primitive.ObjectID, sku string, except primitive.ObjectID) (bool, error) {
+	filter := bson.M{"store": storeId, "sku": sku}
+	if !except.IsZero() {
+		filter["_id"] = bson.M{"$ne": except}
+	}
+	count, err := r.collection.CountDocuments(ctx, filter)
+	return count > 0, err
+}
+
+func (r *mongoProducts) Create(ctx context.Context, product *models.Product) error {
+	result, err := r.collection.InsertOne(ctx, product)
+	if err != nil {
+		return err
+	}
+	product.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoProducts) Update(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, changes interface{}) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "store": storeId}, bson.M{"$set": changes})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoProducts) Delete(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "store": storeId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoProducts) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"store": storeId})
+	return err
+}
+
+func (r *mongoProducts) AdjustStock(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, delta int64) (*models.Product, error) {
+	// Only matches if the stock stays positive so concurrent purchases can
+	// never oversell
+	filter := bson.M{"_id": id, "store": storeId}
+	if delta < 0 {
+		filter["stock"] = bson.M{"$gte": -delta}
+	}
+
+	var product models.Product
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"stock": delta}}, findOptions).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		count, _ := r.collection.CountDocuments(ctx, bson.M{"_id": id, "store": storeId})
+		if count == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryProducts struct {
+	db *memoryDB
+}
+
+func (r *memoryProducts) load() (*memoryCollection, []models.Product, error) {
+	collection := r.db.collection("products")
+	var products []models.Product
+	if err := collection.all(&products); err != nil {
+		return nil, nil, err
+	}
+	return collection, products, nil
+}
+
+// Index of the product of the store, -1 if there is none
+func productIndex(products []models.Product, storeId primitive.ObjectID, id primitive.ObjectID) int {
+	for i, product := range products {
+		if product.ID == id && product.Store == storeId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *memoryProducts) List(ctx context.Context, storeId primitive.ObjectID, status string, search string, page Page) ([]models.Product, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	match := searchMatcher(search)
+	_, products, err := r.load()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found := []models.Product{}
+	for _, product := range products {
+		if product.Store == storeId && product.Status == status && match(product.Title, product.SKU) {
+			found = append(found, product)
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryProducts) Find(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID) (*models.Product, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, products, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	i := productIndex(products, storeId, id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	return &products[i], nil
+}
+
+func (r *memoryProducts) FindMany(ctx context.Context, storeId primitive.ObjectID, ids []primitive.ObjectID) ([]models.Product, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, products, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []models.Product{}
+	for _, product := range products {
+		for _, id := range ids {
+			if product.ID == id && product.Store == storeId {
+				found = append(found, product)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryProducts) SKUExists(ctx context.Context, storeId primitive.ObjectID, sku string, except primitive.ObjectID) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, products, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for _, product := range products {
+		if product.Store == storeId && product.SKU == sku && product.ID != except {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryProducts) Create(ctx context.Context, product *models.Product) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	product.ID = newID(product.ID)
+	return r.db.collection("products").insert(product)
+}
+
+func (r *memoryProducts) Update(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, changes interface{}) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, products, err := r.load()
+	if err != nil {
+		return err
+	}
+	i := productIndex(products, storeId, id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	return collection.update(i, changes)
+}
+
+func (r *memoryProducts) Delete(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, products, err := r.load()
+	if err != nil {
+		return err
+	}
+	i := productIndex(products, storeId, id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	collection.remove(i)
+	return nil
+}
+
+func (r *memoryProducts) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, products, err := r.load()
+	if err != nil {
+		return err
+	}
+	indexes := []int{}
+	for i, product := range products {
+		if product.Store == storeId {
+			indexes = append(indexes, i)
+		}
+	}
+	collection.remove(indexes...)
+	return nil
+}
+
+func (r *memoryProducts) AdjustStock(ctx context.Context, storeId primitive.ObjectID, id primitive.ObjectID, delta int64) (*models.Product, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, products, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	i := productIndex(products, storeId, id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+
+	product := &products[i]
+	if product.Stock+delta < 0 {
+		return nil, ErrConflict
+	}
+	product.Stock += delta
+	return product, collection.update(i, bson.M{"stock": product.Stock})
+}
@@ -0,0 +1,135 @@
+// Package repository keeps the application's data. Every repository has a
+// Mongo implementation for production and an in-memory one for tests and for
+// running without a database.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// Nothing matched
+	ErrNotFound = errors.New("repository: not found")
+	// The document isn't in the state the change requires, or another one
+	// already has its unique fields
+	ErrConflict = errors.New("repository: conflict")
+)
+
+// Window of a list
+type Page struct {
+	Skip  int64
+	Limit int64
+}
+
+// Snapshotter reads the current state of documents for the audit log. Filters
+// only compare fields for equality.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, collection string, filter bson.M) (bson.M, error)
+}
+
+// Every repository of the application, handed to the controllers and
+// middlewares when the app is built
+type Repositories struct {
+	Users          UserRepository
+	Admins         AdminRepository
+	Stores         StoreRepository
+	Members        MemberRepository
+	Invites        InviteRepository
+	Roles          RoleRepository
+	Products       ProductRepository
+	Inventory      InventoryRepository
+	Reservations   ReservationRepository
+	Carts          CartRepository
+	Orders         OrderRepository
+	Payments       PaymentRepository
+	Sessions       SessionRepository
+	PasswordResets PasswordResetRepository
+	Settings       SettingsRepository
+	Audit          AuditRepository
+	Snapshots      Snapshotter
+}
+
+// Repositories backed by the Mongo database
+func NewMongo(db *mongo.Database) *Repositories {
+	return &Repositories{
+		Users:          &mongoUsers{mongoTwoFactor{db.Collection("users")}},
+		Admins:         &mongoAdmins{mongoTwoFactor{db.Collection("admins")}},
+		Stores:         &mongoStores{db.Collection("stores")},
+		Members:        &mongoMembers{db.Collection("store_members")},
+		Invites:        &mongoInvites{db.Collection("store_invites")},
+		Roles:          &mongoRoles{db.Collection("role_assignments")},
+		Products:       &mongoProducts{db.Collection("products")},
+		Inventory:      &mongoInventory{db.Collection("inventory_adjustments")},
+		Reservations:   &mongoReservations{db.Collection("reservations")},
+		Carts:          &mongoCarts{db.Collection("carts")},
+		Orders:         &mongoOrders{db.Collection("orders")},
+		Payments:       &mongoPayments{db.Collection("payments")},
+		Sessions:       &mongoSessions{refreshTokens: db.Collection("refresh_tokens"), revokedTokens: db.Collection("revoked_tokens")},
+		PasswordResets: &mongoPasswordResets{db.Collection("password_resets")},
+		Settings:       &mongoSettings{db.Collection("settings")},
+		Audit:          &mongoAudit{db.Collection("audit_log")},
+		Snapshots:      &mongoSnapshots{db},
+	}
+}
+
+type mongoSnapshots struct {
+	db *mongo.Database
+}
+
+func (s *mongoSnapshots) Snapshot(ctx context.Context, collection string, filter bson.M) (bson.M, error) {
+	var document bson.M
+	err := s.db.Collection(collection).FindOne(ctx, filter).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	return document, err
+}
+
+// Decodes the page of the documents matching the filter into out and counts
+// all of them
+func findPage(ctx context.Context, collection *mongo.Collection, filter bson.M, findOptions *options.FindOptions, page Page, out interface{}) (int64, error) {
+	total, _ := collection.CountDocuments(ctx, filter)
+
+	findOptions.SetSkip(page.Skip)
+	if page.Limit > 0 {
+		findOptions.SetLimit(page.Limit)
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	return total, cursor.All(ctx, out)
+}
+
+// Search on the text index of the collection (see the migrations), nothing
+// when search is empty
+func searchFilter(search string) bson.M {
+	if search == "" {
+		return bson.M{}
+	}
+	return bson.M{"$text": bson.M{"$search": search}}
+}
+
+// ErrNotFound in place of the driver's error
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ErrConflict in place of a unique index violation
+func duplicate(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
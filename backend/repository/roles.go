@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fields the role assignments are filtered by, the zero values match
+// everything
+type RoleAssignmentFilter struct {
+	User  primitive.ObjectID
+	Store primitive.ObjectID
+	Role  string
+}
+
+// RoleRepository keeps the roles given to users, for the whole platform or a
+// single store
+type RoleRepository interface {
+	List(ctx context.Context, filter RoleAssignmentFilter, page Page) ([]models.RoleAssignment, int64, error)
+	// Whether the user has the role, for the store or for the whole platform
+	// when storeId is nil
+	Exists(ctx context.Context, userId primitive.ObjectID, role string, storeId primitive.ObjectID) (bool, error)
+	// Assignments of the user for the whole platform and for the store
+	ForUser(ctx context.Context, userId primitive.ObjectID, storeId primitive.ObjectID) ([]models.RoleAssignment, error)
+	// Inserts the assignment and sets its ID
+	Create(ctx context.Context, assignment *models.RoleAssignment) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error
+}
+
+type mongoRoles struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoRoles) List(ctx context.Context, filter RoleAssignmentFilter, page Page) ([]models.RoleAssignment, int64, error) {
+	query := bson.M{}
+	if !filter.User.IsZero() {
+		query["user"] = filter.User
+	}
+	if !filter.Store.IsZero() {
+		query["store"] = filter.Store
+	}
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+
+	var assignments []models.RoleAssignment
+	total, err := findPage(ctx, r.collection, query, options.Find(), page, &assignments)
+	return assignments, total, err
+}
+
+func (r *mongoRoles) Exists(ctx context.Context, userId primitive.ObjectID, role string, storeId primitive.ObjectID) (bool, error) {
+	filter := bson.M{"user": userId, "role": role, "store": bson.M{"$exists": false}}
+	if !storeId.IsZero() {
+		filter["store"] = storeId
+	}
+	count, err := r.collection.CountDocuments(ctx, filter)
+	return count > 0, err
+}
+
+func (r *mongoRoles) ForUser(ctx context.Context, userId primitive.ObjectID, storeId primitive.ObjectID) ([]models.RoleAssignment, error) {
+	// Global assignments and the ones for the store
+	scopes := []bson.M{{"store": bson.M{"$exists": false}}}
+	if !storeId.IsZero() {
+		scopes = append(scopes, bson.M{"store": storeId})
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user": userId, "$or": scopes})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var assignments []models.RoleAssignment
+	if err := cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+func (r *mongoRoles) Create(ctx context.Context, assignment *models.RoleAssignment) error {
+	result, err := r.collection.InsertOne(ctx, assignment)
+	if err != nil {
+		return err
+	}
+	assignment.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoRoles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoRoles) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"store": storeId})
+	return err
+}
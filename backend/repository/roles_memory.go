@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryRoles struct {
+	db *memoryDB
+}
+
+func (r *memoryRoles) load() (*memoryCollection, []models.RoleAssignment, error) {
+	collection := r.db.collection("role_assignments")
+	var assignments []models.RoleAssignment
+	if err := collection.all(&assignments); err != nil {
+		return nil, nil, err
+	}
+	return collection, assignments, nil
+}
+
+func (r *memoryRoles) List(ctx context.Context, filter RoleAssignmentFilter, page Page) ([]models.RoleAssignment, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, assignments, err := r.load()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found := []models.RoleAssignment{}
+	for _, assignment := range assignments {
+		if !filter.User.IsZero() && assignment.User != filter.User {
+			continue
+		}
+		if !filter.Store.IsZero() && assignment.Store != filter.Store {
+			continue
+		}
+		if filter.Role != "" && assignment.Role != filter.Role {
+			continue
+		}
+		found = append(found, assignment)
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryRoles) Exists(ctx context.Context, userId primitive.ObjectID, role string, storeId primitive.ObjectID) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, assignments, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for _, assignment := range assignments {
+		if assignment.User == userId && assignment.Role == role && assignment.Store == storeId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRoles) ForUser(ctx context.Context, userId primitive.ObjectID, storeId primitive.ObjectID) ([]models.RoleAssignment, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, assignments, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Global assignments and the ones for the store
+	found := []models.RoleAssignment{}
+	for _, assignment := range assignments {
+		if assignment.User != userId {
+			continue
+		}
+		if assignment.Store.IsZero() || (!storeId.IsZero() && assignment.Store == storeId) {
+			found = append(found, assignment)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryRoles) Create(ctx context.Context, assignment *models.RoleAssignment) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	assignment.ID = newID(assignment.ID)
+	return r.db.collection("role_assignments").insert(assignment)
+}
+
+func (r *memoryRoles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, assignments, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i, assignment := range assignments {
+		if assignment.ID == id {
+			collection.remove(i)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRoles) DeleteByStore(ctx context.Context, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, assignments, err := r.load()
+	if err != nil {
+		return err
+	}
+	indexes := []int{}
+	for i, assignment := range assignments {
+		if assignment.Store == storeId {
+			indexes = append(indexes, i)
+		}
+	}
+	collection.remove(indexes...)
+	return nil
+}
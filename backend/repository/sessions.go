@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SessionRepository keeps the refresh tokens of the login sessions and the
+// access tokens revoked before they expire
+type SessionRepository interface {
+	// Inserts the refresh token and sets its ID
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// Marks the refresh token used, false if it already was
+	UseRefreshToken(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error)
+	// Revokes the refresh tokens of the family
+	RevokeFamily(ctx context.Context, family primitive.ObjectID, at time.Time) error
+	// Revokes the refresh tokens of the subject
+	RevokeSubject(ctx context.Context, subjectType string, subject primitive.ObjectID, at time.Time) error
+	RevokeAccessToken(ctx context.Context, revoked models.RevokedToken) error
+	// Whether the access token with the jti, or every token of the subject
+	// issued at issuedAt, was revoked. Empty values are not checked.
+	// Revocations of the subject cover the tokens issued strictly before them.
+	AccessTokenRevoked(ctx context.Context, jti string, subject primitive.ObjectID, issuedAt time.Time) (bool, error)
+}
+
+type mongoSessions struct {
+	refreshTokens *mongo.Collection
+	revokedTokens *mongo.Collection
+}
+
+func (r *mongoSessions) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	result, err := r.refreshTokens.InsertOne(ctx, token)
+	if err != nil {
+		return err
+	}
+	token.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoSessions) FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.refreshTokens.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token); err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+func (r *mongoSessions) UseRefreshToken(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	result, err := r.refreshTokens.UpdateOne(ctx, bson.M{"_id": id, "used_at": bson.M{"$exists": false}}, bson.M{
+		"$set": bson.M{"used_at": at},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoSessions) RevokeFamily(ctx context.Context, family primitive.ObjectID, at time.Time) error {
+	_, err := r.refreshTokens.UpdateMany(ctx, bson.M{"family": family, "revoked_at": bson.M{"$exists": false}}, bson.M{
+		"$set": bson.M{"revoked_at": at},
+	})
+	return err
+}
+
+func (r *mongoSessions) RevokeSubject(ctx context.Context, subjectType string, subject primitive.ObjectID, at time.Time) error {
+	filter := bson.M{"subject_type": subjectType, "subject": subject, "revoked_at": bson.M{"$exists": false}}
+	_, err := r.refreshTokens.UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{"revoked_at": at},
+	})
+	return err
+}
+
+func (r *mongoSessions) RevokeAccessToken(ctx context.Context, revoked models.RevokedToken) error {
+	_, err := r.revokedTokens.InsertOne(ctx, revoked)
+	return err
+}
+
+func (r *mongoSessions) AccessTokenRevoked(ctx context.Context, jti string, subject primitive.ObjectID, issuedAt time.Time) (bool, error) {
+	scopes := []bson.M{}
+	if jti != "" {
+		scopes = append(scopes, bson.M{"jti": jti})
+	}
+	if !subject.IsZero() && !issuedAt.IsZero() {
+		scopes = append(scopes, bson.M{"subject": subject, "issued_before": bson.M{"$gt": issuedAt}})
+	}
+	if len(scopes) == 0 {
+		return false, nil
+	}
+
+	count, err := r.revokedTokens.CountDocuments(ctx, bson.M{"$or": scopes})
+	return count > 0, err
+}
+
+// PasswordResetRepository keeps the pending password resets
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	// Reset that is neither used nor expired at now
+	FindUsable(ctx context.Context, id primitive.ObjectID, now time.Time) (*models.PasswordReset, error)
+	// Uses up the reset if it still is usable at now, false otherwise
+	Use(ctx context.Context, id primitive.ObjectID, now time.Time) (bool, error)
+	// Uses up every reset of the user
+	UseAll(ctx context.Context, userId primitive.ObjectID, now time.Time) error
+}
+
+type mongoPasswordResets struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPasswordResets) Create(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := r.collection.InsertOne(ctx, reset)
+	return err
+}
+
+func usableReset(id primitive.ObjectID, now time.Time) bson.M {
+	return bson.M{"_id": id, "used_at": bson.M{"$exists": false}, "expires_at": bson.M{"$gt": now}}
+}
+
+func (r *mongoPasswordResets) FindUsable(ctx context.Context, id primitive.ObjectID, now time.Time) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := r.collection.FindOne(ctx, usableReset(id, now)).Decode(&reset); err != nil {
+		return nil, notFound(err)
+	}
+	return &reset, nil
+}
+
+func (r *mongoPasswordResets) Use(ctx context.Context, id primitive.ObjectID, now time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, usableReset(id, now), bson.M{"$set": bson.M{"used_at": now}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoPasswordResets) UseAll(ctx context.Context, userId primitive.ObjectID, now time.Time) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{"user": userId, "used_at": bson.M{"$exists": false}}, bson.M{
+		"$set": bson.M{"used_at": now},
+	})
+	return err
+}
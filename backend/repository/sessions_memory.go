@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memorySessions struct {
+	db *memoryDB
+}
+
+func (r *memorySessions) load() (*memoryCollection, []models.RefreshToken, error) {
+	collection := r.db.collection("refresh_tokens")
+	var tokens []models.RefreshToken
+	if err := collection.all(&tokens); err != nil {
+		return nil, nil, err
+	}
+	return collection, tokens, nil
+}
+
+func (r *memorySessions) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	token.ID = newID(token.ID)
+	return r.db.collection("refresh_tokens").insert(token)
+}
+
+func (r *memorySessions) FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, tokens, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		if tokens[i].TokenHash == tokenHash {
+			return &tokens[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memorySessions) UseRefreshToken(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, tokens, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for i, token := range tokens {
+		if token.ID == id && token.UsedAt.IsZero() {
+			return true, collection.update(i, bson.M{"used_at": at})
+		}
+	}
+	return false, nil
+}
+
+// Revokes the refresh tokens matching that aren't yet
+func (r *memorySessions) revoke(match func(token *models.RefreshToken) bool, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, tokens, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i := range tokens {
+		if !match(&tokens[i]) || !tokens[i].RevokedAt.IsZero() {
+			continue
+		}
+		if err := collection.update(i, bson.M{"revoked_at": at}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memorySessions) RevokeFamily(ctx context.Context, family primitive.ObjectID, at time.Time) error {
+	return r.revoke(func(token *models.RefreshToken) bool { return token.Family == family }, at)
+}
+
+func (r *memorySessions) RevokeSubject(ctx context.Context, subjectType string, subject primitive.ObjectID, at time.Time) error {
+	return r.revoke(func(token *models.RefreshToken) bool {
+		return token.SubjectType == subjectType && token.Subject == subject
+	}, at)
+}
+
+func (r *memorySessions) RevokeAccessToken(ctx context.Context, revoked models.RevokedToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	revoked.ID = newID(revoked.ID)
+	return r.db.collection("revoked_tokens").insert(revoked)
+}
+
+func (r *memorySessions) AccessTokenRevoked(ctx context.Context, jti string, subject primitive.ObjectID, issuedAt time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var revokedTokens []models.RevokedToken
+	if err := r.db.collection("revoked_tokens").all(&revokedTokens); err != nil {
+		return false, err
+	}
+	for _, revoked := range revokedTokens {
+		if jti != "" && revoked.JTI == jti {
+			return true, nil
+		}
+		if !subject.IsZero() && !issuedAt.IsZero() && revoked.Subject == subject && revoked.IssuedBefore.After(issuedAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryPasswordResets struct {
+	db *memoryDB
+}
+
+func (r *memoryPasswordResets) load() (*memoryCollection, []models.PasswordReset, error) {
+	collection := r.db.collection("password_resets")
+	var resets []models.PasswordReset
+	if err := collection.all(&resets); err != nil {
+		return nil, nil, err
+	}
+	return collection, resets, nil
+}
+
+func (r *memoryPasswordResets) Create(ctx context.Context, reset *models.PasswordReset) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	reset.ID = newID(reset.ID)
+	return r.db.collection("password_resets").insert(reset)
+}
+
+func usable(reset *models.PasswordReset, now time.Time) bool {
+	return reset.UsedAt.IsZero() && reset.ExpiresAt.After(now)
+}
+
+func (r *memoryPasswordResets) FindUsable(ctx context.Context, id primitive.ObjectID, now time.Time) (*models.PasswordReset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, resets, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range resets {
+		if resets[i].ID == id && usable(&resets[i], now) {
+			return &resets[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPasswordResets) Use(ctx context.Context, id primitive.ObjectID, now time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, resets, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for i := range resets {
+		if resets[i].ID == id && usable(&resets[i], now) {
+			return true, collection.update(i, bson.M{"used_at": now})
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryPasswordResets) UseAll(ctx context.Context, userId primitive.ObjectID, now time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, resets, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i, reset := range resets {
+		if reset.User != userId || !reset.UsedAt.IsZero() {
+			continue
+		}
+		if err := collection.update(i, bson.M{"used_at": now}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
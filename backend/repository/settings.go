@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SettingsRepository keeps the platform wide settings
+type SettingsRepository interface {
+	// Saved security settings, the defaults until they are saved once
+	Security(ctx context.Context) (*models.SecuritySettings, error)
+	SaveSecurity(ctx context.Context, settings *models.SecuritySettings) error
+}
+
+type mongoSettings struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoSettings) Security(ctx context.Context) (*models.SecuritySettings, error) {
+	settings := models.SecuritySettings{ID: models.SecuritySettingsID}
+	err := r.collection.FindOne(ctx, bson.M{"_id": models.SecuritySettingsID}).Decode(&settings)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *mongoSettings) SaveSecurity(ctx context.Context, settings *models.SecuritySettings) error {
+	settings.ID = models.SecuritySettingsID
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": models.SecuritySettingsID}, settings, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Audit entries to list, zero values match every entry
+type AuditFilter struct {
+	Actor      primitive.ObjectID
+	ActorType  string
+	Action     string
+	Target     string
+	TargetType string
+	RequestID  string
+	// Entries created in [From, To)
+	From time.Time
+	To   time.Time
+	// Entries older than this one, ids grow with time
+	Before primitive.ObjectID
+}
+
+// AuditRepository keeps the append only audit log
+type AuditRepository interface {
+	Insert(ctx context.Context, entry models.AuditEntry) error
+	// At most limit entries matching the filter, newest first
+	List(ctx context.Context, filter AuditFilter, limit int) ([]models.AuditEntry, error)
+}
+
+type mongoAudit struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAudit) Insert(ctx context.Context, entry models.AuditEntry) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	return err
+}
+
+func (r *mongoAudit) List(ctx context.Context, filter AuditFilter, limit int) ([]models.AuditEntry, error) {
+	query := bson.M{}
+	if !filter.Actor.IsZero() {
+		query["actor"] = filter.Actor
+	}
+	for field, value := range map[string]string{
+		"actor_type":  filter.ActorType,
+		"action":      filter.Action,
+		"target":      filter.Target,
+		"target_type": filter.TargetType,
+		"request_id":  filter.RequestID,
+	} {
+		if value != "" {
+			query[field] = value
+		}
+	}
+
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+	if !filter.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": filter.Before}
+	}
+
+	findOptions := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+)
+
+type memorySettings struct {
+	db *memoryDB
+}
+
+func (r *memorySettings) Security(ctx context.Context) (*models.SecuritySettings, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var settings []models.SecuritySettings
+	if err := r.db.collection("settings").all(&settings); err != nil {
+		return nil, err
+	}
+	for i := range settings {
+		if settings[i].ID == models.SecuritySettingsID {
+			return &settings[i], nil
+		}
+	}
+	return &models.SecuritySettings{ID: models.SecuritySettingsID}, nil
+}
+
+func (r *memorySettings) SaveSecurity(ctx context.Context, settings *models.SecuritySettings) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	settings.ID = models.SecuritySettingsID
+	collection := r.db.collection("settings")
+	var saved []models.SecuritySettings
+	if err := collection.all(&saved); err != nil {
+		return err
+	}
+	for i := range saved {
+		if saved[i].ID == models.SecuritySettingsID {
+			return collection.set(i, settings)
+		}
+	}
+	return collection.insert(settings)
+}
+
+type memoryAudit struct {
+	db *memoryDB
+}
+
+func (r *memoryAudit) Insert(ctx context.Context, entry models.AuditEntry) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	entry.ID = newID(entry.ID)
+	return r.db.collection("audit_log").insert(entry)
+}
+
+func (filter AuditFilter) matches(entry *models.AuditEntry) bool {
+	for _, field := range [][2]string{
+		{filter.ActorType, entry.ActorType},
+		{filter.Action, entry.Action},
+		{filter.Target, entry.Target},
+		{filter.TargetType, entry.TargetType},
+		{filter.RequestID, entry.RequestID},
+	} {
+		if field[0] != "" && field[0] != field[1] {
+			return false
+		}
+	}
+	if !filter.Actor.IsZero() && entry.Actor != filter.Actor {
+		return false
+	}
+	if !filter.From.IsZero() && entry.CreatedAt.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !entry.CreatedAt.Before(filter.To) {
+		return false
+	}
+	return filter.Before.IsZero() || entry.ID.Hex() < filter.Before.Hex()
+}
+
+func (r *memoryAudit) List(ctx context.Context, filter AuditFilter, limit int) ([]models.AuditEntry, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var entries []models.AuditEntry
+	if err := r.db.collection("audit_log").all(&entries); err != nil {
+		return nil, err
+	}
+
+	// Newest first, ids grow with time
+	found := []models.AuditEntry{}
+	for i := len(entries) - 1; i >= 0 && len(found) < limit; i-- {
+		if filter.matches(&entries[i]) {
+			found = append(found, entries[i])
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StoreRepository keeps the stores
+type StoreRepository interface {
+	// Stores whose name matches the search, all of them when it is empty
+	List(ctx context.Context, search string, page Page) ([]models.Store, int64, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Store, error)
+	// Inserts the store and sets its ID
+	Create(ctx context.Context, store *models.Store) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Whether the user is the store's owner
+	IsOwner(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) (bool, error)
+}
+
+type mongoStores struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoStores) List(ctx context.Context, search string, page Page) ([]models.Store, int64, error) {
+	var stores []models.Store
+	total, err := findPage(ctx, r.collection, searchFilter(search), options.Find(), page, &stores)
+	return stores, total, err
+}
+
+func (r *mongoStores) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Store, error) {
+	var store models.Store
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&store); err != nil {
+		return nil, notFound(err)
+	}
+	return &store, nil
+}
+
+func (r *mongoStores) Create(ctx context.Context, store *models.Store) error {
+	result, err := r.collection.InsertOne(ctx, store)
+	if err != nil {
+		return err
+	}
+	store.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoStores) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoStores) IsOwner(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, "owner": userId})
+	return count > 0, err
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryStores struct {
+	db *memoryDB
+}
+
+func (r *memoryStores) load() (*memoryCollection, []models.Store, error) {
+	collection := r.db.collection("stores")
+	var stores []models.Store
+	if err := collection.all(&stores); err != nil {
+		return nil, nil, err
+	}
+	return collection, stores, nil
+}
+
+func (r *memoryStores) List(ctx context.Context, search string, page Page) ([]models.Store, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	match := searchMatcher(search)
+	_, stores, err := r.load()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found := []models.Store{}
+	for _, store := range stores {
+		if match(store.Name) {
+			found = append(found, store)
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryStores) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Store, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, stores, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range stores {
+		if stores[i].ID == id {
+			return &stores[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryStores) Create(ctx context.Context, store *models.Store) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	store.ID = newID(store.ID)
+	return r.db.collection("stores").insert(store)
+}
+
+func (r *memoryStores) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	collection, stores, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i := range stores {
+		if stores[i].ID == id {
+			collection.remove(i)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memoryStores) IsOwner(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	_, stores, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	for _, store := range stores {
+		if store.ID == id && store.Owner == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserRepository keeps the customer accounts
+type UserRepository interface {
+	TwoFactorRepository
+
+	// Users whose username matches the search, all of them when it is empty
+	List(ctx context.Context, search string, page Page) ([]models.User, int64, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByUsername(ctx context.Context, username string) (*models.User, error)
+	// User with the login as username or email
+	FindByLogin(ctx context.Context, login string) (*models.User, error)
+	// Inserts the user and sets its ID, ErrConflict if the username or
+	// email is taken
+	Create(ctx context.Context, user *models.User) error
+	// Sets the non empty fields of changes, an email other than the current
+	// one is no longer verified. Does nothing if there is no such user,
+	// ErrConflict if the username or email is taken.
+	Update(ctx context.Context, id primitive.ObjectID, changes *models.User) error
+	// Marks the email verified if it is still the user's
+	VerifyEmail(ctx context.Context, id primitive.ObjectID, email string, at time.Time) error
+	SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Adds the store to the user's stores
+	AddStore(ctx context.Context, id primitive.ObjectID, storeId primitive.ObjectID) error
+	// Takes the store out of the stores of every user
+	RemoveStore(ctx context.Context, storeId primitive.ObjectID) error
+}
+
+// TwoFactorRepository changes the second factor of users and admins
+type TwoFactorRepository interface {
+	// Sets the secret being enrolled, unless the second factor is already on
+	SetTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error
+	// Turns the enrolled secret on with its recovery codes, ErrConflict if
+	// the secret changed meanwhile
+	EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, recoveryCodes []string) error
+	// Records the time step of a used code, false if it isn't newer than the
+	// last one so every code works once
+	UseTOTPCounter(ctx context.Context, id primitive.ObjectID, counter int64) (bool, error)
+	// Uses up the hashed recovery code, false if the account doesn't have it
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, code string) (bool, error)
+	SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, codes []string) error
+	DisableTOTP(ctx context.Context, id primitive.ObjectID) error
+}
+
+type mongoUsers struct {
+	mongoTwoFactor
+}
+
+func (r *mongoUsers) List(ctx context.Context, search string, page Page) ([]models.User, int64, error) {
+	var users []models.User
+	total, err := findPage(ctx, r.collection, searchFilter(search), options.Find(), page, &users)
+	return users, total, err
+}
+
+func (r *mongoUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoUsers) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"username": username})
+}
+
+func (r *mongoUsers) FindByLogin(ctx context.Context, login string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"$or": []bson.M{{"username": login}, {"email": login}}})
+}
+
+func (r *mongoUsers) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUsers) Create(ctx context.Context, user *models.User) error {
+	result, err := r.collection.InsertOne(ctx, user)
+	if err != nil {
+		return duplicate(err)
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoUsers) Update(ctx context.Context, id primitive.ObjectID, changes *models.User) error {
+	update := bson.M{"$set": changes}
+
+	// A new address has to be verified again
+	if changes.Email != "" {
+		count, _ := r.collection.CountDocuments(ctx, bson.M{"_id": id, "email": changes.Email})
+		if count == 0 {
+			update["$unset"] = bson.M{"email_verified": "", "email_verified_at": ""}
+		}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return duplicate(err)
+}
+
+func (r *mongoUsers) VerifyEmail(ctx context.Context, id primitive.ObjectID, email string, at time.Time) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "email": email}, bson.M{
+		"$set": bson.M{"email_verified": true, "email_verified_at": at},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUsers) SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"password": hash}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoUsers) AddStore(ctx context.Context, id primitive.ObjectID, storeId primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$push": bson.M{"stores": storeId},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoUsers) RemoveStore(ctx context.Context, storeId primitive.ObjectID) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{"stores": storeId}, bson.M{
+		"$pull": bson.M{"stores": storeId},
+	})
+	return err
+}
+
+// Second factor fields, shared by the users and admins collections
+type mongoTwoFactor struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoTwoFactor) SetTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "totp_enabled": bson.M{"$ne": true}}, bson.M{
+		"$set": bson.M{"totp_secret": secret},
+	})
+	return err
+}
+
+func (r *mongoTwoFactor) EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, recoveryCodes []string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "totp_secret": secret}, bson.M{
+		"$set": bson.M{"totp_enabled": true, "recovery_codes": recoveryCodes},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoTwoFactor) UseTOTPCounter(ctx context.Context, id primitive.ObjectID, counter int64) (bool, error) {
+	filter := bson.M{"_id": id, "totp_last_counter": bson.M{"$not": bson.M{"$gte": counter}}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_counter": counter}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoTwoFactor) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, code string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "recovery_codes": code}, bson.M{
+		"$pull": bson.M{"recovery_codes": code},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoTwoFactor) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, codes []string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"recovery_codes": codes},
+	})
+	return err
+}
+
+func (r *mongoTwoFactor) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$unset": bson.M{"totp_secret": "", "totp_enabled": "", "totp_last_counter": "", "recovery_codes": ""},
+	})
+	return err
+}
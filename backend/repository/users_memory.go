@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryUsers struct {
+	memoryTwoFactor
+}
+
+func (r *memoryUsers) List(ctx context.Context, search string, page Page) ([]models.User, int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	match := searchMatcher(search)
+	var users []models.User
+	if err := r.db.collection(r.name).all(&users); err != nil {
+		return nil, 0, err
+	}
+
+	found := []models.User{}
+	for _, user := range users {
+		if match(user.Username) {
+			found = append(found, user)
+		}
+	}
+	start, end := page.bounds(len(found))
+	return found[start:end], int64(len(found)), nil
+}
+
+func (r *memoryUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(func(user *models.User) bool { return user.ID == id })
+}
+
+func (r *memoryUsers) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(func(user *models.User) bool { return user.Username == username })
+}
+
+func (r *memoryUsers) FindByLogin(ctx context.Context, login string) (*models.User, error) {
+	return r.findOne(func(user *models.User) bool { return user.Username == login || user.Email == login })
+}
+
+func (r *memoryUsers) findOne(match func(user *models.User) bool) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var users []models.User
+	if err := r.db.collection(r.name).all(&users); err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if match(&users[i]) {
+			return &users[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Index of the user with the id, -1 if there is none. The lock must be held.
+func (r *memoryUsers) index(id primitive.ObjectID) (int, *models.User, error) {
+	var users []models.User
+	if err := r.db.collection(r.name).all(&users); err != nil {
+		return -1, nil, err
+	}
+	for i := range users {
+		if users[i].ID == id {
+			return i, &users[i], nil
+		}
+	}
+	return -1, nil, nil
+}
+
+// Whether another user than id has the username or email, like the unique
+// indexes. The lock must be held.
+func (r *memoryUsers) taken(id primitive.ObjectID, username string, email string) (bool, error) {
+	var users []models.User
+	if err := r.db.collection(r.name).all(&users); err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		if user.ID != id && (username != "" && user.Username == username || email != "" && user.Email == email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	taken, err := r.taken(user.ID, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrConflict
+	}
+	user.ID = newID(user.ID)
+	return r.db.collection(r.name).insert(user)
+}
+
+func (r *memoryUsers) Update(ctx context.Context, id primitive.ObjectID, changes *models.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, user, err := r.index(id)
+	if err != nil || i < 0 {
+		return err
+	}
+	taken, err := r.taken(id, changes.Username, changes.Email)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrConflict
+	}
+
+	// A new address has to be verified again
+	unset := []string{}
+	if changes.Email != "" && changes.Email != user.Email {
+		unset = append(unset, "email_verified", "email_verified_at")
+	}
+	return r.db.collection(r.name).update(i, changes, unset...)
+}
+
+func (r *memoryUsers) VerifyEmail(ctx context.Context, id primitive.ObjectID, email string, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, user, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	if i < 0 || user.Email != email {
+		return ErrNotFound
+	}
+	return r.db.collection(r.name).update(i, bson.M{"email_verified": true, "email_verified_at": at})
+}
+
+func (r *memoryUsers) SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, _, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return ErrNotFound
+	}
+	return r.db.collection(r.name).update(i, bson.M{"password": hash})
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, _, err := r.index(id)
+	if err != nil || i < 0 {
+		return err
+	}
+	r.db.collection(r.name).remove(i)
+	return nil
+}
+
+func (r *memoryUsers) AddStore(ctx context.Context, id primitive.ObjectID, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i, user, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return r.db.collection(r.name).insert(models.User{ID: id, Stores: []primitive.ObjectID{storeId}})
+	}
+	return r.db.collection(r.name).update(i, bson.M{"stores": append(user.Stores, storeId)})
+}
+
+func (r *memoryUsers) RemoveStore(ctx context.Context, storeId primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var users []models.User
+	collection := r.db.collection(r.name)
+	if err := collection.all(&users); err != nil {
+		return err
+	}
+	for i, user := range users {
+		stores := []primitive.ObjectID{}
+		for _, id := range user.Stores {
+			if id != storeId {
+				stores = append(stores, id)
+			}
+		}
+		if len(stores) == len(user.Stores) {
+			continue
+		}
+		if err := collection.update(i, bson.M{"stores": stores}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Second factor fields, shared by the users and admins collections
+type memoryTwoFactor struct {
+	db   *memoryDB
+	name string
+}
+
+// Changes the second factor of the account with the id with apply, false
+// when there is no such account or apply leaves it as is
+func (r *memoryTwoFactor) change(id primitive.ObjectID, apply func(factor *models.TwoFactor) bool) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	// Both kinds of accounts inline the same second factor fields
+	var accounts []struct {
+		ID               primitive.ObjectID `bson:"_id"`
+		models.TwoFactor `bson:",inline"`
+	}
+	collection := r.db.collection(r.name)
+	if err := collection.all(&accounts); err != nil {
+		return false, err
+	}
+	for i := range accounts {
+		if accounts[i].ID != id {
+			continue
+		}
+		if !apply(&accounts[i].TwoFactor) {
+			return false, nil
+		}
+		// The empty fields are omitted, like $unset
+		if err := collection.update(i, nil, "totp_secret", "totp_enabled", "totp_last_counter", "recovery_codes"); err != nil {
+			return false, err
+		}
+		return true, collection.update(i, accounts[i].TwoFactor)
+	}
+	return false, nil
+}
+
+func (r *memoryTwoFactor) SetTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	_, err := r.change(id, func(factor *models.TwoFactor) bool {
+		if factor.TOTPEnabled {
+			return false
+		}
+		factor.TOTPSecret = secret
+		return true
+	})
+	return err
+}
+
+func (r *memoryTwoFactor) EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, recoveryCodes []string) error {
+	changed, err := r.change(id, func(factor *models.TwoFactor) bool {
+		if factor.TOTPSecret != secret {
+			return false
+		}
+		factor.TOTPEnabled = true
+		factor.RecoveryCodes = recoveryCodes
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *memoryTwoFactor) UseTOTPCounter(ctx context.Context, id primitive.ObjectID, counter int64) (bool, error) {
+	return r.change(id, func(factor *models.TwoFactor) bool {
+		if factor.TOTPLastCounter >= counter {
+			return false
+		}
+		factor.TOTPLastCounter = counter
+		return true
+	})
+}
+
+func (r *memoryTwoFactor) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, code string) (bool, error) {
+	return r.change(id, func(factor *models.TwoFactor) bool {
+		left := []string{}
+		for _, recoveryCode := range factor.RecoveryCodes {
+			if recoveryCode != code {
+				left = append(left, recoveryCode)
+			}
+		}
+		if len(left) == len(factor.RecoveryCodes) {
+			return false
+		}
+		factor.RecoveryCodes = left
+		return true
+	})
+}
+
+func (r *memoryTwoFactor) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, codes []string) error {
+	_, err := r.change(id, func(factor *models.TwoFactor) bool {
+		factor.RecoveryCodes = codes
+		return true
+	})
+	return err
+}
+
+func (r *memoryTwoFactor) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.change(id, func(factor *models.TwoFactor) bool {
+		*factor = models.TwoFactor{}
+		return true
+	})
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRoleAssignments(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+	storeId := s.createStore(bob, "Bob's shop")
+
+	s.call("GET", "/api/roles", alice.Token, nil).expectForbidden("role:manage")
+	s.call("GET", "/api/roles", bob.Token, nil).expectForbidden("role:manage")
+	res := s.call("GET", "/api/roles", admin.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.get("data.store_owner") == nil {
+		t.Fatalf("unexpected roles %v", res.body)
+	}
+
+	// Store roles are scoped to a store
+	assign := func(body fiber.Map) *response {
+		return s.call("POST", "/api/roles/assignments", admin.Token, body)
+	}
+	s.call("POST", "/api/roles/assignments", bob.Token, fiber.Map{"user": alice.ID, "role": "admin"}).expectForbidden("role:manage")
+	assign(fiber.Map{"user": alice.ID, "role": "customer"}).expectFailure(fiber.StatusBadRequest, "Unknown role")
+	assign(fiber.Map{"user": alice.ID, "role": "store_manager"}).
+		expectFailure(fiber.StatusBadRequest, "Store roles need a store, other roles must not have one")
+	assign(fiber.Map{"user": primitive.NewObjectID().Hex(), "role": "admin"}).expectFailure(fiber.StatusNotFound, "User not found")
+	assign(fiber.Map{"user": alice.ID, "role": "store_manager", "store": primitive.NewObjectID().Hex()}).
+		expectFailure(fiber.StatusNotFound, "Store not found")
+
+	s.call("GET", "/api/stores/"+storeId+"/orders", alice.Token, nil).expectForbidden("order:list")
+	assignmentId := assign(fiber.Map{"user": alice.ID, "role": "store_manager", "store": storeId}).
+		expectSuccess(fiber.StatusCreated).
+		str("data.InsertedID")
+	assign(fiber.Map{"user": alice.ID, "role": "store_manager", "store": storeId}).
+		expectFailure(fiber.StatusConflict, "Role already assigned")
+	s.call("GET", "/api/stores/"+storeId+"/orders", alice.Token, nil).expect(fiber.StatusOK)
+
+	res = s.call("GET", "/api/roles/assignments?user="+alice.ID, admin.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 1 {
+		t.Fatalf("unexpected assignments %v", res.body)
+	}
+
+	s.call("DELETE", "/api/roles/assignments/"+assignmentId, admin.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("DELETE", "/api/roles/assignments/"+assignmentId, admin.Token, nil).
+		expectFailure(fiber.StatusNotFound, "Role assignment not found")
+	s.call("GET", "/api/stores/"+storeId+"/orders", alice.Token, nil).expectForbidden("order:list")
+
+	// Platform roles apply everywhere
+	assign(fiber.Map{"user": alice.ID, "role": "admin"}).expectSuccess(fiber.StatusCreated)
+	s.call("GET", "/api/users", alice.Token, nil).expect(fiber.StatusOK)
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func AuditRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	route.Use(m.Protected(), m.RequirePermission("audit:read"))
+
+	// Query the audit log
+	route.Get("/", h.GetAuditLog)
+}
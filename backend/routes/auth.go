@@ -3,10 +3,25 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
 )
 
-func AuthRoutes(route fiber.Router) {
-	route.Post("/login", controllers.Login)
-	route.Post("/register", controllers.Register)
-	route.Post("/login-admin", controllers.LoginAdmin)
+func AuthRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	route.Post("/login", h.Login)
+	route.Post("/register", h.Register)
+	route.Post("/login-admin", h.LoginAdmin)
+	route.Post("/refresh", h.RefreshSession)
+	route.Post("/logout", m.Protected(), h.Logout)
+	route.Post("/verify-email", h.VerifyEmail)
+	route.Post("/verify-email/resend", m.Protected(), h.ResendVerificationEmail)
+	route.Post("/forgot-password", h.ForgotPassword)
+	route.Post("/reset-password", h.ResetPassword)
+
+	// Two-factor authentication, enrollment also takes the enrollment token
+	// of admins who must enroll before logging in
+	route.Post("/2fa/enroll", m.OptionalAuth(), h.EnrollTwoFactor)
+	route.Post("/2fa/confirm", m.OptionalAuth(), h.ConfirmTwoFactor)
+	route.Post("/2fa/verify", h.VerifyTwoFactor)
+	route.Post("/2fa/disable", m.Protected(), h.DisableTwoFactor)
+	route.Post("/2fa/recovery-codes", m.Protected(), h.RegenerateRecoveryCodes)
 }
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+// Carts are identified by the user's token or by the X-Cart-Token header
+func CartsRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	route.Use(m.OptionalAuth())
+
+	// Get the shopper's cart
+	route.Get("/", h.GetCart)
+	// Empty the cart
+	route.Delete("/", h.ClearCart)
+	// Add a product to the cart
+	route.Post("/items", h.AddToCart)
+	// Change the quantity of a product
+	route.Patch("/items/:productId", h.UpdateCartItem)
+	// Remove a product from the cart
+	route.Delete("/items/:productId", h.RemoveCartItem)
+}
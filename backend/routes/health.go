@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+// Probes for the orchestrator, without authentication
+func HealthRoutes(route fiber.Router) {
+	// The process is alive
+	route.Get("/healthz", controllers.Healthz)
+	// The process can serve traffic
+	route.Get("/readyz", controllers.Readyz)
+}
+
+func StatusRoutes(route fiber.Router, m *middlewares.Auth) {
+	route.Use(m.Protected(), m.RequirePermission("status:read"))
+
+	// Detailed status of the process and its dependencies
+	route.Get("/", controllers.GetStatus)
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func LockoutsRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	route.Use(m.Protected(), m.RequirePermission("lockout:manage"))
+
+	// Get the lockout of an account, accountType is user or admin
+	route.Get("/accounts/:accountType/:username", h.GetLockout)
+	// Unlock an account
+	route.Delete("/accounts/:accountType/:username", h.Unlock)
+	// Get the lockout of an IP
+	route.Get("/ips/:ip", h.GetLockout)
+	// Unlock an IP
+	route.Delete("/ips/:ip", h.Unlock)
+}
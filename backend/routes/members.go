@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func StoreMembersRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Get the staff of the store
+	route.Get("/", m.Protected(), m.RequirePermission("member:list"), h.GetStoreMembers)
+	// Change the role of a member
+	route.Patch("/:userId", m.Protected(), m.RequirePermission("member:update"), h.UpdateStoreMember)
+	// Remove a member from the store
+	route.Delete("/:userId", m.Protected(), m.RequirePermission("member:remove"), h.RemoveStoreMember)
+}
+
+func StoreInvitesRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Invite someone to the store by email
+	route.Post("/", m.Protected(), m.RequirePermission("member:invite"), h.CreateStoreInvite)
+	// Get the pending invites
+	route.Get("/", m.Protected(), m.RequirePermission("member:list"), h.GetStoreInvites)
+	// Revoke a pending invite
+	route.Delete("/:inviteId", m.Protected(), m.RequirePermission("member:invite"), h.RevokeStoreInvite)
+}
+
+func InvitesRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Accept an invite as the invited user
+	route.Post("/accept", m.Protected(), h.AcceptInvite)
+	// Decline an invite
+	route.Post("/decline", h.DeclineInvite)
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func OrdersRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Get the orders of the user's stores, or of all stores as admin
+	route.Get("/", m.Protected(), h.GetAllOrders)
+	// Get the orders placed by the user
+	route.Get("/mine", m.Protected(), h.GetMyOrders)
+}
+
+func StoreOrdersRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Checkout the user's cart
+	route.Post("/", m.Protected(), m.RequirePermission("order:create"), h.Checkout)
+	// Get the orders of the store
+	route.Get("/", m.Protected(), m.RequirePermission("order:list"), h.GetStoreOrders)
+	// Get single order
+	route.Get("/:orderId", m.Protected(), h.GetSingleOrder)
+	// Change the status of an order
+	route.Patch("/:orderId/status", m.Protected(), h.UpdateOrderStatus)
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func PaymentsRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Pay an order
+	route.Post("/", m.Protected(), m.RequirePermission("payment:create"), h.CreatePayment)
+	// Get single payment
+	route.Get("/:paymentId", m.Protected(), h.GetSinglePayment)
+	// Refund a payment as the store owner
+	route.Post("/:paymentId/refund", m.Protected(), h.RefundPayment)
+	// Provider notifications, authenticated by their signature
+	route.Post("/webhooks/:provider", h.PaymentWebhook)
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func ProductsRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	// Get all products of a store
+	route.Get("/", h.GetAllProducts)
+	// Get single product
+	route.Get("/:productId", h.GetSingleProduct)
+	// Create a product as the store owner
+	route.Post("/", m.Protected(), m.RequirePermission("product:create"), h.CreateProduct)
+	// Update a product as the store owner
+	route.Patch("/:productId", m.Protected(), m.RequirePermission("product:update"), h.UpdateProduct)
+	// Delete a product as the store owner
+	route.Delete("/:productId", m.Protected(), m.RequirePermission("product:delete"), h.DeleteProduct)
+	// Get the stock changes of a product
+	route.Get("/:productId/inventory", m.Protected(), m.RequirePermission("inventory:read"), h.GetInventoryAdjustments)
+	// Add or remove stock of a product
+	route.Post("/:productId/inventory", m.Protected(), m.RequirePermission("inventory:adjust"), h.AdjustInventory)
+}
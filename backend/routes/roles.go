@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func RolesRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	route.Use(m.Protected(), m.RequirePermission("role:manage"))
+
+	// Get the roles and their permissions
+	route.Get("/", h.GetRoles)
+	// Get the role assignments
+	route.Get("/assignments", h.GetRoleAssignments)
+	// Assign a role to a user
+	route.Post("/assignments", h.CreateRoleAssignment)
+	// Remove a role from a user
+	route.Delete("/assignments/:assignmentId", h.DeleteRoleAssignment)
+}
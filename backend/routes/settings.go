@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/controllers"
+	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
+)
+
+func SettingsRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
+	route.Use(m.Protected(), m.RequirePermission("settings:manage"))
+
+	// Get the security policy
+	route.Get("/security", h.GetSecuritySettings)
+	// Change the security policy
+	route.Put("/security", h.UpdateSecuritySettings)
+}
@@ -6,13 +6,23 @@ import (
 	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
 )
 
-func StoresRoutes(route fiber.Router) {
+func StoresRoutes(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
 	// Create a store
-	route.Post("/", middlewares.Protected(), controllers.CreateStore)
+	route.Post("/", m.Protected(), m.RequirePermission("store:create"), h.CreateStore)
 	// Get all stores
-	route.Get("/", middlewares.Protected(), controllers.GetAllStores)
+	route.Get("/", m.Protected(), m.RequirePermission("store:list"), h.GetAllStores)
 	// Get single store
-	route.Get("/:storeId", controllers.GetSingleStore)
+	route.Get("/:storeId", h.GetSingleStore)
 	// Delete single store
-	route.Delete("/:storeId", middlewares.Protected(), controllers.DeleteStore)
+	route.Delete("/:storeId", m.Protected(), m.RequirePermission("store:delete"), h.DeleteStore)
+
+	// Store products
+	ProductsRoutes(route.Group("/:storeId/products"), h, m)
+	// Shopper carts
+	CartsRoutes(route.Group("/:storeId/cart"), h, m)
+	// Store orders
+	StoreOrdersRoutes(route.Group("/:storeId/orders"), h, m)
+	// Store staff
+	StoreMembersRoutes(route.Group("/:storeId/members"), h, m)
+	StoreInvitesRoutes(route.Group("/:storeId/invites"), h, m)
 }
@@ -6,15 +6,15 @@ import (
 	middlewares "github.com/yrkan/pfa_sass_ecommerce/backend/middleware"
 )
 
-func UsersRoute(route fiber.Router) {
+func UsersRoute(route fiber.Router, h *controllers.Handler, m *middlewares.Auth) {
 	// Get all users
-	route.Get("/", middlewares.Protected(), controllers.GetAllUsers)
+	route.Get("/", m.Protected(), m.RequirePermission("user:list"), h.GetAllUsers)
 	// Get a single user
-	route.Get("/:userId", middlewares.Protected(), controllers.GetSingleUser)
+	route.Get("/:userId", m.Protected(), m.RequireSelfOrPermission("userId", "user:read"), h.GetSingleUser)
 	// Create a user as admin
-	route.Post("/", middlewares.Protected(), controllers.CreateUser)
+	route.Post("/", m.Protected(), m.RequirePermission("user:create"), h.CreateUser)
 	// Update a user as admin
-	route.Patch("/:userId", middlewares.Protected(), controllers.UpdateUser)
+	route.Patch("/:userId", m.Protected(), m.RequireSelfOrPermission("userId", "user:update"), h.UpdateUser)
 	// Delete user
-	route.Delete(":/userId", middlewares.Protected(), controllers.DeleteUser)
+	route.Delete("/:userId", m.Protected(), m.RequireSelfOrPermission("userId", "user:delete"), h.DeleteUser)
 }
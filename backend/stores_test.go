@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/models"
+	"github.com/yrkan/pfa_sass_ecommerce/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Users whose stores list can't be updated
+type failingUsers struct {
+	repository.UserRepository
+}
+
+func (r *failingUsers) AddStore(ctx context.Context, userId primitive.ObjectID, storeId primitive.ObjectID) error {
+	return errors.New("users unavailable")
+}
+
+func TestCreateStore(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	unverified := s.registerUser("alice")
+	bob := s.verifiedUser("bob")
+
+	s.call("POST", "/api/stores", "", fiber.Map{"name": "Shop"}).expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("POST", "/api/stores", unverified.Token, fiber.Map{"name": "Shop"}).
+		expectFailure(fiber.StatusForbidden, "Verify your email before creating a store")
+	s.call("POST", "/api/stores", bob.Token, fiber.Map{}).expectFailure(fiber.StatusBadRequest, "")
+
+	storeId := s.createStore(bob, "Bob's shop")
+
+	// Anyone can see the store, not its owner
+	res := s.call("GET", "/api/stores/"+storeId, "", nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.name") != "Bob's shop" || res.get("data.owner") == bob.ID {
+		t.Fatalf("unexpected store %v", res.body)
+	}
+
+	// The owner's account lists it
+	res = s.call("GET", "/api/users/"+bob.ID, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	if stores := res.list("data.stores"); len(stores) != 1 || stores[0] != storeId {
+		t.Fatalf("unexpected stores %v", res.body)
+	}
+}
+
+func TestCreateStoreFailure(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	admin := s.createAdmin("root")
+
+	users := s.repos.Users
+	s.repos.Users = &failingUsers{UserRepository: users}
+	s.call("POST", "/api/stores", bob.Token, fiber.Map{"name": "Shop"}).
+		expectFailure(fiber.StatusInternalServerError, "Failed to update user")
+	s.repos.Users = users
+
+	// Nothing is left of the store
+	if res := s.call("GET", "/api/stores", admin.Token, nil).expect(fiber.StatusOK); res.num("total") != 0 {
+		t.Fatalf("store left behind %v", res.body)
+	}
+	res := s.call("GET", "/api/users/"+bob.ID, bob.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.get("data.stores") != nil {
+		t.Fatalf("unexpected stores %v", res.body)
+	}
+}
+
+func TestGetStores(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	admin := s.createAdmin("root")
+	s.createStore(bob, "First")
+	s.createStore(bob, "Second")
+
+	s.call("GET", "/api/stores", bob.Token, nil).expectForbidden("store:list")
+
+	res := s.call("GET", "/api/stores", admin.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 2 {
+		t.Fatalf("unexpected stores %v", res.body)
+	}
+
+	s.call("GET", "/api/stores/"+primitive.NewObjectID().Hex(), "", nil).expectFailure(fiber.StatusNotFound, "Store not found")
+	s.call("GET", "/api/stores/not-an-id", "", nil).expectFailure(fiber.StatusBadRequest, "Bad request")
+}
+
+func TestDeleteStore(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	bob := s.verifiedUser("bob")
+	eve := s.verifiedUser("eve")
+	storeId := s.createStore(bob, "Bob's shop")
+	s.createStore(eve, "Eve's shop")
+	productId := s.createProduct(bob, storeId, "SKU-1", 1000, 5)
+	alice := s.verifiedUser("alice")
+	orderId := s.placeOrder(alice, storeId, productId, 1)
+	s.call("POST", "/api/stores/"+storeId+"/cart/items", alice.Token, fiber.Map{"product": productId, "quantity": 1}).
+		expectSuccess(fiber.StatusOK)
+
+	// Owning a store gives no rights on the others
+	s.call("DELETE", "/api/stores/"+storeId, eve.Token, nil).expectForbidden("store:delete")
+
+	s.call("DELETE", "/api/stores/"+storeId, bob.Token, nil).expectSuccess(fiber.StatusCreated)
+	s.call("GET", "/api/stores/"+storeId, "", nil).expectFailure(fiber.StatusNotFound, "Store not found")
+	s.call("GET", "/api/stores/"+storeId+"/products/"+productId, "", nil).expectFailure(fiber.StatusNotFound, "")
+
+	// The unpaid order is cancelled and the cart is gone
+	ctx := context.Background()
+	store, _ := primitive.ObjectIDFromHex(storeId)
+	id, _ := primitive.ObjectIDFromHex(orderId)
+	order, err := s.repos.Orders.FindByID(ctx, id)
+	if err != nil || order.Status != models.OrderStatusCancelled {
+		t.Fatalf("unexpected order %+v: %v", order, err)
+	}
+	reservations, err := s.repos.Reservations.ListByOrder(ctx, id, models.ReservationStatusHeld)
+	if err != nil || len(reservations) != 0 {
+		t.Fatalf("reservations still held %+v: %v", reservations, err)
+	}
+	user, _ := primitive.ObjectIDFromHex(alice.ID)
+	if _, err := s.repos.Carts.Find(ctx, repository.CartOwner{Store: store, User: user}); err != repository.ErrNotFound {
+		t.Fatalf("cart left behind: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Command monitor making a client span of every MongoDB command, child of the
+// span in the context of the operation
+func MongoMonitor() *event.CommandMonitor {
+	// Spans of the commands in flight by request id
+	var spans sync.Map
+
+	finished := func(requestID int64, err string) {
+		value, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		if err != "" {
+			span.SetStatus(codes.Error, err)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			// Commands outside of a trace, like the driver's heartbeats, are left out
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+
+			// The first element of a command names its collection
+			collection := ""
+			if elements, err := e.Command.Elements(); err == nil && len(elements) > 0 {
+				collection, _ = elements[0].Value().StringValueOK()
+			}
+
+			name := e.CommandName
+			if collection != "" {
+				name = collection + "." + e.CommandName
+			}
+			_, span := Tracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemMongoDB,
+					semconv.DBNameKey.String(e.DatabaseName),
+					semconv.DBOperationKey.String(e.CommandName),
+					semconv.DBMongoDBCollectionKey.String(collection),
+				),
+			)
+			spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finished(e.RequestID, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finished(e.RequestID, e.Failure)
+		},
+	}
+}
@@ -0,0 +1,110 @@
+// Package tracing sets up OpenTelemetry tracing: W3C trace context
+// propagation, the span exporter and the spans of the MongoDB commands.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+
+	instrumentationName = "github.com/yrkan/pfa_sass_ecommerce/backend"
+)
+
+// Provider set by Init, nil while tracing is off
+var provider *sdktrace.TracerProvider
+
+// Tracer of the application's spans. It does nothing until Init sets up an
+// exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Settings of the tracing, loaded by the config package
+type Config struct {
+	// "none", "stdout", "file" writing to File, or "otlp" sending to the
+	// OTEL_EXPORTER_OTLP_* endpoint over HTTP
+	Exporter string `yaml:"exporter"`
+	File     string `yaml:"file"`
+	// Share of the new traces sampled, the callers' sampling decision is kept
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Sets up tracing and the exporter of the config
+func Init(ctx context.Context, config Config) error {
+	// Trace context is propagated even when this service doesn't export
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx, config)
+	if err != nil || exporter == nil {
+		return err
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return fmt.Errorf("tracing: the sample ratio must be between 0 and 1")
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String("pfa-sass-ecommerce-backend")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) {
+	switch exporter := config.Exporter; exporter {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return newWriterExporter(os.Stdout)
+	case ExporterFile:
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		return newWriterExporter(file)
+	case ExporterOTLP:
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", exporter)
+	}
+}
+
+// One JSON span per line, to test offline
+func newWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// Exports the spans still buffered and stops tracing
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
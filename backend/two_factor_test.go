@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Enrolls the logged in account and returns the secret and recovery codes
+func (s *testServer) enrollTwoFactor(a *account) (string, []interface{}) {
+	s.t.Helper()
+
+	secret := s.call("POST", "/api/auth/2fa/enroll", a.Token, nil).
+		expectSuccess(fiber.StatusOK).
+		str("data.secret")
+	codes := s.call("POST", "/api/auth/2fa/confirm", a.Token, fiber.Map{"code": s.totpCode(secret)}).
+		expectSuccess(fiber.StatusOK).
+		list("data.recovery_codes")
+	return secret, codes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	s.call("POST", "/api/auth/2fa/enroll", "", nil).expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+	s.call("POST", "/api/auth/2fa/confirm", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusConflict, "No two-factor enrollment in progress")
+
+	secret, recoveryCodes := s.enrollTwoFactor(alice)
+	if len(recoveryCodes) == 0 {
+		t.Fatal("no recovery codes")
+	}
+	s.call("POST", "/api/auth/2fa/enroll", alice.Token, nil).
+		expectFailure(fiber.StatusConflict, "Two-factor authentication is already enabled")
+
+	// The password alone only gets a challenge
+	login := fiber.Map{"username": "alice", "password": testPassword}
+	res := s.call("POST", "/api/auth/login", "", login).expectSuccess(fiber.StatusOK)
+	if res.get("two_factor_required") != true {
+		t.Fatalf("no two-factor challenge: %v", res.body)
+	}
+	challenge := res.str("challenge_token")
+
+	s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": challenge, "code": "000000"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+	s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": "bogus", "code": "000000"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired challenge")
+	code := s.totpCode(secret)
+	alice.keepSession(s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": challenge, "code": code}))
+
+	// Codes are single use
+	challenge = s.call("POST", "/api/auth/login", "", login).expectSuccess(fiber.StatusOK).str("challenge_token")
+	s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": challenge, "code": code}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+
+	// And so are recovery codes
+	recoveryCode := recoveryCodes[0].(string)
+	s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": challenge, "recovery_code": recoveryCode}).
+		expectSuccess(fiber.StatusOK)
+	s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": challenge, "recovery_code": recoveryCode}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+}
+
+func TestTwoFactorRecoveryCodesAndDisable(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+
+	s.call("POST", "/api/auth/2fa/recovery-codes", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusConflict, "Two-factor authentication is not enabled")
+	s.call("POST", "/api/auth/2fa/disable", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusConflict, "Two-factor authentication is not enabled")
+
+	secret, oldCodes := s.enrollTwoFactor(alice)
+
+	s.call("POST", "/api/auth/2fa/recovery-codes", "", fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusBadRequest, "Missing or malformed token")
+	s.call("POST", "/api/auth/2fa/recovery-codes", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+	newCodes := s.call("POST", "/api/auth/2fa/recovery-codes", alice.Token, fiber.Map{"code": s.totpCode(secret)}).
+		expectSuccess(fiber.StatusOK).
+		list("data.recovery_codes")
+
+	// The old codes are gone
+	s.call("POST", "/api/auth/2fa/disable", alice.Token, fiber.Map{"recovery_code": oldCodes[0]}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+	s.call("POST", "/api/auth/2fa/disable", alice.Token, fiber.Map{"recovery_code": newCodes[0]}).
+		expectSuccess(fiber.StatusOK)
+
+	res := s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": testPassword}).
+		expectSuccess(fiber.StatusOK)
+	if res.body["two_factor_required"] != nil {
+		t.Fatalf("two-factor still required: %v", res.body)
+	}
+}
+
+func TestTwoFactorCodesLockout(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	secret, _ := s.enrollTwoFactor(alice)
+
+	// Wrong codes count like failed logins, past the free attempts
+	s.call("POST", "/api/auth/2fa/disable", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+	s.call("POST", "/api/auth/2fa/recovery-codes", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+	s.call("POST", "/api/auth/2fa/disable", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusUnauthorized, "Invalid code")
+
+	// Even the right code waits now, on every route of the account
+	res := s.call("POST", "/api/auth/2fa/disable", alice.Token, fiber.Map{"code": s.totpCode(secret)}).
+		expectFailure(fiber.StatusTooManyRequests, "Too many failed attempts, try again later")
+	if res.header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Fatal("no Retry-After")
+	}
+	s.call("POST", "/api/auth/2fa/recovery-codes", alice.Token, fiber.Map{"code": "000000"}).
+		expectFailure(fiber.StatusTooManyRequests, "Too many failed attempts, try again later")
+	s.call("POST", "/api/auth/login", "", fiber.Map{"username": "alice", "password": testPassword}).
+		expectFailure(fiber.StatusTooManyRequests, "Too many failed attempts, try again later")
+}
+
+func TestAdminTwoFactorEnforcement(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	root := s.createAdmin("root")
+	other := s.createAdmin("other")
+
+	s.call("PUT", "/api/settings/security", root.Token, fiber.Map{"require_admin_two_factor": true}).
+		expectSuccess(fiber.StatusOK)
+
+	// Admins without a second factor must enroll first
+	login := fiber.Map{"username": "other", "password": testPassword}
+	res := s.call("POST", "/api/auth/login-admin", "", login).
+		expectFailure(fiber.StatusForbidden, "Two-factor authentication is required, enroll to log in")
+	enrollment := res.str("enrollment_token")
+
+	secret := s.call("POST", "/api/auth/2fa/enroll", "", fiber.Map{"enrollment_token": enrollment}).
+		expectSuccess(fiber.StatusOK).
+		str("data.secret")
+	s.call("POST", "/api/auth/2fa/confirm", "", fiber.Map{"enrollment_token": enrollment, "code": s.totpCode(secret)}).
+		expectSuccess(fiber.StatusOK)
+
+	challenge := s.call("POST", "/api/auth/login-admin", "", login).
+		expectSuccess(fiber.StatusOK).
+		str("challenge_token")
+	other.keepSession(s.call("POST", "/api/auth/2fa/verify", "", fiber.Map{"challenge_token": challenge, "code": s.totpCode(secret)}))
+
+	// And can't turn it off while it's required
+	s.call("POST", "/api/auth/2fa/disable", other.Token, fiber.Map{"code": s.totpCode(secret)}).
+		expectFailure(fiber.StatusForbidden, "Two-factor authentication is required for admins")
+}
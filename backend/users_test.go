@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	s.register("bob")
+	admin := s.createAdmin("root")
+
+	s.call("GET", "/api/users", alice.Token, nil).expectForbidden("user:list")
+
+	res := s.call("GET", "/api/users", admin.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 2 || len(res.list("data")) != 2 {
+		t.Fatalf("unexpected users %v", res.body)
+	}
+
+	res = s.call("GET", "/api/users?s=bob", admin.Token, nil).expect(fiber.StatusOK)
+	if res.num("total") != 1 {
+		t.Fatalf("unexpected search result %v", res.body)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	bob := s.registerUser("bob")
+	admin := s.createAdmin("root")
+
+	res := s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.username") != "alice" {
+		t.Fatalf("unexpected user %v", res.body)
+	}
+
+	// Other users are private
+	s.call("GET", "/api/users/"+bob.ID, alice.Token, nil).expectForbidden("user:read")
+	s.call("GET", "/api/users/"+bob.ID, admin.Token, nil).expectSuccess(fiber.StatusOK)
+	s.call("GET", "/api/users/"+primitive.NewObjectID().Hex(), admin.Token, nil).
+		expectFailure(fiber.StatusNotFound, "User not found")
+	s.call("GET", "/api/users/not-an-id", admin.Token, nil).expectFailure(fiber.StatusBadRequest, "Bad request")
+}
+
+func TestCreateUser(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	admin := s.createAdmin("root")
+
+	user := fiber.Map{"username": "carol", "password": testPassword, "email": "carol@example.com", "full_name": "Carol"}
+	s.call("POST", "/api/users", alice.Token, user).expectForbidden("user:create")
+	s.call("POST", "/api/users", admin.Token, fiber.Map{"username": "carol"}).expectFailure(fiber.StatusBadRequest, "")
+	s.call("POST", "/api/users", admin.Token, user).expectSuccess(fiber.StatusCreated)
+	s.call("POST", "/api/users", admin.Token, user).expectFailure(fiber.StatusConflict, "Username or email already in use")
+
+	s.call("POST", "/api/auth/login", "", fiber.Map{"username": "carol", "password": testPassword}).
+		expectSuccess(fiber.StatusOK)
+}
+
+func TestUpdateUser(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.verifiedUser("alice")
+	bob := s.registerUser("bob")
+	admin := s.createAdmin("root")
+
+	s.call("PATCH", "/api/users/"+bob.ID, alice.Token, fiber.Map{"full_name": "Bobby"}).expectForbidden("user:update")
+	s.call("PATCH", "/api/users/"+bob.ID, admin.Token, fiber.Map{"full_name": "Bobby"}).expectSuccess(fiber.StatusCreated)
+
+	// A new email address has to be verified again
+	s.call("PATCH", "/api/users/"+alice.ID, alice.Token, fiber.Map{"full_name": "Alice A.", "email": "alice@example.org"}).
+		expectSuccess(fiber.StatusCreated)
+	res := s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).expectSuccess(fiber.StatusOK)
+	if res.str("data.full_name") != "Alice A." || res.get("data.email_verified") != false {
+		t.Fatalf("unexpected user %v", res.body)
+	}
+	s.mail.wait(t, "alice@example.org", 1)
+
+	s.call("PATCH", "/api/users/"+bob.ID, bob.Token, fiber.Map{"email": "alice@example.org"}).
+		expectFailure(fiber.StatusConflict, "Username or email already in use")
+
+	// A new password ends the sessions
+	s.call("PATCH", "/api/users/"+bob.ID, bob.Token, fiber.Map{"password": "new-password-123"}).
+		expectSuccess(fiber.StatusCreated)
+	s.call("GET", "/api/users/"+bob.ID, bob.Token, nil).
+		expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+	s.call("POST", "/api/auth/refresh", "", fiber.Map{"refresh_token": bob.RefreshToken}).
+		expectFailure(fiber.StatusUnauthorized, "")
+	bob.Password = "new-password-123"
+	s.login(bob)
+	s.call("GET", "/api/users/"+bob.ID, bob.Token, nil).expectSuccess(fiber.StatusOK)
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	alice := s.registerUser("alice")
+	bob := s.registerUser("bob")
+	admin := s.createAdmin("root")
+
+	s.call("DELETE", "/api/users/"+bob.ID, alice.Token, nil).expectForbidden("user:delete")
+
+	// Deleting the account ends its sessions
+	s.call("DELETE", "/api/users/"+alice.ID, alice.Token, nil).expectSuccess(fiber.StatusCreated)
+	s.call("GET", "/api/users/"+alice.ID, alice.Token, nil).expectFailure(fiber.StatusUnauthorized, "Invalid or expired token")
+	s.call("POST", "/api/auth/refresh", "", fiber.Map{"refresh_token": alice.RefreshToken}).
+		expectFailure(fiber.StatusUnauthorized, "")
+
+	s.call("DELETE", "/api/users/"+bob.ID, admin.Token, nil).expectSuccess(fiber.StatusCreated)
+	s.call("GET", "/api/users/"+bob.ID, admin.Token, nil).expectFailure(fiber.StatusNotFound, "User not found")
+}